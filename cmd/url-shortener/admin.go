@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-shortener/internal/database"
+	"url-shortener/internal/kafka"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/service"
+
+	"github.com/google/uuid"
+)
+
+const adminUsage = `Usage: url-shortener admin <command> [flags]
+
+Commands:
+  create-product   Create a product with initial stock
+  restock          Add stock to an existing product
+  expire-links     Deactivate short links immediately and evict them from the cache
+  dump-analytics   Print the recorded clicks of a short link as JSON or CSV
+  dlq-list         Print inventory events parked in the dead letter queue
+  dlq-replay       Publish dead-lettered inventory events back for processing
+`
+
+// runAdmin dispatches admin maintenance commands
+func runAdmin(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, adminUsage)
+		os.Exit(2)
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "create-product":
+		return adminCreateProduct(args)
+	case "restock":
+		return adminRestock(args)
+	case "expire-links":
+		return adminExpireLinks(args)
+	case "dump-analytics":
+		return adminDumpAnalytics(args)
+	case "dlq-list":
+		return adminDLQList(args)
+	case "dlq-replay":
+		return adminDLQReplay(args)
+	case "help", "-h", "--help":
+		fmt.Print(adminUsage)
+		return nil
+	default:
+		return fmt.Errorf("unknown admin command %q", command)
+	}
+}
+
+func adminCreateProduct(args []string) error {
+	flags := flag.NewFlagSet("admin create-product", flag.ExitOnError)
+	id := flags.String("id", "", "product ID (generated when empty)")
+	name := flags.String("name", "", "product name")
+	description := flags.String("description", "", "product description")
+	price := flags.Float64("price", 0, "unit price")
+	stock := flags.Int("stock", 0, "initial stock")
+	location := flags.String("location", models.DefaultLocationID, "location holding the initial stock")
+	configOpts := configFlags(flags)
+	flags.Parse(args)
+
+	if *name == "" {
+		return fmt.Errorf("--name is required")
+	}
+	if *price < 0 || *stock < 0 {
+		return fmt.Errorf("--price and --stock must not be negative")
+	}
+	if *id != "" {
+		if _, err := uuid.Parse(*id); err != nil {
+			return fmt.Errorf("invalid product ID %q: %w", *id, err)
+		}
+	}
+
+	cfg, err := loadConfig(configOpts)
+	if err != nil {
+		return err
+	}
+	db, err := openDatabase(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Recorded and published like products created over the admin API
+	products := service.NewProductService(repository.NewInventoryRepository(db))
+	product, err := products.CreateProduct(context.Background(), &models.CreateProductRequest{
+		ID:          *id,
+		Name:        *name,
+		Description: *description,
+		Price:       *price,
+		Stock:       *stock,
+		LocationID:  *location,
+	})
+	if err != nil {
+		return err
+	}
+
+	return printJSON(product)
+}
+
+func adminRestock(args []string) error {
+	flags := flag.NewFlagSet("admin restock", flag.ExitOnError)
+	productID := flags.String("product-id", "", "product to restock")
+	quantity := flags.Int("quantity", 0, "units to add")
+	note := flags.String("note", "", "note recorded with the restock")
+	location := flags.String("location", models.DefaultLocationID, "location the stock arrived at")
+	configOpts := configFlags(flags)
+	flags.Parse(args)
+
+	if *productID == "" || *quantity <= 0 {
+		return fmt.Errorf("--product-id and a positive --quantity are required")
+	}
+
+	cfg, err := loadConfig(configOpts)
+	if err != nil {
+		return err
+	}
+	db, err := openDatabase(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	products := service.NewProductService(repository.NewInventoryRepository(db))
+	response, err := products.RestockProduct(context.Background(), *productID, &models.RestockRequest{Quantity: *quantity, Note: *note, LocationID: *location})
+	if err != nil {
+		return err
+	}
+
+	return printJSON(response)
+}
+
+func adminExpireLinks(args []string) error {
+	flags := flag.NewFlagSet("admin expire-links", flag.ExitOnError)
+	codes := flags.String("codes", "", "comma-separated short codes to expire")
+	configOpts := configFlags(flags)
+	flags.Parse(args)
+
+	var shortCodes []string
+	for _, code := range strings.Split(*codes, ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			shortCodes = append(shortCodes, code)
+		}
+	}
+	if len(shortCodes) == 0 {
+		return fmt.Errorf("--codes is required")
+	}
+
+	cfg, err := loadConfig(configOpts)
+	if err != nil {
+		return err
+	}
+	db, err := openDatabase(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Evict cached links and duplicate-detection entries, and tell serving
+	// replicas to drop their in-process copies, so the links stop resolving
+	// immediately instead of when the cache entries time out
+	urlRepo := repository.NewURLRepository(db)
+	redisClient, redisBreaker, err := database.InitializeRedis(cfg.RedisURL, cfg.Redis)
+	if err != nil {
+		return err
+	}
+	defer redisClient.Close()
+	if !redisBreaker.Healthy() {
+		slog.Warn("Expiring links without evicting cache entries")
+	}
+	urlRepo = service.NewInvalidatingURLRepository(urlRepo, redisClient, cfg.Cache)
+
+	expired, err := urlRepo.ExpireByShortCodes(context.Background(), shortCodes)
+	if err != nil {
+		return err
+	}
+
+	codesExpired := make([]string, len(expired))
+	for i, url := range expired {
+		codesExpired[i] = url.ShortCode
+	}
+
+	return printJSON(map[string]interface{}{
+		"expired": codesExpired,
+		"count":   len(expired),
+	})
+}
+
+func adminDumpAnalytics(args []string) error {
+	flags := flag.NewFlagSet("admin dump-analytics", flag.ExitOnError)
+	shortCode := flags.String("short-code", "", "short link to dump")
+	limit := flags.Int("limit", 1000, "maximum number of clicks, most recent first")
+	format := flags.String("format", "json", "output format: json or csv")
+	configOpts := configFlags(flags)
+	flags.Parse(args)
+
+	if *shortCode == "" {
+		return fmt.Errorf("--short-code is required")
+	}
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("unknown format %q, expected json or csv", *format)
+	}
+
+	cfg, err := loadConfig(configOpts)
+	if err != nil {
+		return err
+	}
+	db, err := openDatabase(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	url, err := repository.NewURLRepository(db).GetByShortCode(context.Background(), *shortCode)
+	if err != nil {
+		return err
+	}
+
+	clicks, err := repository.NewAnalyticsRepository(db).GetByURLID(context.Background(), url.ID, *limit)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		return printJSON(clicks)
+	}
+
+	writer := csv.NewWriter(os.Stdout)
+	writer.Write([]string{"id", "clicked_at", "ip_address", "user_agent", "referer"})
+	for _, click := range clicks {
+		writer.Write([]string{
+			strconv.Itoa(click.ID),
+			click.ClickedAt.Format(time.RFC3339),
+			click.IPAddress,
+			click.UserAgent,
+			click.Referer,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func adminDLQList(args []string) error {
+	flags := flag.NewFlagSet("admin dlq-list", flag.ExitOnError)
+	limit := flags.Int("limit", 100, "maximum number of dead letters, 0 for all")
+	configOpts := configFlags(flags)
+	flags.Parse(args)
+
+	if *limit < 0 {
+		return fmt.Errorf("--limit must not be negative")
+	}
+
+	cfg, err := loadConfig(configOpts)
+	if err != nil {
+		return err
+	}
+	queue, err := kafka.NewDeadLetterQueue(consumerConfig(cfg), nil)
+	if err != nil {
+		return err
+	}
+	defer queue.Close()
+
+	deadLetters, err := queue.List(context.Background(), *limit)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(map[string]interface{}{
+		"topic":       queue.Topic(),
+		"deadLetters": deadLetters,
+		"count":       len(deadLetters),
+	})
+}
+
+func adminDLQReplay(args []string) error {
+	flags := flag.NewFlagSet("admin dlq-replay", flag.ExitOnError)
+	partition := flags.Int("partition", -1, "partition of the dead letter to replay")
+	offset := flags.Int64("offset", -1, "offset of the dead letter to replay")
+	all := flags.Bool("all", false, "replay every dead letter")
+	configOpts := configFlags(flags)
+	flags.Parse(args)
+
+	if *all == (*partition >= 0 || *offset >= 0) {
+		return fmt.Errorf("either --all or --partition and --offset are required")
+	}
+	if !*all && (*partition < 0 || *offset < 0) {
+		return fmt.Errorf("--partition and --offset are both required")
+	}
+
+	cfg, err := loadConfig(configOpts)
+	if err != nil {
+		return err
+	}
+	producer, err := newProducer(cfg)
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	queue, err := kafka.NewDeadLetterQueue(consumerConfig(cfg), producer)
+	if err != nil {
+		return err
+	}
+	defer queue.Close()
+
+	// Events that were applied in the meantime are skipped by the processor
+	replayed := 1
+	if *all {
+		replayed, err = queue.ReplayAll(context.Background())
+	} else {
+		err = queue.Replay(context.Background(), int32(*partition), *offset)
+	}
+	if err != nil {
+		return err
+	}
+
+	return printJSON(map[string]interface{}{
+		"topic":    queue.Topic(),
+		"replayed": replayed,
+	})
+}
+
+func printJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/database"
+	"url-shortener/internal/handlers"
+	"url-shortener/internal/health"
+	"url-shortener/internal/kafka"
+	"url-shortener/internal/logging"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/middleware"
+	"url-shortener/internal/server"
+	"url-shortener/internal/tracing"
+	"url-shortener/migrations"
+
+	"github.com/gin-gonic/gin"
+)
+
+// configFlags registers the --config and --set flags shared by every command
+func configFlags(flags *flag.FlagSet) *config.Options {
+	opts := &config.Options{Overrides: make(map[string]string)}
+	flags.StringVar(&opts.File, "config", "", "YAML or TOML config file (defaults to CONFIG_FILE)")
+	flags.Func("set", "override a setting, e.g. --set KAFKA_BROKERS=kafka:9092 (repeatable)", func(value string) error {
+		key, setting, found := strings.Cut(value, "=")
+		if !found || key == "" {
+			return fmt.Errorf("expected KEY=value")
+		}
+		opts.Overrides[key] = setting
+		return nil
+	})
+	return opts
+}
+
+// loadConfig loads configuration and sets up structured logging
+func loadConfig(opts *config.Options) (*config.Config, error) {
+	cfg, err := config.Load(*opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := logging.Setup(cfg.Log.Level, cfg.Log.Format); err != nil {
+		return nil, fmt.Errorf("failed to configure logging: %w", err)
+	}
+	return cfg, nil
+}
+
+// setupTracing installs the tracer provider for long-running commands
+func setupTracing(cfg *config.Config) (func(context.Context) error, error) {
+	shutdown, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure tracing: %w", err)
+	}
+	return shutdown, nil
+}
+
+// openDatabase connects to Postgres, registers pool metrics and, when
+// migrate is set, applies pending schema migrations
+func openDatabase(cfg *config.Config, migrate bool) (*sql.DB, error) {
+	db, err := database.Initialize(cfg.DatabaseURL, cfg.DBMaxOpenConns, cfg.DBMaxIdleConns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	if err := metrics.RegisterDBStats(db, "postgres"); err != nil {
+		slog.Warn("Failed to register database metrics", "error", err)
+	}
+
+	if migrate {
+		if err := database.MigrateUp(context.Background(), db, migrations.FS); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to apply migrations: %w", err)
+		}
+	}
+
+	return db, nil
+}
+
+// newProducer creates the Kafka producer
+func newProducer(cfg *config.Config) (*kafka.Producer, error) {
+	producer, err := kafka.NewProducer(&kafka.ProducerConfig{
+		Brokers:       cfg.Kafka.Brokers,
+		TopicPrefix:   cfg.Kafka.TopicPrefix,
+		RetryAttempts: cfg.Kafka.RetryAttempts,
+		RetryDelay:    cfg.Kafka.RetryDelay,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka producer: %w", err)
+	}
+	return producer, nil
+}
+
+// newConsumer creates the Kafka consumer, dead-lettering messages it cannot
+// handle through producer
+func newConsumer(cfg *config.Config, producer *kafka.Producer) (*kafka.Consumer, error) {
+	consumer, err := kafka.NewConsumer(consumerConfig(cfg), producer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka consumer: %w", err)
+	}
+	return consumer, nil
+}
+
+// consumerConfig returns the settings of the inventory event consumer
+func consumerConfig(cfg *config.Config) *kafka.ConsumerConfig {
+	return &kafka.ConsumerConfig{
+		Brokers:           cfg.Kafka.Brokers,
+		GroupID:           cfg.Kafka.ConsumerGroupID,
+		TopicPrefix:       cfg.Kafka.TopicPrefix,
+		SessionTimeout:    cfg.Kafka.SessionTimeout,
+		HeartbeatInterval: cfg.Kafka.HeartbeatInterval,
+		RetryAttempts:     cfg.Kafka.RetryAttempts,
+		RetryDelay:        cfg.Kafka.RetryDelay,
+		HandlerRetries:    cfg.Kafka.HandlerRetries,
+		HandlerBackoff:    cfg.Kafka.HandlerBackoff,
+		HandlerMaxBackoff: cfg.Kafka.HandlerMaxBackoff,
+	}
+}
+
+// newReplyListener creates the listener for reservation replies
+func newReplyListener(cfg *config.Config) (*kafka.ReplyListener, error) {
+	listener, err := kafka.NewReplyListener(&kafka.ConsumerConfig{
+		Brokers:     cfg.Kafka.Brokers,
+		TopicPrefix: cfg.Kafka.TopicPrefix,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka reply listener: %w", err)
+	}
+	return listener, nil
+}
+
+// registerOperationalRoutes exposes health probes and Prometheus metrics
+func registerOperationalRoutes(router *gin.Engine, checker *health.Checker) *handlers.HealthHandler {
+	healthHandler := handlers.NewHealthHandler(checker)
+
+	router.GET("/healthz", healthHandler.Liveness)
+	router.GET("/readyz", healthHandler.Readiness)
+	router.GET("/api/v1/health", healthHandler.Readiness)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	return healthHandler
+}
+
+// newConfigWatcher reloads runtime settings on SIGHUP and config file
+// changes, applying log level changes itself. The returned step stops watching.
+func newConfigWatcher(cfg *config.Config, opts *config.Options) (*config.Watcher, server.Step) {
+	watcher := config.NewWatcher(cfg, *opts)
+	watcher.Subscribe("log level", func(runtime config.Runtime) {
+		if err := logging.SetLevel(runtime.LogLevel); err != nil {
+			slog.Error("Failed to apply log level", "error", err)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go watcher.Run(ctx)
+
+	return watcher, server.Step{Name: "stop config watcher", Run: func(context.Context) error {
+		cancel()
+		return nil
+	}}
+}
+
+// newRouter creates a router with the middleware shared by all HTTP servers.
+// CORS origins follow configuration reloads.
+func newRouter(cfg *config.Config, watcher *config.Watcher) *gin.Engine {
+	router := gin.New()
+
+	corsPolicies := func(runtime config.Runtime) (config.CORSConfig, map[string]config.CORSConfig) {
+		defaultCfg, inventoryCfg := cfg.CORS, cfg.InventoryCORS
+		defaultCfg.AllowedOrigins = runtime.CORSOrigins
+		inventoryCfg.AllowedOrigins = runtime.InventoryCORSOrigins
+		return defaultCfg, map[string]config.CORSConfig{"/api/v1/inventory": inventoryCfg}
+	}
+	cors := middleware.NewCORSRouter(corsPolicies(watcher.Current()))
+	watcher.Subscribe("cors", func(runtime config.Runtime) {
+		cors.Update(corsPolicies(runtime))
+	})
+
+	router.Use(gin.Recovery())
+	router.Use(middleware.RequestID())
+	router.Use(middleware.Tracing())
+	router.Use(cors.Handler())
+	router.Use(middleware.Logger())
+	router.Use(middleware.Metrics())
+
+	return router
+}
+
+// closeStep wraps a Close method as a shutdown step
+func closeStep(name string, close func() error) server.Step {
+	return server.Step{Name: name, Run: func(context.Context) error { return close() }}
+}
+
+// backgroundStep starts run in the background and returns a shutdown step
+// that stops it and waits for it to return
+func backgroundStep(name string, run func(ctx context.Context)) server.Step {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx)
+	}()
+
+	return server.Step{Name: name, Run: func(shutdownCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-shutdownCtx.Done():
+			return shutdownCtx.Err()
+		}
+	}}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"url-shortener/internal/config"
+)
+
+const configUsage = `Usage: url-shortener config <command> [flags]
+
+Commands:
+  print      Show the effective value and source of every setting, secrets redacted
+  validate   Check the configuration and exit non-zero if it is invalid
+`
+
+// runConfig inspects the configuration without connecting to any dependency
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, configUsage)
+		os.Exit(2)
+	}
+
+	command, args := args[0], args[1:]
+	flags := flag.NewFlagSet("config "+command, flag.ExitOnError)
+	configOpts := configFlags(flags)
+
+	switch command {
+	case "print":
+		flags.Parse(args)
+		cfg, err := config.Load(*configOpts)
+		if err != nil {
+			return err
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "KEY\tVALUE\tSOURCE")
+		for _, setting := range cfg.Settings() {
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", setting.Key, setting.Value, setting.Source)
+		}
+		return writer.Flush()
+
+	case "validate":
+		flags.Parse(args)
+		if _, err := config.Load(*configOpts); err != nil {
+			return err
+		}
+		fmt.Println("configuration is valid")
+		return nil
+
+	case "help", "-h", "--help":
+		fmt.Print(configUsage)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown config command %q", command)
+	}
+}
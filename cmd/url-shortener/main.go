@@ -0,0 +1,70 @@
+// Command url-shortener runs the URL shortener and inventory services.
+//
+// Usage:
+//
+//	url-shortener serve [--features=urls,inventory]   run the HTTP API
+//	url-shortener worker [--port=PORT]                 run the Kafka consumer and cleanup loops
+//	url-shortener migrate [up | down [N] | status]     manage the database schema
+//	url-shortener admin <command> [flags]              run maintenance tasks
+//	url-shortener config print | validate              inspect the effective configuration
+//	url-shortener version                              print build information
+//
+// Every command accepts --config=FILE (YAML or TOML) and repeated
+// --set KEY=value flags, which take precedence over environment variables.
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"url-shortener/internal/version"
+)
+
+const usage = `Usage: url-shortener <command> [flags]
+
+Commands:
+  serve     Run the HTTP API (--features=urls,inventory)
+  worker    Run the Kafka consumer and reservation cleanup
+  migrate   Apply or revert schema migrations (up, down [N], status)
+  admin     Maintenance tasks (create-product, restock, expire-links, dump-analytics)
+  config    Show or validate the effective configuration (print, validate)
+  version   Print build information
+
+Settings come from defaults, a config file (--config or CONFIG_FILE),
+environment variables and --set KEY=value flags, in increasing precedence.
+Run 'url-shortener <command> -h' for command flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "serve":
+		err = runServe(args)
+	case "worker":
+		err = runWorker(args)
+	case "migrate":
+		err = runMigrate(args)
+	case "admin":
+		err = runAdmin(args)
+	case "config":
+		err = runConfig(args)
+	case "version":
+		fmt.Printf("url-shortener %s (commit %s, built %s)\n", version.Version, version.Commit, version.BuildTime)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		slog.Error("Command failed", "command", os.Args[1], "error", err)
+		os.Exit(1)
+	}
+}
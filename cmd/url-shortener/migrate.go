@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"url-shortener/internal/database"
+	"url-shortener/migrations"
+)
+
+// runMigrate applies or reverts schema migrations, see database.RunMigrateCommand
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configOpts := configFlags(flags)
+	flags.Parse(args)
+
+	cfg, err := loadConfig(configOpts)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDatabase(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return database.RunMigrateCommand(context.Background(), db, migrations.FS, flags.Args())
+}
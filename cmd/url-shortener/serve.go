@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/database"
+	"url-shortener/internal/handlers"
+	"url-shortener/internal/health"
+	"url-shortener/internal/middleware"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/server"
+	"url-shortener/internal/service"
+)
+
+const (
+	featureURLs      = "urls"
+	featureInventory = "inventory"
+)
+
+// runServe runs the HTTP API for the selected features. Inventory events are
+// only published here; the worker command consumes them.
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	featureList := flags.String("features", featureURLs+","+featureInventory, "comma-separated features to serve: urls, inventory")
+	configOpts := configFlags(flags)
+	flags.Parse(args)
+
+	features, err := parseFeatures(*featureList)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(configOpts)
+	if err != nil {
+		return err
+	}
+
+	shutdownTracing, err := setupTracing(cfg)
+	if err != nil {
+		return err
+	}
+
+	watcher, stopWatcher := newConfigWatcher(cfg, configOpts)
+
+	db, err := openDatabase(cfg, cfg.AutoMigrate)
+	if err != nil {
+		return err
+	}
+
+	redisClient, redisBreaker, err := database.InitializeRedis(cfg.RedisURL, cfg.Redis)
+	if err != nil {
+		return err
+	}
+
+	router := newRouter(cfg, watcher)
+
+	// Rate limiting shared across replicas through Redis
+	rateLimiter := middleware.NewRateLimiter(
+		middleware.NewRedisLimiter(redisClient, cfg.RateLimit.KeyPrefix),
+		cfg.RateLimit,
+	)
+	watcher.Subscribe("rate limits", func(runtime config.Runtime) {
+		rateLimiter.Update(runtime.RateLimit)
+	})
+	defaultLimit := rateLimiter.Policy(cfg.RateLimit.Default)
+
+	healthChecker := health.NewChecker(cfg.HealthCheckTimeout)
+	healthChecker.Register("postgres", health.Database(db))
+	healthChecker.Register("redis", health.Redis(redisClient, redisBreaker))
+
+	// Teardown runs in order: feature-specific flushing first, shared clients last
+	var steps []server.Step
+
+	if features[featureInventory] {
+		producer, err := newProducer(cfg)
+		if err != nil {
+			return err
+		}
+
+		replyListener, err := newReplyListener(cfg)
+		if err != nil {
+			return err
+		}
+		if err := replyListener.Start(context.Background()); err != nil {
+			return fmt.Errorf("failed to start reply listener: %w", err)
+		}
+
+		inventoryRepo := repository.NewInventoryRepository(db)
+		inventoryService := service.NewInventoryService(db, redisClient, producer, nil, replyListener, inventoryRepo, cfg.Inventory)
+		inventoryHandler := handlers.NewInventoryHandler(inventoryService)
+		watcher.Subscribe("reservation timeout", func(runtime config.Runtime) {
+			inventoryService.SetReservationTimeout(runtime.ReservationTimeout)
+		})
+
+		healthChecker.Register("kafka", health.KafkaBrokers(producer))
+
+		inventoryAPI := router.Group("/api/v1/inventory")
+		{
+			// Product availability
+			inventoryAPI.GET("/:productId/availability", defaultLimit, inventoryHandler.CheckAvailability)
+			inventoryAPI.GET("/:productId", defaultLimit, inventoryHandler.GetProductInventory)
+
+			// Inventory operations
+			inventoryAPI.POST("/reserve", rateLimiter.Policy(cfg.RateLimit.InventoryReserve), inventoryHandler.ReserveInventory)
+			inventoryAPI.POST("/reserve-batch", rateLimiter.Policy(cfg.RateLimit.InventoryReserve), inventoryHandler.ReserveBatch)
+			inventoryAPI.POST("/confirm/:orderId", defaultLimit, inventoryHandler.ConfirmPurchase)
+			inventoryAPI.POST("/release/:orderId", defaultLimit, inventoryHandler.ReleaseReservation)
+
+			// Reservations
+			inventoryAPI.GET("/batches/:batchId", defaultLimit, inventoryHandler.GetReservationBatch)
+			inventoryAPI.GET("/reservations/:orderId", defaultLimit, inventoryHandler.GetReservation)
+			inventoryAPI.POST("/reservations/:orderId/extend", defaultLimit, inventoryHandler.ExtendReservation)
+			inventoryAPI.GET("/users/:userId/reservations", defaultLimit, inventoryHandler.GetUserReservations)
+
+			// Bulk operations
+			inventoryAPI.POST("/bulk-check", defaultLimit, inventoryHandler.BulkCheckAvailability)
+
+			// Metrics
+			inventoryAPI.GET("/metrics", defaultLimit, inventoryHandler.GetInventoryMetrics)
+		}
+
+		// Admin product API, only served when a token is configured
+		if cfg.Inventory.AdminToken != "" {
+			productHandler := handlers.NewProductHandler(service.NewProductService(inventoryRepo))
+
+			adminAPI := router.Group("/api/v1/admin/products", middleware.AdminAuth(cfg.Inventory.AdminToken), defaultLimit)
+			{
+				adminAPI.GET("", productHandler.ListProducts)
+				adminAPI.POST("", productHandler.CreateProduct)
+				adminAPI.GET("/:productId", productHandler.GetProduct)
+				adminAPI.PUT("/:productId", productHandler.UpdateProduct)
+				adminAPI.DELETE("/:productId", productHandler.DeleteProduct)
+
+				// Stock changes
+				adminAPI.POST("/:productId/restock", productHandler.RestockProduct)
+				adminAPI.POST("/:productId/adjustments", productHandler.AdjustStock)
+			}
+
+			locationAPI := router.Group("/api/v1/admin/locations", middleware.AdminAuth(cfg.Inventory.AdminToken), defaultLimit)
+			{
+				locationAPI.GET("", productHandler.ListLocations)
+				locationAPI.POST("", productHandler.CreateLocation)
+			}
+		} else {
+			slog.Info("Admin product API disabled, INVENTORY_ADMIN_TOKEN is not set")
+		}
+
+		// Publishes the events and state queued with each change
+		relay := backgroundStep("stop outbox relay", inventoryService.RunOutboxRelay)
+
+		steps = append(steps,
+			relay,
+			server.Step{Name: "flush inventory events", Run: producer.Flush},
+			closeStep("close kafka producer", producer.Close),
+			closeStep("close kafka reply listener", replyListener.Close),
+		)
+	}
+
+	if features[featureURLs] {
+		urlRepo := repository.NewURLRepository(db)
+		analyticsRepo := repository.NewAnalyticsRepository(db)
+		urlService := service.NewURLService(urlRepo, analyticsRepo, redisClient, cfg.BaseURL, cfg.PreGen, cfg.Cache)
+		urlHandler := handlers.NewURLHandler(urlService, cfg.URLTimeouts)
+		analyticsHandler := handlers.NewAnalyticsHandler(urlService, cfg.URLTimeouts.Analytics)
+		watcher.Subscribe("pre-generation", func(runtime config.Runtime) {
+			urlService.UpdatePreGen(runtime.PreGen)
+		})
+
+		invalidationCtx, stopInvalidation := context.WithCancel(context.Background())
+		go urlService.RunCacheInvalidation(invalidationCtx)
+		go func() {
+			if err := urlService.WarmCache(invalidationCtx); err != nil {
+				slog.Warn("Starting with a cold URL cache", "error", err)
+			}
+		}()
+
+		if err := urlService.StartPreGeneration(); err != nil {
+			slog.Error("Failed to start pre-generation service", "error", err)
+		} else {
+			slog.Info("Pre-generation service started successfully")
+		}
+
+		healthChecker.Register("preGeneratedPool", health.PreGeneratedPool(urlRepo, func() int {
+			return watcher.Current().PreGen.MinPoolSize
+		}))
+
+		api := router.Group("/api/v1")
+		{
+			api.POST("/shorten", rateLimiter.Policy(cfg.RateLimit.Shorten), urlHandler.ShortenURL)
+			api.GET("/analytics/:shortCode", defaultLimit, analyticsHandler.GetAnalytics)
+		}
+
+		// Redirect route (must be last to avoid conflicts)
+		router.GET("/:shortCode", rateLimiter.Policy(cfg.RateLimit.Redirect), urlHandler.RedirectURL)
+
+		steps = append([]server.Step{
+			{Name: "stop pre-generation", Run: func(context.Context) error {
+				urlService.StopPreGeneration()
+				return nil
+			}},
+			{Name: "flush analytics", Run: urlService.Flush},
+			{Name: "stop cache invalidation", Run: func(context.Context) error {
+				stopInvalidation()
+				return nil
+			}},
+		}, steps...)
+	}
+
+	healthHandler := registerOperationalRoutes(router, healthChecker)
+
+	steps = append([]server.Step{stopWatcher}, steps...)
+	steps = append(steps,
+		closeStep("close redis", redisClient.Close),
+		closeStep("close database", db.Close),
+		server.Step{Name: "flush traces", Run: shutdownTracing},
+	)
+
+	slog.Info("Serving features", "features", *featureList)
+	return server.Run(server.New(cfg.Port, router), cfg.Shutdown, healthHandler.StartShutdown, steps...)
+}
+
+// parseFeatures parses a comma-separated feature list
+func parseFeatures(list string) (map[string]bool, error) {
+	features := make(map[string]bool)
+	for _, feature := range strings.Split(list, ",") {
+		switch feature = strings.TrimSpace(feature); feature {
+		case featureURLs, featureInventory:
+			features[feature] = true
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown feature %q, expected %s or %s", feature, featureURLs, featureInventory)
+		}
+	}
+	if len(features) == 0 {
+		return nil, fmt.Errorf("at least one feature must be enabled")
+	}
+	return features, nil
+}
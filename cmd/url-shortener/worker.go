@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/database"
+	"url-shortener/internal/health"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/server"
+	"url-shortener/internal/service"
+)
+
+// runWorker consumes inventory events and expires stale reservations. It
+// only serves health probes and metrics over HTTP.
+func runWorker(args []string) error {
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+	port := flags.String("port", "", "port for health and metrics endpoints (defaults to PORT)")
+	configOpts := configFlags(flags)
+	flags.Parse(args)
+
+	if *port != "" {
+		configOpts.Overrides["PORT"] = *port
+	}
+	cfg, err := loadConfig(configOpts)
+	if err != nil {
+		return err
+	}
+
+	shutdownTracing, err := setupTracing(cfg)
+	if err != nil {
+		return err
+	}
+
+	watcher, stopWatcher := newConfigWatcher(cfg, configOpts)
+
+	db, err := openDatabase(cfg, cfg.AutoMigrate)
+	if err != nil {
+		return err
+	}
+
+	redisClient, redisBreaker, err := database.InitializeRedis(cfg.RedisURL, cfg.Redis)
+	if err != nil {
+		return err
+	}
+
+	producer, err := newProducer(cfg)
+	if err != nil {
+		return err
+	}
+
+	consumer, err := newConsumer(cfg, producer)
+	if err != nil {
+		return err
+	}
+
+	inventoryRepo := repository.NewInventoryRepository(db)
+	inventoryService := service.NewInventoryService(db, redisClient, producer, consumer, nil, inventoryRepo, cfg.Inventory)
+	watcher.Subscribe("reservation timeout", func(runtime config.Runtime) {
+		inventoryService.SetReservationTimeout(runtime.ReservationTimeout)
+	})
+	if err := inventoryService.StartInventoryProcessor(context.Background()); err != nil {
+		return fmt.Errorf("failed to start inventory processor: %w", err)
+	}
+
+	relay := backgroundStep("stop outbox relay", inventoryService.RunOutboxRelay)
+
+	healthChecker := health.NewChecker(cfg.HealthCheckTimeout)
+	healthChecker.Register("postgres", health.Database(db))
+	healthChecker.Register("redis", health.Redis(redisClient, redisBreaker))
+	healthChecker.Register("kafka", health.KafkaConsumer(consumer))
+
+	router := newRouter(cfg, watcher)
+	healthHandler := registerOperationalRoutes(router, healthChecker)
+
+	// The consumer stops first, finishing the message in flight and
+	// committing offsets, then the relay publishing what its handlers queued,
+	// then anything published is flushed
+	return server.Run(server.New(cfg.Port, router), cfg.Shutdown, healthHandler.StartShutdown,
+		stopWatcher,
+		server.Step{Name: "stop inventory processor", Run: func(context.Context) error {
+			inventoryService.StopInventoryProcessor()
+			return nil
+		}},
+		relay,
+		server.Step{Name: "flush inventory events", Run: producer.Flush},
+		closeStep("close kafka producer", producer.Close),
+		closeStep("close redis", redisClient.Close),
+		closeStep("close database", db.Close),
+		server.Step{Name: "flush traces", Run: shutdownTracing},
+	)
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Invalidator broadcasts cache invalidations to every replica over Redis
+// pub/sub so in-process caches drop entries for links that changed elsewhere
+type Invalidator struct {
+	client  redis.UniversalClient
+	channel string
+
+	mu       sync.RWMutex
+	handlers []func(keys []string)
+}
+
+// NewInvalidator creates an invalidator publishing on channel
+func NewInvalidator(client redis.UniversalClient, channel string) *Invalidator {
+	return &Invalidator{client: client, channel: channel}
+}
+
+// OnInvalidate registers fn to be called with the keys of every invalidation,
+// including the ones published by this process
+func (i *Invalidator) OnInvalidate(fn func(keys []string)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.handlers = append(i.handlers, fn)
+}
+
+// Publish invalidates keys locally right away and on other replicas through
+// Redis. Local invalidation happens even when publishing fails.
+func (i *Invalidator) Publish(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	i.dispatch(keys)
+
+	payload, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("failed to encode invalidation: %w", err)
+	}
+	if err := i.client.Publish(ctx, i.channel, payload).Err(); err != nil {
+		return fmt.Errorf("failed to publish invalidation: %w", err)
+	}
+	return nil
+}
+
+// Run applies invalidations published by other replicas until ctx is done.
+// The subscription reconnects on its own after Redis errors; messages sent
+// while disconnected are lost, which the short TTL of local entries bounds.
+func (i *Invalidator) Run(ctx context.Context) {
+	pubsub := i.client.Subscribe(ctx, i.channel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			var keys []string
+			if err := json.Unmarshal([]byte(message.Payload), &keys); err != nil {
+				slog.WarnContext(ctx, "Ignoring malformed cache invalidation", "channel", i.channel, "error", err)
+				continue
+			}
+			i.dispatch(keys)
+		}
+	}
+}
+
+func (i *Invalidator) dispatch(keys []string) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	for _, handler := range i.handlers {
+		handler(keys)
+	}
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-shortener/internal/models"
+)
+
+// linkVersion prefixes every encoded link. Bump it when the layout changes;
+// values written by other versions then decode as misses and are reloaded.
+const linkVersion = "v1"
+
+// ErrUnsupportedEncoding is returned for cached values in an unknown layout,
+// including the bare destination strings cached by older releases
+var ErrUnsupportedEncoding = errors.New("unsupported cached link encoding")
+
+// EncodeLink serializes the metadata needed to serve a redirect as
+//
+//	v1|<id>|<active 0/1>|<expires unix seconds or empty>|<original URL>
+//
+// The original URL comes last so it may contain the separator.
+func EncodeLink(url *models.URL) string {
+	active := "0"
+	if url.IsActive {
+		active = "1"
+	}
+	expires := ""
+	if url.ExpiresAt != nil {
+		expires = strconv.FormatInt(url.ExpiresAt.Unix(), 10)
+	}
+	return strings.Join([]string{linkVersion, strconv.Itoa(url.ID), active, expires, url.OriginalURL}, "|")
+}
+
+// DecodeLink parses a value written by EncodeLink for the given short code
+func DecodeLink(shortCode, value string) (*models.URL, error) {
+	fields := strings.SplitN(value, "|", 5)
+	if len(fields) != 5 || fields[0] != linkVersion {
+		return nil, ErrUnsupportedEncoding
+	}
+
+	id, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode link ID: %w", err)
+	}
+	if fields[2] != "0" && fields[2] != "1" {
+		return nil, fmt.Errorf("failed to decode link status %q", fields[2])
+	}
+
+	url := &models.URL{
+		ID:          id,
+		ShortCode:   shortCode,
+		OriginalURL: fields[4],
+		IsActive:    fields[2] == "1",
+		IsUsed:      true,
+	}
+	if fields[3] != "" {
+		seconds, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode link expiry: %w", err)
+		}
+		expiresAt := time.Unix(seconds, 0)
+		url.ExpiresAt = &expiresAt
+	}
+
+	return url, nil
+}
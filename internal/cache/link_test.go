@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"url-shortener/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLink_RoundTrip(t *testing.T) {
+	expiresAt := time.Unix(1900000000, 0)
+	link := &models.URL{
+		ID:          42,
+		ShortCode:   "abc123",
+		OriginalURL: "https://example.com/a|b?c=d",
+		ExpiresAt:   &expiresAt,
+		IsActive:    true,
+		IsUsed:      true,
+	}
+
+	decoded, err := DecodeLink("abc123", EncodeLink(link))
+	require.NoError(t, err)
+	assert.Equal(t, link.ID, decoded.ID)
+	assert.Equal(t, link.OriginalURL, decoded.OriginalURL)
+	assert.True(t, decoded.IsActive)
+	require.NotNil(t, decoded.ExpiresAt)
+	assert.True(t, expiresAt.Equal(*decoded.ExpiresAt))
+
+	decoded, err = DecodeLink("abc123", EncodeLink(&models.URL{ID: 7, OriginalURL: "https://example.com"}))
+	require.NoError(t, err)
+	assert.False(t, decoded.IsActive)
+	assert.Nil(t, decoded.ExpiresAt)
+}
+
+func TestLink_RejectsUnknownEncodings(t *testing.T) {
+	for _, value := range []string{
+		"https://example.com",
+		"v2|42|1||https://example.com",
+		"v1|42|1|https://example.com",
+	} {
+		_, err := DecodeLink("abc123", value)
+		assert.ErrorIs(t, err, ErrUnsupportedEncoding, value)
+	}
+
+	_, err := DecodeLink("abc123", "v1|x|1||https://example.com")
+	assert.Error(t, err)
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	lru := NewLRU[string](2)
+
+	lru.Set("a", "1", time.Minute)
+	lru.Set("b", "2", time.Minute)
+	_, _ = lru.Get("a")
+	lru.Set("c", "3", time.Minute)
+
+	_, found := lru.Get("b")
+	assert.False(t, found)
+
+	value, found := lru.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, "1", value)
+	assert.Equal(t, 2, lru.Len())
+}
+
+func TestLRU_ExpiresEntries(t *testing.T) {
+	now := time.Now()
+	lru := NewLRU[int](10)
+	lru.now = func() time.Time { return now }
+
+	lru.Set("short", 1, time.Second)
+	lru.Set("long", 2, time.Minute)
+
+	now = now.Add(2 * time.Second)
+
+	_, found := lru.Get("short")
+	assert.False(t, found)
+	value, found := lru.Get("long")
+	assert.True(t, found)
+	assert.Equal(t, 2, value)
+	assert.Equal(t, 1, lru.Len())
+}
+
+func TestLRU_DeleteAndPurge(t *testing.T) {
+	lru := NewLRU[int](10)
+	lru.Set("a", 1, time.Minute)
+	lru.Set("b", 2, time.Minute)
+
+	lru.Delete("a")
+	_, found := lru.Get("a")
+	assert.False(t, found)
+
+	lru.Purge()
+	assert.Equal(t, 0, lru.Len())
+}
+
+func TestLRU_DisabledWithZeroCapacity(t *testing.T) {
+	lru := NewLRU[int](0)
+	lru.Set("a", 1, time.Minute)
+
+	_, found := lru.Get("a")
+	assert.False(t, found)
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func envFrom(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func settingSource(cfg *Config, key string) string {
+	for _, setting := range cfg.Settings() {
+		if setting.Key == key {
+			return setting.Source
+		}
+	}
+	return ""
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+port: 9000
+log:
+  level: debug
+kafka:
+  brokers: [kafka-1:9092, kafka-2:9092]
+  retry_delay: 2s
+pregen:
+  min_pool_size: 200
+`)
+
+	cfg, err := load(Options{
+		File:      file,
+		Overrides: map[string]string{"log.level": "warn"},
+	}, envFrom(map[string]string{
+		"PORT":                    "9100",
+		"KAFKA_CONSUMER_GROUP_ID": "workers",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, "9100", cfg.Port)
+	assert.Equal(t, "warn", cfg.Log.Level)
+	assert.Equal(t, []string{"kafka-1:9092", "kafka-2:9092"}, cfg.Kafka.Brokers)
+	assert.Equal(t, 2*time.Second, cfg.Kafka.RetryDelay)
+	assert.Equal(t, "workers", cfg.Kafka.ConsumerGroupID)
+	assert.Equal(t, 200, cfg.PreGen.MinPoolSize)
+	assert.Equal(t, 1000, cfg.PreGen.MaxPoolSize)
+
+	assert.Equal(t, SourceEnv, settingSource(cfg, "PORT"))
+	assert.Equal(t, SourceFlag, settingSource(cfg, "LOG_LEVEL"))
+	assert.Equal(t, SourceFile, settingSource(cfg, "KAFKA_BROKERS"))
+	assert.Equal(t, SourceDefault, settingSource(cfg, "BASE_URL"))
+}
+
+func TestLoad_TOMLFile(t *testing.T) {
+	file := writeFile(t, "config.toml", `
+base_url = "https://sho.rt"
+
+[inventory]
+reservation_timeout = "30m"
+
+[rate_limit]
+shorten = "10/1s"
+
+[rate_limit.api_keys]
+partner = "1000/1m"
+`)
+
+	cfg, err := load(Options{File: file}, envFrom(nil))
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://sho.rt", cfg.BaseURL)
+	assert.Equal(t, 30*time.Minute, cfg.Inventory.ReservationTimeout)
+	assert.Equal(t, RateLimitPolicy{Name: "shorten", Limit: 10, Window: time.Second}, cfg.RateLimit.Shorten)
+	assert.Equal(t, RateLimitPolicy{Name: "key", Limit: 1000, Window: time.Minute}, cfg.RateLimit.APIKeys["partner"])
+}
+
+func TestLoad_LegacyPoolKeys(t *testing.T) {
+	cfg, err := load(Options{}, envFrom(map[string]string{
+		"INVENTORY_MIN_POOL_SIZE": "10",
+		"INVENTORY_MAX_POOL_SIZE": "20",
+		"PREGEN_MAX_POOL_SIZE":    "30",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, 10, cfg.PreGen.MinPoolSize)
+	assert.Equal(t, 30, cfg.PreGen.MaxPoolSize)
+}
+
+func TestLoad_RejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		expected []string
+	}{
+		{
+			name:     "unparsable values",
+			env:      map[string]string{"KAFKA_RETRY_ATTEMPTS": "three", "HEALTH_CHECK_TIMEOUT": "5"},
+			expected: []string{"KAFKA_RETRY_ATTEMPTS", "HEALTH_CHECK_TIMEOUT"},
+		},
+		{
+			name:     "malformed rate limit policy",
+			env:      map[string]string{"RATE_LIMIT_SHORTEN": "100"},
+			expected: []string{"RATE_LIMIT_SHORTEN"},
+		},
+		{
+			name:     "unknown file key",
+			file:     "kafka:\n  brokerz: [kafka:9092]\n",
+			expected: []string{"unknown setting KAFKA_BROKERZ"},
+		},
+		{
+			name:     "inconsistent pool sizes",
+			env:      map[string]string{"PREGEN_MIN_POOL_SIZE": "500", "PREGEN_MAX_POOL_SIZE": "100"},
+			expected: []string{"PREGEN_MAX_POOL_SIZE (100) must not be lower than PREGEN_MIN_POOL_SIZE (500)"},
+		},
+		{
+			name:     "hold limit below reservation timeout",
+			env:      map[string]string{"INVENTORY_RESERVATION_TIMEOUT": "30m", "INVENTORY_MAX_HOLD": "20m"},
+			expected: []string{"INVENTORY_MAX_HOLD (20m0s) must not be lower than INVENTORY_RESERVATION_TIMEOUT (30m0s)"},
+		},
+		{
+			name:     "handler backoff",
+			env:      map[string]string{"KAFKA_HANDLER_RETRIES": "-1", "KAFKA_HANDLER_BACKOFF": "2s", "KAFKA_HANDLER_MAX_BACKOFF": "1s"},
+			expected: []string{"KAFKA_HANDLER_RETRIES must not be negative, got -1", "KAFKA_HANDLER_MAX_BACKOFF (1s) must not be lower than KAFKA_HANDLER_BACKOFF (2s)"},
+		},
+		{
+			name:     "any origin with credentials",
+			env:      map[string]string{"INVENTORY_CORS_ALLOWED_ORIGINS": "*"},
+			expected: []string{"INVENTORY_CORS_ALLOWED_ORIGINS cannot contain * while INVENTORY_CORS_ALLOW_CREDENTIALS is true"},
+		},
+		{
+			name:     "short admin token",
+			env:      map[string]string{"INVENTORY_ADMIN_TOKEN": "secret"},
+			expected: []string{"INVENTORY_ADMIN_TOKEN must be at least 16 characters, got 6"},
+		},
+		{
+			name:     "unsupported values",
+			env:      map[string]string{"LOG_LEVEL": "verbose", "PORT": "http", "TRACING_EXPORTER": "otlp"},
+			expected: []string{"LOG_LEVEL", "PORT", "TRACING_OTLP_ENDPOINT is required"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{}
+			if tt.file != "" {
+				opts.File = writeFile(t, "config.yml", tt.file)
+			}
+
+			_, err := load(opts, envFrom(tt.env))
+			require.Error(t, err)
+			for _, expected := range tt.expected {
+				assert.Contains(t, err.Error(), expected)
+			}
+		})
+	}
+}
+
+func TestSettings_RedactsSecrets(t *testing.T) {
+	cfg, err := load(Options{}, envFrom(map[string]string{
+		"DATABASE_URL":          "postgres://app:s3cret@db:5432/urls",
+		"REDIS_URL":             "redis://:hunter2@redis:6379/0",
+		"RATE_LIMIT_API_KEYS":   "partner-key=1000/1m",
+		"INVENTORY_ADMIN_TOKEN": "admin-token-0123456789",
+	}))
+	require.NoError(t, err)
+
+	values := make(map[string]string)
+	for _, setting := range cfg.Settings() {
+		values[setting.Key] = setting.Value
+		assert.NotContains(t, setting.Value, "s3cret")
+		assert.NotContains(t, setting.Value, "hunter2")
+		assert.NotContains(t, setting.Value, "partner-key")
+		assert.NotContains(t, setting.Value, "admin-token")
+	}
+	assert.Equal(t, "postgres://app:xxxxx@db:5432/urls", values["DATABASE_URL"])
+	assert.Equal(t, "xxxxx=1000/1m", values["RATE_LIMIT_API_KEYS"])
+}
+
+func TestDefaults(t *testing.T) {
+	cfg := Defaults()
+
+	assert.Equal(t, 15*time.Minute, cfg.Inventory.ReservationTimeout)
+	assert.Equal(t, 100, cfg.PreGen.MinPoolSize)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestWatcher_Reload(t *testing.T) {
+	file := writeFile(t, "config.yaml", "log:\n  level: info\nrate_limit:\n  shorten: 100/1m\n")
+	opts := Options{File: file}
+	cfg, err := Load(opts)
+	require.NoError(t, err)
+
+	watcher := NewWatcher(cfg, opts)
+	var applied []Runtime
+	watcher.Subscribe("test", func(runtime Runtime) {
+		applied = append(applied, runtime)
+	})
+
+	// Runtime settings are applied to subscribers
+	require.NoError(t, os.WriteFile(file, []byte("log:\n  level: debug\nrate_limit:\n  shorten: 5/1s\n"), 0o600))
+	require.NoError(t, watcher.Reload("test"))
+	require.Len(t, applied, 1)
+	assert.Equal(t, "debug", applied[0].LogLevel)
+	assert.Equal(t, RateLimitPolicy{Name: "shorten", Limit: 5, Window: time.Second}, applied[0].RateLimit.Shorten)
+	assert.Equal(t, "debug", watcher.Current().LogLevel)
+
+	// Invalid files are rejected and keep the current values
+	require.NoError(t, os.WriteFile(file, []byte("log:\n  level: loud\n"), 0o600))
+	assert.Error(t, watcher.Reload("test"))
+	assert.Len(t, applied, 1)
+	assert.Equal(t, "debug", watcher.Current().LogLevel)
+
+	// Settings that need a restart do not notify subscribers
+	require.NoError(t, os.WriteFile(file, []byte("log:\n  level: debug\nrate_limit:\n  shorten: 5/1s\nport: 9999\n"), 0o600))
+	require.NoError(t, watcher.Reload("test"))
+	assert.Len(t, applied, 1)
+}
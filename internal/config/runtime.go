@@ -0,0 +1,207 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"url-shortener/internal/metrics"
+)
+
+// Runtime is the subset of the configuration that can change without a restart
+type Runtime struct {
+	LogLevel             string
+	RateLimit            RateLimitConfig
+	CORSOrigins          []string
+	InventoryCORSOrigins []string
+	PreGen               PreGenConfig
+	ReservationTimeout   time.Duration
+}
+
+// Runtime returns the reloadable part of the configuration
+func (c *Config) Runtime() Runtime {
+	return Runtime{
+		LogLevel:             c.Log.Level,
+		RateLimit:            c.RateLimit,
+		CORSOrigins:          c.CORS.AllowedOrigins,
+		InventoryCORSOrigins: c.InventoryCORS.AllowedOrigins,
+		PreGen:               c.PreGen,
+		ReservationTimeout:   c.Inventory.ReservationTimeout,
+	}
+}
+
+// reloadable reports whether changes to key are applied by a reload. Rate
+// limiter key prefixes are excluded because existing counters live under them.
+func reloadable(key string) bool {
+	switch key {
+	case "LOG_LEVEL", "CORS_ALLOWED_ORIGINS", "INVENTORY_CORS_ALLOWED_ORIGINS", "INVENTORY_RESERVATION_TIMEOUT":
+		return true
+	case "RATE_LIMIT_KEY_PREFIX":
+		return false
+	}
+	return strings.HasPrefix(key, "RATE_LIMIT_") || strings.HasPrefix(key, "PREGEN_")
+}
+
+// Watcher holds the current runtime configuration and passes every change to
+// subscribers. A reload loads and validates the full configuration from the
+// original sources first, so subscribers only ever see a complete, valid
+// snapshot and a rejected reload leaves everything untouched.
+type Watcher struct {
+	opts     Options
+	interval time.Duration
+
+	// mu serializes reloads so subscribers receive snapshots in order
+	mu          sync.Mutex
+	current     atomic.Pointer[Runtime]
+	settings    map[string]string
+	subscribers []subscriber
+}
+
+type subscriber struct {
+	name  string
+	apply func(Runtime)
+}
+
+// NewWatcher creates a watcher starting from cfg, which was loaded with opts
+func NewWatcher(cfg *Config, opts Options) *Watcher {
+	w := &Watcher{
+		opts:     opts,
+		interval: cfg.ConfigWatchInterval,
+		settings: settingValues(cfg),
+	}
+	runtime := cfg.Runtime()
+	w.current.Store(&runtime)
+	return w
+}
+
+// Current returns the latest runtime configuration
+func (w *Watcher) Current() Runtime {
+	return *w.current.Load()
+}
+
+// Subscribe registers apply to be called with the new runtime configuration
+// after every reload that changes it. Subscribers are called in registration
+// order and should swap their state in a single step.
+func (w *Watcher) Subscribe(name string, apply func(Runtime)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, subscriber{name: name, apply: apply})
+}
+
+// Reload loads the configuration again and applies runtime changes. trigger
+// describes what caused the reload and is recorded in the audit log.
+func (w *Watcher) Reload(trigger string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	cfg, err := Load(w.opts)
+	if err != nil {
+		metrics.ConfigReloads.WithLabelValues("rejected").Inc()
+		slog.Error("Configuration reload rejected", "trigger", trigger, "error", err)
+		return err
+	}
+
+	next := settingValues(cfg)
+	var applied, restartRequired []string
+	for key, value := range next {
+		previous := w.settings[key]
+		if previous == value {
+			continue
+		}
+		change := fmt.Sprintf("%s: %s -> %s", key, redact(key, previous), redact(key, value))
+		if reloadable(key) {
+			applied = append(applied, change)
+		} else {
+			restartRequired = append(restartRequired, change)
+		}
+	}
+
+	if len(restartRequired) > 0 {
+		slog.Warn("Configuration changes need a restart to take effect", "trigger", trigger, "changes", restartRequired)
+	}
+	if len(applied) == 0 {
+		metrics.ConfigReloads.WithLabelValues("unchanged").Inc()
+		slog.Info("Configuration reloaded without runtime changes", "trigger", trigger)
+		return nil
+	}
+
+	// Later reloads compare against what is actually applied, so settings
+	// needing a restart keep being reported until the process restarts
+	for key, value := range next {
+		if reloadable(key) {
+			w.settings[key] = value
+		}
+	}
+
+	runtime := cfg.Runtime()
+	w.current.Store(&runtime)
+	for _, sub := range w.subscribers {
+		sub.apply(runtime)
+	}
+
+	metrics.ConfigReloads.WithLabelValues("applied").Inc()
+	slog.Info("Configuration reloaded", "trigger", trigger, "changes", applied)
+	return nil
+}
+
+// Run reloads on SIGHUP and, when a config file is in use, whenever the file
+// changes, until ctx is done
+func (w *Watcher) Run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	// Poll the modification time rather than relying on inotify, which misses
+	// the symlink swaps Kubernetes uses to update mounted config maps
+	var poll <-chan time.Time
+	file := w.opts.File
+	if file == "" {
+		file = os.Getenv("CONFIG_FILE")
+	}
+	lastModified := modTime(file)
+	if file != "" && w.interval > 0 {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			w.Reload("sighup")
+		case <-poll:
+			if modified := modTime(file); !modified.Equal(lastModified) {
+				lastModified = modified
+				w.Reload("file change")
+			}
+		}
+	}
+}
+
+func modTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func settingValues(cfg *Config) map[string]string {
+	values := make(map[string]string, len(cfg.settings))
+	for _, setting := range cfg.settings {
+		values[setting.Key] = setting.Value
+	}
+	return values
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const redacted = "xxxxx"
+
+// Setting is the effective value of one configuration key and where it came from
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// Settings returns every setting sorted by key, with credentials redacted
+func (c *Config) Settings() []Setting {
+	settings := make([]Setting, len(c.settings))
+	for i, setting := range c.settings {
+		setting.Value = redact(setting.Key, setting.Value)
+		settings[i] = setting
+	}
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Key < settings[j].Key
+	})
+	return settings
+}
+
+// redact hides passwords in connection URLs, API key values and tokens
+func redact(key, value string) string {
+	switch key {
+	case "INVENTORY_ADMIN_TOKEN":
+		if value == "" {
+			return value
+		}
+		return redacted
+	case "DATABASE_URL", "REDIS_URL", "TRACING_OTLP_ENDPOINT":
+		return redactURL(value)
+	case "RATE_LIMIT_API_KEYS":
+		return redactAPIKeys(value)
+	default:
+		return value
+	}
+}
+
+func redactURL(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		// The URL may still contain a password, so hide all of it
+		return redacted
+	}
+	return parsed.Redacted()
+}
+
+// redactAPIKeys hides the keys of "key1=100/1m,key2=1000/1m" but keeps the policies
+func redactAPIKeys(value string) string {
+	entries := strings.Split(value, ",")
+	for i, entry := range entries {
+		if _, policy, found := strings.Cut(entry, "="); found {
+			entries[i] = redacted + "=" + policy
+		} else if strings.TrimSpace(entry) != "" {
+			entries[i] = redacted
+		}
+	}
+	return strings.Join(entries, ",")
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minAdminTokenLength keeps the admin token from being guessable
+const minAdminTokenLength = 16
+
+// Validate checks that settings are usable together, reporting every problem found
+func (c *Config) Validate() error {
+	var v validator
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		v.errorf("PORT must be a port number between 1 and 65535, got %q", c.Port)
+	}
+
+	v.url("DATABASE_URL", c.DatabaseURL, "postgres", "postgresql")
+	v.url("REDIS_URL", c.RedisURL, "redis", "rediss", "unix", "redis-sentinel", "rediss-sentinel", "redis-cluster", "rediss-cluster")
+	v.url("BASE_URL", c.BaseURL, "http", "https")
+	v.positive("DB_MAX_OPEN_CONNS", c.DBMaxOpenConns)
+	if c.DBMaxIdleConns < 0 || c.DBMaxIdleConns > c.DBMaxOpenConns {
+		v.errorf("DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS (%d), got %d", c.DBMaxOpenConns, c.DBMaxIdleConns)
+	}
+
+	v.positiveDuration("REDIS_OPERATION_TIMEOUT", c.Redis.OperationTimeout)
+	v.positive("REDIS_BREAKER_FAILURES", c.Redis.BreakerFailures)
+	v.positiveDuration("REDIS_BREAKER_COOLDOWN", c.Redis.BreakerCooldown)
+
+	if c.Cache.LocalSize < 0 {
+		v.errorf("CACHE_LOCAL_SIZE must not be negative, got %d", c.Cache.LocalSize)
+	}
+	v.positiveDuration("CACHE_LOCAL_TTL", c.Cache.LocalTTL)
+	v.nonNegativeDuration("CACHE_NEGATIVE_TTL", c.Cache.NegativeTTL)
+	v.positiveDuration("CACHE_REDIS_TTL", c.Cache.RedisTTL)
+	if c.Cache.InvalidationChannel == "" {
+		v.errorf("CACHE_INVALIDATION_CHANNEL must not be empty")
+	}
+	if c.Cache.WarmTopN < 0 {
+		v.errorf("CACHE_WARM_TOP_N must not be negative, got %d", c.Cache.WarmTopN)
+	}
+
+	v.positiveDuration("URL_SHORTEN_TIMEOUT", c.URLTimeouts.Shorten)
+	v.positiveDuration("URL_REDIRECT_TIMEOUT", c.URLTimeouts.Redirect)
+	v.positiveDuration("URL_ANALYTICS_TIMEOUT", c.URLTimeouts.Analytics)
+
+	v.oneOf("LOG_LEVEL", strings.ToLower(c.Log.Level), "debug", "info", "warn", "error")
+	v.oneOf("LOG_FORMAT", strings.ToLower(c.Log.Format), "json", "text")
+
+	v.oneOf("TRACING_EXPORTER", c.Tracing.Exporter, "none", "stdout", "file", "otlp")
+	if c.Tracing.Exporter == "file" && c.Tracing.FilePath == "" {
+		v.errorf("TRACING_FILE_PATH is required when TRACING_EXPORTER is file")
+	}
+	if c.Tracing.Exporter == "otlp" {
+		if c.Tracing.OTLPEndpoint == "" {
+			v.errorf("TRACING_OTLP_ENDPOINT is required when TRACING_EXPORTER is otlp")
+		} else {
+			v.url("TRACING_OTLP_ENDPOINT", c.Tracing.OTLPEndpoint, "http", "https")
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		v.errorf("TRACING_SAMPLE_RATIO must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+
+	v.positiveDuration("HEALTH_CHECK_TIMEOUT", c.HealthCheckTimeout)
+	v.nonNegativeDuration("SHUTDOWN_READINESS_DELAY", c.Shutdown.ReadinessDelay)
+	v.positiveDuration("SHUTDOWN_DRAIN_TIMEOUT", c.Shutdown.DrainTimeout)
+	v.positiveDuration("SHUTDOWN_FLUSH_TIMEOUT", c.Shutdown.FlushTimeout)
+
+	if len(c.Kafka.Brokers) == 0 {
+		v.errorf("KAFKA_BROKERS must list at least one broker")
+	}
+	for _, broker := range c.Kafka.Brokers {
+		if _, port, err := net.SplitHostPort(broker); err != nil || port == "" {
+			v.errorf("KAFKA_BROKERS entry %q must be host:port", broker)
+		}
+	}
+	if c.Kafka.ConsumerGroupID == "" {
+		v.errorf("KAFKA_CONSUMER_GROUP_ID must not be empty")
+	}
+	v.positiveDuration("KAFKA_SESSION_TIMEOUT", c.Kafka.SessionTimeout)
+	v.positiveDuration("KAFKA_HEARTBEAT_INTERVAL", c.Kafka.HeartbeatInterval)
+	if c.Kafka.HeartbeatInterval >= c.Kafka.SessionTimeout {
+		v.errorf("KAFKA_HEARTBEAT_INTERVAL (%s) must be lower than KAFKA_SESSION_TIMEOUT (%s)", c.Kafka.HeartbeatInterval, c.Kafka.SessionTimeout)
+	}
+	if c.Kafka.RetryAttempts < 0 {
+		v.errorf("KAFKA_RETRY_ATTEMPTS must not be negative, got %d", c.Kafka.RetryAttempts)
+	}
+	v.nonNegativeDuration("KAFKA_RETRY_DELAY", c.Kafka.RetryDelay)
+	if c.Kafka.HandlerRetries < 0 {
+		v.errorf("KAFKA_HANDLER_RETRIES must not be negative, got %d", c.Kafka.HandlerRetries)
+	}
+	v.positiveDuration("KAFKA_HANDLER_BACKOFF", c.Kafka.HandlerBackoff)
+	if c.Kafka.HandlerMaxBackoff < c.Kafka.HandlerBackoff {
+		v.errorf("KAFKA_HANDLER_MAX_BACKOFF (%s) must not be lower than KAFKA_HANDLER_BACKOFF (%s)", c.Kafka.HandlerMaxBackoff, c.Kafka.HandlerBackoff)
+	}
+
+	v.positiveDuration("INVENTORY_RESERVATION_TIMEOUT", c.Inventory.ReservationTimeout)
+	v.positiveDuration("INVENTORY_CLEANUP_INTERVAL", c.Inventory.CleanupInterval)
+	v.positiveDuration("INVENTORY_REPLY_TIMEOUT", c.Inventory.ReplyTimeout)
+	if c.Inventory.MaxExtensions < 0 {
+		v.errorf("INVENTORY_MAX_EXTENSIONS must not be negative, got %d", c.Inventory.MaxExtensions)
+	}
+	if c.Inventory.MaxHold < c.Inventory.ReservationTimeout {
+		v.errorf("INVENTORY_MAX_HOLD (%s) must not be lower than INVENTORY_RESERVATION_TIMEOUT (%s)", c.Inventory.MaxHold, c.Inventory.ReservationTimeout)
+	}
+	v.positiveDuration("INVENTORY_OUTBOX_INTERVAL", c.Inventory.OutboxInterval)
+	v.positive("INVENTORY_OUTBOX_BATCH_SIZE", c.Inventory.OutboxBatchSize)
+	v.positiveDuration("INVENTORY_OUTBOX_RETENTION", c.Inventory.OutboxRetention)
+	if token := c.Inventory.AdminToken; token != "" && len(token) < minAdminTokenLength {
+		v.errorf("INVENTORY_ADMIN_TOKEN must be at least %d characters, got %d", minAdminTokenLength, len(token))
+	}
+
+	v.positive("PREGEN_MIN_POOL_SIZE", c.PreGen.MinPoolSize)
+	v.positive("PREGEN_BATCH_SIZE", c.PreGen.BatchSize)
+	if c.PreGen.MaxPoolSize < c.PreGen.MinPoolSize {
+		v.errorf("PREGEN_MAX_POOL_SIZE (%d) must not be lower than PREGEN_MIN_POOL_SIZE (%d)", c.PreGen.MaxPoolSize, c.PreGen.MinPoolSize)
+	}
+	v.positiveDuration("PREGEN_CHECK_INTERVAL", c.PreGen.CheckInterval)
+
+	if c.RateLimit.Enabled && c.RateLimit.APIKeyHeader == "" {
+		v.errorf("RATE_LIMIT_API_KEY_HEADER must not be empty when rate limiting is enabled")
+	}
+
+	v.cors("CORS", c.CORS)
+	v.cors("INVENTORY_CORS", c.InventoryCORS)
+	v.nonNegativeDuration("CONFIG_WATCH_INTERVAL", c.ConfigWatchInterval)
+
+	return errors.Join(v.errs...)
+}
+
+type validator struct {
+	errs []error
+}
+
+func (v *validator) errorf(format string, args ...interface{}) {
+	v.errs = append(v.errs, fmt.Errorf(format, args...))
+}
+
+func (v *validator) positive(key string, value int) {
+	if value <= 0 {
+		v.errorf("%s must be positive, got %d", key, value)
+	}
+}
+
+func (v *validator) positiveDuration(key string, value time.Duration) {
+	if value <= 0 {
+		v.errorf("%s must be a positive duration, got %s", key, value)
+	}
+}
+
+func (v *validator) nonNegativeDuration(key string, value time.Duration) {
+	if value < 0 {
+		v.errorf("%s must not be negative, got %s", key, value)
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, option := range allowed {
+		if value == option {
+			return
+		}
+	}
+	v.errorf("%s must be one of %s, got %q", key, strings.Join(allowed, ", "), value)
+}
+
+// url checks that value is a URL with one of the given schemes. Errors never
+// include the value itself, which may hold credentials.
+func (v *validator) url(key, value string, schemes ...string) {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		v.errorf("%s is not a valid URL", key)
+		return
+	}
+	for _, scheme := range schemes {
+		if parsed.Scheme == scheme {
+			if parsed.Host == "" && scheme != "unix" {
+				v.errorf("%s has no host", key)
+			}
+			return
+		}
+	}
+	v.errorf("%s must use one of the schemes %s, got %q", key, strings.Join(schemes, ", "), parsed.Scheme)
+}
+
+func (v *validator) cors(prefix string, cfg CORSConfig) {
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			if cfg.AllowCredentials {
+				v.errorf("%s_ALLOWED_ORIGINS cannot contain * while %s_ALLOW_CREDENTIALS is true", prefix, prefix)
+			}
+			continue
+		}
+		parsed, err := url.Parse(strings.Replace(origin, "://*.", "://", 1))
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || strings.Trim(parsed.Path, "/") != "" {
+			v.errorf("%s_ALLOWED_ORIGINS entry %q must be *, scheme://host[:port] or scheme://*.domain", prefix, origin)
+		}
+	}
+	if len(cfg.AllowedMethods) == 0 {
+		v.errorf("%s_ALLOWED_METHODS must list at least one method", prefix)
+	}
+	v.nonNegativeDuration(prefix+"_MAX_AGE", cfg.MaxAge)
+}
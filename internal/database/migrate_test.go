@@ -0,0 +1,45 @@
+package database
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"url-shortener/migrations"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_add_index.up.sql":      {Data: []byte("CREATE INDEX idx ON t(c);")},
+		"002_add_index.down.sql":    {Data: []byte("DROP INDEX idx;")},
+		"001_create_table.up.sql":   {Data: []byte("CREATE TABLE t (c INT);")},
+		"001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+		"migrations.go":             {Data: []byte("package migrations")},
+	}
+
+	loaded, err := loadMigrations(fsys)
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+	assert.Equal(t, 1, loaded[0].Version)
+	assert.Equal(t, "create_table", loaded[0].Name)
+	assert.Equal(t, "DROP TABLE t;", loaded[0].Down)
+	assert.Equal(t, 2, loaded[1].Version)
+
+	_, err = loadMigrations(fstest.MapFS{
+		"001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+	})
+	assert.Error(t, err)
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	loaded, err := loadMigrations(migrations.FS)
+	require.NoError(t, err)
+	require.NotEmpty(t, loaded)
+
+	for i, migration := range loaded {
+		assert.Equal(t, i+1, migration.Version, "migration versions must be contiguous")
+		assert.NotEmpty(t, migration.Down, "migration %d_%s has no down script", migration.Version, migration.Name)
+	}
+}
@@ -0,0 +1,302 @@
+package database
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/tracing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrRedisUnavailable is returned without contacting Redis while the circuit
+// breaker is open
+var ErrRedisUnavailable = errors.New("redis unavailable: circuit open")
+
+// InitializeRedis creates a Redis client for a redis://, rediss:// or unix://
+// URL, a Sentinel-managed master (redis-sentinel://[:password@]host:port,.../db?master=name)
+// or a cluster (redis-cluster://[:password@]host:port,...). Every call is
+// bounded by the operation timeout and guarded by the returned breaker. An
+// unreachable Redis is not fatal: the client starts with the circuit open and
+// callers serve in degraded mode until a probe succeeds.
+func InitializeRedis(redisURL string, cfg config.RedisConfig) (redis.UniversalClient, *RedisBreaker, error) {
+	client, err := newRedisClient(redisURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+
+	breaker := NewRedisBreaker(cfg)
+	client.AddHook(breaker)
+	client.AddHook(tracing.NewRedisHook())
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		breaker.trip()
+		slog.Warn("Redis unavailable, starting in degraded mode", "error", err)
+		return client, breaker, nil
+	}
+
+	slog.Info("Redis connection established")
+	return client, breaker, nil
+}
+
+func newRedisClient(redisURL string) (redis.UniversalClient, error) {
+	parsed, err := url.Parse(redisURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	switch parsed.Scheme {
+	case "redis", "rediss", "unix":
+		opt, err := redis.ParseURL(redisURL)
+		if err != nil {
+			return nil, err
+		}
+		return redis.NewClient(opt), nil
+	case "rediss-sentinel", "rediss-cluster":
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	case "redis-sentinel", "redis-cluster":
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", parsed.Scheme)
+	}
+
+	addrs := strings.Split(parsed.Host, ",")
+	for _, addr := range addrs {
+		if addr == "" {
+			return nil, fmt.Errorf("empty host in %s URL", parsed.Scheme)
+		}
+	}
+	username := parsed.User.Username()
+	password, _ := parsed.User.Password()
+
+	if strings.HasSuffix(parsed.Scheme, "-cluster") {
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     addrs,
+			Username:  username,
+			Password:  password,
+			TLSConfig: tlsConfig,
+		}), nil
+	}
+
+	master := parsed.Query().Get("master")
+	if master == "" {
+		return nil, fmt.Errorf("sentinel URL needs a master query parameter")
+	}
+	db := 0
+	if path := strings.Trim(parsed.Path, "/"); path != "" {
+		if db, err = strconv.Atoi(path); err != nil {
+			return nil, fmt.Errorf("invalid database number %q", path)
+		}
+	}
+	return redis.NewFailoverClient(&redis.FailoverOptions{
+		MasterName:       master,
+		SentinelAddrs:    addrs,
+		SentinelPassword: parsed.Query().Get("sentinel_password"),
+		Username:         username,
+		Password:         password,
+		DB:               db,
+		TLSConfig:        tlsConfig,
+	}), nil
+}
+
+// Circuit breaker states, as reported by the redis_circuit_state metric
+const (
+	CircuitClosed   = "closed"
+	CircuitHalfOpen = "half_open"
+	CircuitOpen     = "open"
+)
+
+var circuitStateValues = map[string]float64{CircuitClosed: 0, CircuitHalfOpen: 1, CircuitOpen: 2}
+
+// RedisBreaker is a redis.Hook that bounds every command by a deadline and
+// fails fast after consecutive connection failures. After the cooldown one
+// command is let through as a probe; its outcome closes or reopens the circuit.
+// Replies from Redis itself, including redis.Nil, count as successes.
+type RedisBreaker struct {
+	timeout  time.Duration
+	failures int
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu          sync.Mutex
+	state       string
+	consecutive int
+	openedAt    time.Time
+	probing     bool
+}
+
+var _ redis.Hook = (*RedisBreaker)(nil)
+
+// NewRedisBreaker creates a closed breaker
+func NewRedisBreaker(cfg config.RedisConfig) *RedisBreaker {
+	b := &RedisBreaker{
+		timeout:  cfg.OperationTimeout,
+		failures: cfg.BreakerFailures,
+		cooldown: cfg.BreakerCooldown,
+		now:      time.Now,
+		state:    CircuitClosed,
+	}
+	metrics.RedisCircuitState.Set(circuitStateValues[CircuitClosed])
+	return b
+}
+
+// State returns the current circuit state
+func (b *RedisBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Healthy reports whether commands are currently sent to Redis normally
+func (b *RedisBreaker) Healthy() bool {
+	return b.State() == CircuitClosed
+}
+
+type cancelKey struct{}
+
+// BeforeProcess implements redis.Hook
+func (b *RedisBreaker) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return b.before(ctx)
+}
+
+// AfterProcess implements redis.Hook
+func (b *RedisBreaker) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	b.after(ctx, cmd.Err())
+	return nil
+}
+
+// BeforeProcessPipeline implements redis.Hook
+func (b *RedisBreaker) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return b.before(ctx)
+}
+
+// AfterProcessPipeline implements redis.Hook
+func (b *RedisBreaker) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if err = cmd.Err(); err != nil && !isRedisReply(err) {
+			break
+		}
+	}
+	b.after(ctx, err)
+	return nil
+}
+
+func (b *RedisBreaker) before(ctx context.Context) (context.Context, error) {
+	if !b.allow() {
+		metrics.RedisRejectedCommands.Inc()
+		return ctx, ErrRedisUnavailable
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	return context.WithValue(ctx, cancelKey{}, cancel), nil
+}
+
+func (b *RedisBreaker) after(ctx context.Context, err error) {
+	cancel, ok := ctx.Value(cancelKey{}).(context.CancelFunc)
+	if !ok {
+		// Rejected by allow, nothing was sent
+		return
+	}
+	cancel()
+
+	switch {
+	case err == nil || isRedisReply(err):
+		b.success()
+	case errors.Is(err, context.Canceled):
+		// The caller gave up, which says nothing about Redis
+		b.release()
+	default:
+		b.failure()
+	}
+}
+
+// isRedisReply reports whether err came from Redis, which proves it reachable
+func isRedisReply(err error) bool {
+	var reply redis.Error
+	return errors.As(err, &reply)
+}
+
+func (b *RedisBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.transition(CircuitHalfOpen)
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		// Only the probe is in flight until it completes
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *RedisBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutive = 0
+	b.probing = false
+	if b.state != CircuitClosed {
+		b.transition(CircuitClosed)
+		slog.Info("Redis recovered, leaving degraded mode")
+	}
+}
+
+func (b *RedisBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutive++
+	b.probing = false
+	if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.consecutive >= b.failures) {
+		b.open()
+	}
+}
+
+func (b *RedisBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// trip opens the circuit immediately
+func (b *RedisBreaker) trip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.open()
+}
+
+func (b *RedisBreaker) open() {
+	b.openedAt = b.now()
+	if b.state != CircuitOpen {
+		b.transition(CircuitOpen)
+		slog.Warn("Redis circuit opened, serving in degraded mode", "cooldown", b.cooldown)
+	}
+}
+
+func (b *RedisBreaker) transition(state string) {
+	b.state = state
+	metrics.RedisCircuitState.Set(circuitStateValues[state])
+	metrics.RedisCircuitTransitions.WithLabelValues(state).Inc()
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"url-shortener/internal/config"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func call(t *testing.T, b *RedisBreaker, err error) error {
+	ctx, rejected := b.before(context.Background())
+	if rejected == nil {
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline)
+	} else {
+		err = rejected
+	}
+	b.after(ctx, err)
+	return rejected
+}
+
+func TestRedisBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewRedisBreaker(config.RedisConfig{OperationTimeout: time.Second, BreakerFailures: 3, BreakerCooldown: 10 * time.Second})
+	b.now = func() time.Time { return now }
+	failure := errors.New("dial tcp: connection refused")
+
+	// Replies from Redis, cancellations and isolated failures keep it closed
+	require.NoError(t, call(t, b, redis.Nil))
+	require.NoError(t, call(t, b, failure))
+	require.NoError(t, call(t, b, failure))
+	require.NoError(t, call(t, b, context.Canceled))
+	require.NoError(t, call(t, b, nil))
+	require.NoError(t, call(t, b, failure))
+	assert.Equal(t, CircuitClosed, b.State())
+
+	// Consecutive failures open it and commands fail fast
+	require.NoError(t, call(t, b, failure))
+	require.NoError(t, call(t, b, context.DeadlineExceeded))
+	assert.Equal(t, CircuitOpen, b.State())
+	assert.ErrorIs(t, call(t, b, nil), ErrRedisUnavailable)
+
+	// After the cooldown a failed probe reopens it
+	now = now.Add(10 * time.Second)
+	ctx, err := b.before(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, CircuitHalfOpen, b.State())
+	assert.ErrorIs(t, call(t, b, nil), ErrRedisUnavailable, "only one probe at a time")
+	b.after(ctx, failure)
+	assert.Equal(t, CircuitOpen, b.State())
+
+	// A successful probe closes it
+	now = now.Add(10 * time.Second)
+	require.NoError(t, call(t, b, nil))
+	assert.True(t, b.Healthy())
+}
+
+func TestNewRedisClient(t *testing.T) {
+	client, err := newRedisClient("redis://localhost:6379/0")
+	require.NoError(t, err)
+	assert.IsType(t, &redis.Client{}, client)
+
+	client, err = newRedisClient("redis-cluster://:secret@node-1:6379,node-2:6379")
+	require.NoError(t, err)
+	assert.IsType(t, &redis.ClusterClient{}, client)
+
+	client, err = newRedisClient("redis-sentinel://sentinel-1:26379,sentinel-2:26379/2?master=mymaster")
+	require.NoError(t, err)
+	assert.IsType(t, &redis.Client{}, client)
+
+	for _, invalid := range []string{
+		"redis-sentinel://sentinel-1:26379",
+		"redis-sentinel://sentinel-1:26379/x?master=mymaster",
+		"redis-cluster://node-1:6379,,node-2:6379",
+		"memcached://localhost:11211",
+	} {
+		_, err := newRedisClient(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"url-shortener/internal/models"
 	"url-shortener/internal/service"
@@ -11,11 +13,13 @@ import (
 
 type AnalyticsHandler struct {
 	urlService service.URLService
+	timeout    time.Duration
 }
 
-func NewAnalyticsHandler(urlService service.URLService) *AnalyticsHandler {
+func NewAnalyticsHandler(urlService service.URLService, timeout time.Duration) *AnalyticsHandler {
 	return &AnalyticsHandler{
 		urlService: urlService,
+		timeout:    timeout,
 	}
 }
 
@@ -29,8 +33,14 @@ func (h *AnalyticsHandler) GetAnalytics(c *gin.Context) {
 		return
 	}
 
-	analytics, err := h.urlService.GetAnalytics(shortCode)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+
+	analytics, err := h.urlService.GetAnalytics(ctx, shortCode)
 	if err != nil {
+		if respondDependencyError(c, ctx, err) {
+			return
+		}
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error:   "Analytics not found",
 			Message: err.Error(),
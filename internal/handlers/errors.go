@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"url-shortener/internal/database"
+	"url-shortener/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondDependencyError answers with 504 Gateway Timeout when the operation
+// ran out of time and 503 Service Unavailable when a dependency could not be
+// reached or the request was abandoned. It reports whether err was one of
+// those; other errors are left to the caller. Errors naming hosts and
+// addresses are logged rather than sent to clients.
+func respondDependencyError(c *gin.Context, ctx context.Context, err error) bool {
+	status, ok := dependencyStatus(ctx, err)
+	if !ok {
+		return false
+	}
+
+	slog.WarnContext(ctx, "Dependency failed", "method", c.Request.Method, "path", c.FullPath(), "status", status, "error", err)
+
+	response := models.ErrorResponse{Error: "Service unavailable", Message: "A service this request depends on is unavailable, try again later"}
+	if status == http.StatusGatewayTimeout {
+		response.Error = "Request timed out"
+		response.Message = "A service this request depends on did not respond in time"
+	}
+	c.JSON(status, response)
+	return true
+}
+
+// respondInternalError answers with a dependency status when
+// respondDependencyError recognises err and with 500 Internal Server Error
+// otherwise. The error is logged rather than sent to clients, since it may
+// carry SQL and driver details.
+func respondInternalError(c *gin.Context, ctx context.Context, message string, err error) {
+	if respondDependencyError(c, ctx, err) {
+		return
+	}
+
+	slog.ErrorContext(ctx, message, "method", c.Request.Method, "path", c.FullPath(), "error", err)
+
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		Error:   message,
+		Message: "An internal error occurred, try again later",
+	})
+}
+
+func dependencyStatus(ctx context.Context, err error) (int, bool) {
+	// The driver may report an expired deadline in its own words
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return http.StatusGatewayTimeout, true
+	case context.Canceled:
+		return http.StatusServiceUnavailable, true
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, true
+	case errors.Is(err, context.Canceled),
+		errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, sql.ErrConnDone),
+		errors.Is(err, database.ErrRedisUnavailable):
+		return http.StatusServiceUnavailable, true
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return http.StatusGatewayTimeout, true
+		}
+		return http.StatusServiceUnavailable, true
+	}
+	return 0, false
+}
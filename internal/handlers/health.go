@@ -2,16 +2,54 @@ package handlers
 
 import (
 	"net/http"
+	"sync/atomic"
+
+	"url-shortener/internal/health"
 
 	"github.com/gin-gonic/gin"
 )
 
-// HealthCheck handles GET /api/v1/health
-func HealthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":    "healthy",
-		"timestamp": gin.H{},
-		"service":   "url-shortener",
-		"version":   "1.0.0",
-	})
+// HealthHandler serves liveness and readiness probes
+type HealthHandler struct {
+	checker      *health.Checker
+	shuttingDown atomic.Bool
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{
+		checker: checker,
+	}
+}
+
+// Liveness handles GET /healthz. It only reports that the process is serving
+// requests; dependencies are deliberately not checked so an outage of a
+// shared backend does not restart every replica.
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, health.NewReport(health.StatusUp))
+}
+
+// Readiness handles GET /readyz. It checks every dependency and returns 503
+// when any of them is down so the replica is taken out of load balancing.
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	if h.shuttingDown.Load() {
+		report := health.NewReport(health.StatusDown)
+		report.ShuttingDown = true
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+
+	report := h.checker.Run(c.Request.Context())
+
+	status := http.StatusOK
+	if report.Status == health.StatusDown {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// StartShutdown makes readiness fail from now on while liveness keeps
+// succeeding, so the replica is drained without being restarted
+func (h *HealthHandler) StartShutdown() {
+	h.shuttingDown.Store(true)
 }
@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 
 	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
 	"url-shortener/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -23,13 +27,11 @@ func NewInventoryHandler(inventoryService service.InventoryService) *InventoryHa
 	}
 }
 
-// CheckAvailability handles GET /api/v1/inventory/:productId/availability
+// CheckAvailability handles GET /api/v1/inventory/:productId/availability.
+// The optional region query parameter limits it to that region's locations.
 func (h *InventoryHandler) CheckAvailability(c *gin.Context) {
-	productID := c.Param("productId")
-	if productID == "" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Product ID is required",
-		})
+	productID, ok := productParam(c)
+	if !ok {
 		return
 	}
 
@@ -49,21 +51,22 @@ func (h *InventoryHandler) CheckAvailability(c *gin.Context) {
 	req := &models.ProductAvailabilityRequest{
 		ProductID: productID,
 		Quantity:  quantity,
+		Region:    c.Query("region"),
 	}
 
 	response, err := h.inventoryService.CheckAvailability(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Failed to check availability",
-			Message: err.Error(),
-		})
+		respondProductLookupError(c, "Failed to check availability", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
-// ReserveInventory handles POST /api/v1/inventory/reserve
+// ReserveInventory handles POST /api/v1/inventory/reserve. It answers 201
+// once the stock is held, 409 when there is not enough of it and 202 with a
+// status URL when the outcome is not known yet. Requests retried with the
+// same Idempotency-Key header get the first request's reservation back.
 func (h *InventoryHandler) ReserveInventory(c *gin.Context) {
 	var req models.PurchaseRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -74,14 +77,125 @@ func (h *InventoryHandler) ReserveInventory(c *gin.Context) {
 		return
 	}
 
+	// Retries sent with the same key return the first request's reservation
+	req.IdempotencyKey = c.GetHeader("Idempotency-Key")
+	if len(req.IdempotencyKey) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request",
+			Message: fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength),
+		})
+		return
+	}
+
 	response, err := h.inventoryService.ReserveInventory(c.Request.Context(), &req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+	if errors.Is(err, service.ErrInvalidAllocation) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request",
+			Message: err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, service.ErrIdempotencyKeyReused) {
+		c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
 			Error:   "Failed to reserve inventory",
 			Message: err.Error(),
 		})
 		return
 	}
+	if err != nil {
+		respondInternalError(c, c.Request.Context(), "Failed to reserve inventory", err)
+		return
+	}
+	if response.Replayed {
+		c.Header("Idempotent-Replayed", "true")
+	}
+
+	switch {
+	case response.Status == models.PurchaseStatusReserved:
+		c.JSON(http.StatusCreated, response)
+	case response.Reason == models.ReservationRejectedProductNotFound:
+		c.JSON(http.StatusNotFound, response)
+	case response.Status == models.PurchaseStatusRejected:
+		c.JSON(http.StatusConflict, response)
+	default:
+		// Still being processed: the client polls the reservation
+		response.StatusURL = reservationURL(response.OrderID)
+		c.Header("Location", response.StatusURL)
+		c.JSON(http.StatusAccepted, response)
+	}
+}
+
+// maxIdempotencyKeyLength matches the idempotency_key column
+const maxIdempotencyKeyLength = 255
+
+// reservationURL is where the status of a reservation can be polled
+func reservationURL(orderID uuid.UUID) string {
+	return "/api/v1/inventory/reservations/" + orderID.String()
+}
+
+// ReserveBatch handles POST /api/v1/inventory/reserve-batch. Every item is
+// reserved or none is: it answers 201 once all of them are held, 409 with
+// the items that fell short and 202 with a status URL when the outcome is
+// not known yet.
+func (h *InventoryHandler) ReserveBatch(c *gin.Context) {
+	var req models.BatchPurchaseRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	response, err := h.inventoryService.ReserveBatch(c.Request.Context(), &req)
+	if errors.Is(err, service.ErrDuplicateBatchItem) || errors.Is(err, service.ErrInvalidAllocation) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request",
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, c.Request.Context(), "Failed to reserve inventory", err)
+		return
+	}
+
+	switch response.Status {
+	case models.PurchaseStatusReserved:
+		c.JSON(http.StatusCreated, response)
+	case models.PurchaseStatusRejected:
+		c.JSON(http.StatusConflict, response)
+	default:
+		response.StatusURL = batchURL(response.BatchID)
+		c.Header("Location", response.StatusURL)
+		c.JSON(http.StatusAccepted, response)
+	}
+}
+
+// batchURL is where the status of a batch reservation can be polled
+func batchURL(batchID uuid.UUID) string {
+	return "/api/v1/inventory/batches/" + batchID.String()
+}
+
+// GetReservationBatch handles GET /api/v1/inventory/batches/:batchId
+func (h *InventoryHandler) GetReservationBatch(c *gin.Context) {
+	batchID, err := uuid.Parse(c.Param("batchId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid batch ID",
+		})
+		return
+	}
+
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "User ID is required",
+		})
+		return
+	}
+
+	response, err := h.inventoryService.GetReservationBatch(c.Request.Context(), batchID, userID)
+	if err != nil {
+		respondReservationError(c, "Failed to get batch", err)
+		return
+	}
 
 	c.JSON(http.StatusOK, response)
 }
@@ -105,18 +219,16 @@ func (h *InventoryHandler) ConfirmPurchase(c *gin.Context) {
 		return
 	}
 
-	err = h.inventoryService.ConfirmPurchase(c.Request.Context(), orderID, userID)
+	order, err := h.inventoryService.ConfirmPurchase(c.Request.Context(), orderID, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Failed to confirm purchase",
-			Message: err.Error(),
-		})
+		respondReservationError(c, "Failed to confirm purchase", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Purchase confirmed successfully",
+		"order":   order,
 	})
 }
 
@@ -141,10 +253,7 @@ func (h *InventoryHandler) ReleaseReservation(c *gin.Context) {
 
 	err = h.inventoryService.ReleaseReservation(c.Request.Context(), orderID, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Failed to release reservation",
-			Message: err.Error(),
-		})
+		respondReservationError(c, "Failed to release reservation", err)
 		return
 	}
 
@@ -154,25 +263,179 @@ func (h *InventoryHandler) ReleaseReservation(c *gin.Context) {
 	})
 }
 
-// GetProductInventory handles GET /api/v1/inventory/:productId
-func (h *InventoryHandler) GetProductInventory(c *gin.Context) {
-	productID := c.Param("productId")
-	if productID == "" {
+// Pagination of reservation listings
+const (
+	defaultReservationPageSize = 20
+	maxReservationPageSize     = 100
+)
+
+// GetReservation handles GET /api/v1/inventory/reservations/:orderId
+func (h *InventoryHandler) GetReservation(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("orderId"))
+	if err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Product ID is required",
+			Error: "Invalid order ID",
 		})
 		return
 	}
 
-	state, err := h.inventoryService.GetProductInventory(c.Request.Context(), productID)
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "User ID is required",
+		})
+		return
+	}
+
+	reservation, err := h.inventoryService.GetReservation(c.Request.Context(), orderID, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Failed to get product inventory",
-			Message: err.Error(),
+		respondReservationError(c, "Failed to get reservation", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, reservation)
+}
+
+// GetUserReservations handles GET /api/v1/inventory/users/:userId/reservations.
+// Users can only list their own reservations.
+func (h *InventoryHandler) GetUserReservations(c *gin.Context) {
+	userID := c.Param("userId")
+	if _, err := uuid.Parse(userID); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid user ID",
+		})
+		return
+	}
+
+	requester := c.GetHeader("X-User-ID")
+	if requester == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "User ID is required",
+		})
+		return
+	}
+	if requester != userID {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "Failed to get reservations",
+			Message: service.ErrReservationNotOwned.Error(),
+		})
+		return
+	}
+
+	limit, ok := queryInt(c, "limit", defaultReservationPageSize, 1, maxReservationPageSize)
+	if !ok {
+		return
+	}
+	offset, ok := queryInt(c, "offset", 0, 0, math.MaxInt32)
+	if !ok {
+		return
+	}
+
+	page, err := h.inventoryService.GetUserReservations(c.Request.Context(), userID, limit, offset)
+	if err != nil {
+		respondInternalError(c, c.Request.Context(), "Failed to get reservations", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// ExtendReservation handles POST /api/v1/inventory/reservations/:orderId/extend
+func (h *InventoryHandler) ExtendReservation(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("orderId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid order ID",
+		})
+		return
+	}
+
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "User ID is required",
 		})
 		return
 	}
 
+	reservation, err := h.inventoryService.ExtendReservation(c.Request.Context(), orderID, userID)
+	if err != nil {
+		respondReservationError(c, "Failed to extend reservation", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, reservation)
+}
+
+// respondReservationError maps reservation errors to their status codes
+func respondReservationError(c *gin.Context, message string, err error) {
+	var status int
+	switch {
+	case errors.Is(err, repository.ErrReservationNotFound),
+		errors.Is(err, repository.ErrOrderNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrReservationNotOwned):
+		status = http.StatusForbidden
+	case errors.Is(err, service.ErrReservationNotActive),
+		errors.Is(err, service.ErrExtensionLimit),
+		errors.Is(err, repository.ErrReservationNotExtendable):
+		status = http.StatusConflict
+	default:
+		respondInternalError(c, c.Request.Context(), message, err)
+		return
+	}
+
+	c.JSON(status, models.ErrorResponse{
+		Error:   message,
+		Message: err.Error(),
+	})
+}
+
+// respondProductLookupError answers 404 when the product does not exist and
+// treats other errors as internal
+func respondProductLookupError(c *gin.Context, message string, err error) {
+	if errors.Is(err, repository.ErrProductNotFound) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   message,
+			Message: repository.ErrProductNotFound.Error(),
+		})
+		return
+	}
+	respondInternalError(c, c.Request.Context(), message, err)
+}
+
+// queryInt parses an optional integer query parameter within [lo, hi],
+// answering 400 and returning false when it is invalid
+func queryInt(c *gin.Context, name string, def, lo, hi int) (int, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return def, true
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < lo || value > hi {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid " + name + " parameter",
+			Message: fmt.Sprintf("%s must be an integer between %d and %d", name, lo, hi),
+		})
+		return 0, false
+	}
+	return value, true
+}
+
+// GetProductInventory handles GET /api/v1/inventory/:productId
+func (h *InventoryHandler) GetProductInventory(c *gin.Context) {
+	productID, ok := productParam(c)
+	if !ok {
+		return
+	}
+
+	state, err := h.inventoryService.GetProductInventory(c.Request.Context(), productID)
+	if err != nil {
+		respondProductLookupError(c, "Failed to get product inventory", err)
+		return
+	}
+
 	c.JSON(http.StatusOK, state)
 }
 
@@ -180,9 +443,10 @@ func (h *InventoryHandler) GetProductInventory(c *gin.Context) {
 func (h *InventoryHandler) BulkCheckAvailability(c *gin.Context) {
 	var req struct {
 		Products []struct {
-			ProductID string `json:"productId" binding:"required"`
+			ProductID string `json:"productId" binding:"required,uuid"`
 			Quantity  int    `json:"quantity" binding:"required,min=1"`
-		} `json:"products" binding:"required"`
+		} `json:"products" binding:"required,dive"`
+		Region string `json:"region,omitempty"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -198,14 +462,12 @@ func (h *InventoryHandler) BulkCheckAvailability(c *gin.Context) {
 		availabilityReq := &models.ProductAvailabilityRequest{
 			ProductID: product.ProductID,
 			Quantity:  product.Quantity,
+			Region:    req.Region,
 		}
 
 		response, err := h.inventoryService.CheckAvailability(c.Request.Context(), availabilityReq)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-				Error:   "Failed to check availability",
-				Message: err.Error(),
-			})
+			respondProductLookupError(c, "Failed to check availability", err)
 			return
 		}
 
@@ -219,14 +481,11 @@ func (h *InventoryHandler) BulkCheckAvailability(c *gin.Context) {
 
 // GetInventoryMetrics handles GET /api/v1/inventory/metrics
 func (h *InventoryHandler) GetInventoryMetrics(c *gin.Context) {
-	// This would typically aggregate metrics from multiple products
-	// For now, return a simple response
-	c.JSON(http.StatusOK, gin.H{
-		"totalProducts":    0,
-		"totalStock":       0,
-		"availableStock":   0,
-		"reservedStock":    0,
-		"lowStockProducts": 0,
-		"lastUpdated":      "2024-01-01T00:00:00Z",
-	})
+	metrics, err := h.inventoryService.GetInventoryMetrics(c.Request.Context())
+	if err != nil {
+		respondInternalError(c, c.Request.Context(), "Failed to get inventory metrics", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, metrics)
 }
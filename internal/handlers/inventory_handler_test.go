@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	ownerID = "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+	otherID = "9b2d5d4e-3f4a-4c1b-8a7e-2f6d1c0b9a8e"
+)
+
+// reservationService serves the reservations of one order the way the
+// inventory service would
+type reservationService struct {
+	service.InventoryService
+	reservation *models.UserReservation
+	pages       []int // limit and offset of each page requested
+	extendErr   error
+}
+
+func (s *reservationService) GetReservation(_ context.Context, orderID uuid.UUID, userID string) (*models.UserReservation, error) {
+	if orderID != s.reservation.OrderID {
+		return nil, repository.ErrReservationNotFound
+	}
+	if userID != s.reservation.UserID {
+		return nil, service.ErrReservationNotOwned
+	}
+	return s.reservation, nil
+}
+
+func (s *reservationService) GetUserReservations(_ context.Context, userID string, limit, offset int) (*models.ReservationPage, error) {
+	s.pages = append(s.pages, limit, offset)
+	page := &models.ReservationPage{Reservations: []*models.UserReservation{}, Limit: limit, Offset: offset}
+	if userID == s.reservation.UserID {
+		page.Reservations = append(page.Reservations, s.reservation)
+		page.Total = 1
+	}
+	return page, nil
+}
+
+func (s *reservationService) ExtendReservation(ctx context.Context, orderID uuid.UUID, userID string) (*models.UserReservation, error) {
+	reservation, err := s.GetReservation(ctx, orderID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if s.extendErr != nil {
+		return nil, s.extendErr
+	}
+	reservation.Extensions++
+	return reservation, nil
+}
+
+func newReservationRouter(inventoryService service.InventoryService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewInventoryHandler(inventoryService)
+	router := gin.New()
+	router.GET("/reservations/:orderId", handler.GetReservation)
+	router.POST("/reservations/:orderId/extend", handler.ExtendReservation)
+	router.GET("/users/:userId/reservations", handler.GetUserReservations)
+	return router
+}
+
+func serve(router *gin.Engine, method, path, userID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if userID != "" {
+		req.Header.Set("X-User-ID", userID)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestInventoryHandler_GetReservation(t *testing.T) {
+	reservation := &models.UserReservation{OrderID: uuid.New(), UserID: ownerID, Status: models.ReservationStatusActive}
+	router := newReservationRouter(&reservationService{reservation: reservation})
+
+	tests := []struct {
+		name   string
+		path   string
+		userID string
+		status int
+	}{
+		{"owner", "/reservations/" + reservation.OrderID.String(), ownerID, http.StatusOK},
+		{"other user", "/reservations/" + reservation.OrderID.String(), otherID, http.StatusForbidden},
+		{"no user", "/reservations/" + reservation.OrderID.String(), "", http.StatusUnauthorized},
+		{"unknown order", "/reservations/" + uuid.NewString(), ownerID, http.StatusNotFound},
+		{"invalid order ID", "/reservations/not-a-uuid", ownerID, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.path, tt.userID)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestInventoryHandler_GetUserReservations(t *testing.T) {
+	reservation := &models.UserReservation{OrderID: uuid.New(), UserID: ownerID, Status: models.ReservationStatusActive}
+
+	tests := []struct {
+		name   string
+		path   string
+		userID string
+		status int
+		pages  []int
+	}{
+		{"own reservations", "/users/" + ownerID + "/reservations", ownerID, http.StatusOK, []int{20, 0}},
+		{"page", "/users/" + ownerID + "/reservations?limit=100&offset=40", ownerID, http.StatusOK, []int{100, 40}},
+		{"other user", "/users/" + ownerID + "/reservations", otherID, http.StatusForbidden, nil},
+		{"no user", "/users/" + ownerID + "/reservations", "", http.StatusUnauthorized, nil},
+		{"invalid user ID", "/users/not-a-uuid/reservations", "not-a-uuid", http.StatusBadRequest, nil},
+		{"limit too large", "/users/" + ownerID + "/reservations?limit=101", ownerID, http.StatusBadRequest, nil},
+		{"limit zero", "/users/" + ownerID + "/reservations?limit=0", ownerID, http.StatusBadRequest, nil},
+		{"negative offset", "/users/" + ownerID + "/reservations?offset=-1", ownerID, http.StatusBadRequest, nil},
+		{"non-numeric limit", "/users/" + ownerID + "/reservations?limit=ten", ownerID, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inventoryService := &reservationService{reservation: reservation}
+			w := serve(newReservationRouter(inventoryService), http.MethodGet, tt.path, tt.userID)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.pages, inventoryService.pages)
+			if tt.status != http.StatusOK {
+				return
+			}
+			var page models.ReservationPage
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+			assert.Equal(t, 1, page.Total)
+			require.Len(t, page.Reservations, 1)
+			assert.Equal(t, reservation.OrderID, page.Reservations[0].OrderID)
+		})
+	}
+}
+
+func TestInventoryHandler_ExtendReservation(t *testing.T) {
+	orderID := uuid.New()
+	path := "/reservations/" + orderID.String() + "/extend"
+
+	tests := []struct {
+		name      string
+		path      string
+		userID    string
+		extendErr error
+		status    int
+	}{
+		{"owner", path, ownerID, nil, http.StatusOK},
+		{"other user", path, otherID, nil, http.StatusForbidden},
+		{"no user", path, "", nil, http.StatusUnauthorized},
+		{"unknown order", "/reservations/" + uuid.NewString() + "/extend", ownerID, nil, http.StatusNotFound},
+		{"invalid order ID", "/reservations/not-a-uuid/extend", ownerID, nil, http.StatusBadRequest},
+		{"extension limit", path, ownerID, service.ErrExtensionLimit, http.StatusConflict},
+		{"no longer active", path, ownerID, service.ErrReservationNotActive, http.StatusConflict},
+		{"changed concurrently", path, ownerID, repository.ErrReservationNotExtendable, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inventoryService := &reservationService{
+				reservation: &models.UserReservation{OrderID: orderID, UserID: ownerID, Status: models.ReservationStatusActive},
+				extendErr:   tt.extendErr,
+			}
+			w := serve(newReservationRouter(inventoryService), http.MethodPost, tt.path, tt.userID)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status != http.StatusOK {
+				return
+			}
+			var reservation models.UserReservation
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reservation))
+			assert.Equal(t, 1, reservation.Extensions)
+		})
+	}
+}
+
+// reserveService reserves whatever it is asked to
+type reserveService struct {
+	service.InventoryService
+	calls int
+}
+
+func (s *reserveService) ReserveInventory(_ context.Context, req *models.PurchaseRequest) (*models.PurchaseResponse, error) {
+	s.calls++
+	return &models.PurchaseResponse{Status: models.PurchaseStatusReserved, ProductID: req.ProductID, Quantity: req.Quantity}, nil
+}
+
+func (s *reserveService) ReserveBatch(_ context.Context, _ *models.BatchPurchaseRequest) (*models.BatchPurchaseResponse, error) {
+	s.calls++
+	return &models.BatchPurchaseResponse{Status: models.PurchaseStatusReserved}, nil
+}
+
+func TestInventoryHandler_ReserveInventory_Validation(t *testing.T) {
+	const productID = "0b3c1f2e-5d41-4c1a-9e7f-1a2b3c4d5e6f"
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"valid", `{"productId":"` + productID + `","quantity":1,"userId":"` + ownerID + `"}`, http.StatusCreated},
+		{"product ID not a UUID", `{"productId":"iphone","quantity":1,"userId":"` + ownerID + `"}`, http.StatusBadRequest},
+		{"user ID not a UUID", `{"productId":"` + productID + `","quantity":1,"userId":"user-1"}`, http.StatusBadRequest},
+		{"no user ID", `{"productId":"` + productID + `","quantity":1}`, http.StatusBadRequest},
+		{"no quantity", `{"productId":"` + productID + `","userId":"` + ownerID + `"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			inventoryService := &reserveService{}
+			router := gin.New()
+			router.POST("/reserve", NewInventoryHandler(inventoryService).ReserveInventory)
+
+			req := httptest.NewRequest(http.MethodPost, "/reserve", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusBadRequest {
+				// Invalid requests never reach the database
+				assert.Zero(t, inventoryService.calls)
+			}
+		})
+	}
+}
+
+func TestInventoryHandler_ReserveBatch_Validation(t *testing.T) {
+	const items = `"items":[{"productId":"0b3c1f2e-5d41-4c1a-9e7f-1a2b3c4d5e6f","quantity":2}]`
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"valid", `{"userId":"` + ownerID + `",` + items + `}`, http.StatusCreated},
+		{"user ID not a UUID", `{"userId":"user-1",` + items + `}`, http.StatusBadRequest},
+		{"no user ID", `{` + items + `}`, http.StatusBadRequest},
+		{"item product ID not a UUID", `{"userId":"` + ownerID + `","items":[{"productId":"iphone","quantity":2}]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			inventoryService := &reserveService{}
+			router := gin.New()
+			router.POST("/reserve-batch", NewInventoryHandler(inventoryService).ReserveBatch)
+
+			req := httptest.NewRequest(http.MethodPost, "/reserve-batch", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusBadRequest {
+				assert.Zero(t, inventoryService.calls)
+			}
+		})
+	}
+}
+
+// failingService fails every call with a database error
+type failingService struct {
+	service.InventoryService
+}
+
+var errDatabase = errors.New(`pq: relation "products" does not exist`)
+
+func (failingService) GetInventoryMetrics(context.Context) (*models.InventoryMetrics, error) {
+	return nil, errDatabase
+}
+
+func (failingService) GetReservation(context.Context, uuid.UUID, string) (*models.UserReservation, error) {
+	return nil, fmt.Errorf("failed to get reservation: %w", errDatabase)
+}
+
+func TestInventoryHandler_InternalErrorsNotExposed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewInventoryHandler(failingService{})
+	router := gin.New()
+	router.GET("/metrics", handler.GetInventoryMetrics)
+	router.GET("/reservations/:orderId", handler.GetReservation)
+
+	for _, path := range []string{"/metrics", "/reservations/" + uuid.NewString()} {
+		t.Run(path, func(t *testing.T) {
+			w := serve(router, http.MethodGet, path, ownerID)
+
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+			assert.NotContains(t, w.Body.String(), "pq:")
+			assert.NotContains(t, w.Body.String(), "products")
+		})
+	}
+}
+
+// batchService serves one batch reservation owned by ownerID
+type batchService struct {
+	service.InventoryService
+	batchID uuid.UUID
+}
+
+func (s *batchService) GetReservationBatch(_ context.Context, batchID uuid.UUID, userID string) (*models.BatchPurchaseResponse, error) {
+	if batchID != s.batchID {
+		return nil, repository.ErrReservationNotFound
+	}
+	if userID != ownerID {
+		return nil, service.ErrReservationNotOwned
+	}
+	return &models.BatchPurchaseResponse{Status: models.PurchaseStatusReserved, BatchID: batchID}, nil
+}
+
+func TestInventoryHandler_GetReservationBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	batchID := uuid.New()
+	router := gin.New()
+	router.GET("/batches/:batchId", NewInventoryHandler(&batchService{batchID: batchID}).GetReservationBatch)
+
+	tests := []struct {
+		name   string
+		path   string
+		userID string
+		status int
+	}{
+		{"owner", "/batches/" + batchID.String(), ownerID, http.StatusOK},
+		{"other user", "/batches/" + batchID.String(), otherID, http.StatusForbidden},
+		{"no user", "/batches/" + batchID.String(), "", http.StatusUnauthorized},
+		{"unknown batch", "/batches/" + uuid.NewString(), ownerID, http.StatusNotFound},
+		{"invalid batch ID", "/batches/not-a-uuid", ownerID, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.path, tt.userID)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+// stockService knows the stock of one product and fails with a database
+// error for brokenID
+type stockService struct {
+	service.InventoryService
+	productID string
+	brokenID  string
+}
+
+func (s *stockService) lookup(productID string) error {
+	switch productID {
+	case s.productID:
+		return nil
+	case s.brokenID:
+		return errDatabase
+	}
+	return fmt.Errorf("failed to get inventory state: %w", repository.ErrProductNotFound)
+}
+
+func (s *stockService) CheckAvailability(_ context.Context, req *models.ProductAvailabilityRequest) (*models.ProductAvailabilityResponse, error) {
+	if err := s.lookup(req.ProductID); err != nil {
+		return nil, err
+	}
+	return &models.ProductAvailabilityResponse{ProductID: req.ProductID, Available: true}, nil
+}
+
+func (s *stockService) GetProductInventory(_ context.Context, productID string) (*models.InventoryState, error) {
+	if err := s.lookup(productID); err != nil {
+		return nil, err
+	}
+	return &models.InventoryState{ProductID: productID}, nil
+}
+
+func TestInventoryHandler_ProductLookups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	inventoryService := &stockService{productID: uuid.NewString(), brokenID: uuid.NewString()}
+	handler := NewInventoryHandler(inventoryService)
+	router := gin.New()
+	router.GET("/inventory/:productId/availability", handler.CheckAvailability)
+	router.GET("/inventory/:productId", handler.GetProductInventory)
+
+	tests := []struct {
+		name      string
+		productID string
+		status    int
+	}{
+		{"known product", inventoryService.productID, http.StatusOK},
+		{"unknown product", uuid.NewString(), http.StatusNotFound},
+		{"invalid product ID", "iphone", http.StatusBadRequest},
+		{"database error", inventoryService.brokenID, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		for _, path := range []string{"/inventory/" + tt.productID + "/availability", "/inventory/" + tt.productID} {
+			t.Run(tt.name+" "+path, func(t *testing.T) {
+				w := serve(router, http.MethodGet, path, "")
+
+				assert.Equal(t, tt.status, w.Code)
+				assert.NotContains(t, w.Body.String(), "pq:")
+			})
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ProductHandler handles the admin product API
+type ProductHandler struct {
+	productService service.ProductService
+}
+
+// NewProductHandler creates a new product handler
+func NewProductHandler(productService service.ProductService) *ProductHandler {
+	return &ProductHandler{
+		productService: productService,
+	}
+}
+
+// ListProducts handles GET /api/v1/admin/products
+func (h *ProductHandler) ListProducts(c *gin.Context) {
+	products, err := h.productService.ListProducts(c.Request.Context())
+	if err != nil {
+		respondProductError(c, "Failed to list products", err)
+		return
+	}
+
+	if products == nil {
+		products = []*models.Product{}
+	}
+	c.JSON(http.StatusOK, gin.H{"products": products})
+}
+
+// CreateProduct handles POST /api/v1/admin/products
+func (h *ProductHandler) CreateProduct(c *gin.Context) {
+	var req models.CreateProductRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	product, err := h.productService.CreateProduct(c.Request.Context(), &req)
+	if err != nil {
+		respondProductError(c, "Failed to create product", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, product)
+}
+
+// GetProduct handles GET /api/v1/admin/products/:productId
+func (h *ProductHandler) GetProduct(c *gin.Context) {
+	productID, ok := productParam(c)
+	if !ok {
+		return
+	}
+
+	product, err := h.productService.GetProduct(c.Request.Context(), productID)
+	if err != nil {
+		respondProductError(c, "Failed to get product", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// UpdateProduct handles PUT /api/v1/admin/products/:productId
+func (h *ProductHandler) UpdateProduct(c *gin.Context) {
+	productID, ok := productParam(c)
+	if !ok {
+		return
+	}
+	var req models.UpdateProductRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	product, err := h.productService.UpdateProduct(c.Request.Context(), productID, &req)
+	if err != nil {
+		respondProductError(c, "Failed to update product", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// DeleteProduct handles DELETE /api/v1/admin/products/:productId. Products
+// whose stock is held by reservations are not deleted.
+func (h *ProductHandler) DeleteProduct(c *gin.Context) {
+	productID, ok := productParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.productService.DeleteProduct(c.Request.Context(), productID); err != nil {
+		respondProductError(c, "Failed to delete product", err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RestockProduct handles POST /api/v1/admin/products/:productId/restock
+func (h *ProductHandler) RestockProduct(c *gin.Context) {
+	productID, ok := productParam(c)
+	if !ok {
+		return
+	}
+	var req models.RestockRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	response, err := h.productService.RestockProduct(c.Request.Context(), productID, &req)
+	if err != nil {
+		respondProductError(c, "Failed to restock product", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AdjustStock handles POST /api/v1/admin/products/:productId/adjustments.
+// It answers 409 when the adjustment would leave less stock than is reserved.
+func (h *ProductHandler) AdjustStock(c *gin.Context) {
+	productID, ok := productParam(c)
+	if !ok {
+		return
+	}
+	var req models.StockAdjustmentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	response, err := h.productService.AdjustStock(c.Request.Context(), productID, &req)
+	if err != nil {
+		respondProductError(c, "Failed to adjust stock", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ListLocations handles GET /api/v1/admin/locations
+func (h *ProductHandler) ListLocations(c *gin.Context) {
+	locations, err := h.productService.ListLocations(c.Request.Context())
+	if err != nil {
+		respondProductError(c, "Failed to list locations", err)
+		return
+	}
+
+	if locations == nil {
+		locations = []*models.Location{}
+	}
+	c.JSON(http.StatusOK, gin.H{"locations": locations})
+}
+
+// CreateLocation handles POST /api/v1/admin/locations
+func (h *ProductHandler) CreateLocation(c *gin.Context) {
+	var req models.CreateLocationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	location, err := h.productService.CreateLocation(c.Request.Context(), &req)
+	if err != nil {
+		respondProductError(c, "Failed to create location", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, location)
+}
+
+// productParam reads the product ID from the path, answering 400 and
+// returning false when it is not a UUID
+func productParam(c *gin.Context) (string, bool) {
+	productID := c.Param("productId")
+	if _, err := uuid.Parse(productID); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid product ID",
+		})
+		return "", false
+	}
+	return productID, true
+}
+
+// bindJSON decodes the request body, answering 400 and returning false when
+// it is invalid
+func bindJSON(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request",
+			Message: err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+func respondProductError(c *gin.Context, message string, err error) {
+	var status int
+	switch {
+	case errors.Is(err, service.ErrInvalidAdjustment),
+		errors.Is(err, service.ErrInvalidLocation):
+		status = http.StatusBadRequest
+	case errors.Is(err, repository.ErrProductNotFound),
+		errors.Is(err, repository.ErrLocationNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, repository.ErrProductExists),
+		errors.Is(err, repository.ErrLocationExists),
+		errors.Is(err, repository.ErrProductInUse),
+		errors.Is(err, repository.ErrInsufficientStock):
+		status = http.StatusConflict
+	default:
+		respondInternalError(c, c.Request.Context(), message, err)
+		return
+	}
+
+	c.JSON(status, models.ErrorResponse{
+		Error:   message,
+		Message: err.Error(),
+	})
+}
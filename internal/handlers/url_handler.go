@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 
+	"url-shortener/internal/config"
 	"url-shortener/internal/models"
 	"url-shortener/internal/service"
 
@@ -11,11 +13,13 @@ import (
 
 type URLHandler struct {
 	urlService service.URLService
+	timeouts   config.URLTimeoutConfig
 }
 
-func NewURLHandler(urlService service.URLService) *URLHandler {
+func NewURLHandler(urlService service.URLService, timeouts config.URLTimeoutConfig) *URLHandler {
 	return &URLHandler{
 		urlService: urlService,
+		timeouts:   timeouts,
 	}
 }
 
@@ -30,12 +34,12 @@ func (h *URLHandler) ShortenURL(c *gin.Context) {
 		return
 	}
 
-	response, err := h.urlService.ShortenURL(req.URL, req.ExpiresAt)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Shorten)
+	defer cancel()
+
+	response, err := h.urlService.ShortenURL(ctx, req.URL, req.ExpiresAt)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Failed to shorten URL",
-			Message: err.Error(),
-		})
+		respondInternalError(c, ctx, "Failed to shorten URL", err)
 		return
 	}
 
@@ -57,8 +61,14 @@ func (h *URLHandler) RedirectURL(c *gin.Context) {
 	userAgent := c.GetHeader("User-Agent")
 	referer := c.GetHeader("Referer")
 
-	originalURL, err := h.urlService.RedirectURL(shortCode, ipAddress, userAgent, referer)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Redirect)
+	defer cancel()
+
+	originalURL, err := h.urlService.RedirectURL(ctx, shortCode, ipAddress, userAgent, referer)
 	if err != nil {
+		if respondDependencyError(c, ctx, err) {
+			return
+		}
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error:   "URL not found",
 			Message: err.Error(),
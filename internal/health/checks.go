@@ -0,0 +1,122 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"url-shortener/internal/kafka"
+	"url-shortener/internal/repository"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Database checks Postgres connectivity and reports connection pool usage
+func Database(db *sql.DB) CheckFunc {
+	return func(ctx context.Context) Result {
+		stats := db.Stats()
+		details := map[string]interface{}{
+			"openConnections": stats.OpenConnections,
+			"inUse":           stats.InUse,
+			"idle":            stats.Idle,
+			"maxOpen":         stats.MaxOpenConnections,
+			"waitCount":       stats.WaitCount,
+		}
+
+		if err := db.PingContext(ctx); err != nil {
+			return Down(fmt.Errorf("failed to ping database: %w", err), details)
+		}
+		return Up(details)
+	}
+}
+
+// CircuitBreaker reports the state of a circuit breaker guarding a dependency
+type CircuitBreaker interface {
+	State() string
+	Healthy() bool
+}
+
+// Redis checks Redis connectivity and reports connection pool usage and the
+// circuit state. The service keeps serving from Postgres and in-process caches
+// without Redis, so an unreachable Redis degrades the service instead of
+// taking it down.
+func Redis(client redis.UniversalClient, breaker CircuitBreaker) CheckFunc {
+	return func(ctx context.Context) Result {
+		stats := client.PoolStats()
+		details := map[string]interface{}{
+			"totalConnections": stats.TotalConns,
+			"idleConnections":  stats.IdleConns,
+			"timeouts":         stats.Timeouts,
+			"circuit":          breaker.State(),
+		}
+
+		if err := client.Ping(ctx).Err(); err != nil {
+			return Degraded(fmt.Sprintf("serving without Redis: %s", err), details)
+		}
+		if !breaker.Healthy() {
+			return Degraded("Redis circuit is "+breaker.State(), details)
+		}
+		return Up(details)
+	}
+}
+
+// BrokerPinger is implemented by Kafka producers and consumers
+type BrokerPinger interface {
+	PingBrokers() (int, error)
+}
+
+// KafkaBrokers checks that at least one Kafka broker is reachable
+func KafkaBrokers(pinger BrokerPinger) CheckFunc {
+	return func(ctx context.Context) Result {
+		brokers, err := pinger.PingBrokers()
+		details := map[string]interface{}{
+			"connectedBrokers": brokers,
+		}
+		if err != nil {
+			return Down(fmt.Errorf("failed to reach Kafka brokers: %w", err), details)
+		}
+		if brokers == 0 {
+			return Down(fmt.Errorf("no Kafka brokers connected"), details)
+		}
+		return Up(details)
+	}
+}
+
+// KafkaConsumer checks broker connectivity and reports the consumer group
+// state. The component is degraded while the consumer is not a stable group
+// member.
+func KafkaConsumer(consumer *kafka.Consumer) CheckFunc {
+	brokers := KafkaBrokers(consumer)
+	return func(ctx context.Context) Result {
+		result := brokers(ctx)
+		state := consumer.GroupState()
+		result.Details["consumerGroup"] = state
+
+		if result.Status == StatusUp && state.State != kafka.GroupStateStable {
+			return Degraded(fmt.Sprintf("consumer group is %s", state.State), result.Details)
+		}
+		return result
+	}
+}
+
+// PreGeneratedPool reports the number of unused pre-generated short codes. The
+// component is degraded below the minimum returned by minSize, since
+// shortening then falls back to generating codes inline.
+func PreGeneratedPool(urlRepo repository.URLRepository, minSize func() int) CheckFunc {
+	return func(ctx context.Context) Result {
+		minimum := minSize()
+		count, err := urlRepo.GetPreGeneratedURLCount(ctx)
+		if err != nil {
+			return Down(fmt.Errorf("failed to count pre-generated URLs: %w", err), nil)
+		}
+
+		details := map[string]interface{}{
+			"available": count,
+			"minimum":   minimum,
+		}
+		if count < minimum {
+			return Degraded("pre-generated pool below minimum", details)
+		}
+		return Up(details)
+	}
+}
@@ -0,0 +1,150 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"url-shortener/internal/version"
+)
+
+// Status describes the state of a component or of the whole service
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+)
+
+// Result is the outcome of a single component check
+type Result struct {
+	Status   Status                 `json:"status"`
+	Error    string                 `json:"error,omitempty"`
+	Duration string                 `json:"duration"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+}
+
+// CheckFunc checks a single component
+type CheckFunc func(ctx context.Context) Result
+
+// Report is the aggregated health of the service
+type Report struct {
+	Status       Status            `json:"status"`
+	Version      string            `json:"version"`
+	Commit       string            `json:"commit"`
+	BuildTime    string            `json:"buildTime"`
+	Timestamp    time.Time         `json:"timestamp"`
+	ShuttingDown bool              `json:"shuttingDown,omitempty"`
+	Components   map[string]Result `json:"components,omitempty"`
+}
+
+// Checker runs the registered component checks
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]CheckFunc
+}
+
+// NewChecker creates a new checker bounding every check by timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		timeout: timeout,
+		checks:  make(map[string]CheckFunc),
+	}
+}
+
+// Register adds a component check
+func (c *Checker) Register(name string, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Run executes all checks concurrently. The service is down if any component
+// is down and degraded if any component is degraded.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := make(map[string]CheckFunc, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.RUnlock()
+
+	report := NewReport(StatusUp)
+	report.Components = make(map[string]Result, len(checks))
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check CheckFunc) {
+			defer wg.Done()
+			result := c.runCheck(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[name] = result
+			switch {
+			case result.Status == StatusDown:
+				report.Status = StatusDown
+			case result.Status == StatusDegraded && report.Status == StatusUp:
+				report.Status = StatusDegraded
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// runCheck runs a check, reporting it down if it does not finish within the timeout
+func (c *Checker) runCheck(ctx context.Context, check CheckFunc) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan Result, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	var result Result
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result = Result{Status: StatusDown, Error: fmt.Sprintf("check timed out after %s", c.timeout)}
+	}
+	result.Duration = time.Since(start).String()
+	return result
+}
+
+// NewReport creates a report without component results
+func NewReport(status Status) Report {
+	return Report{
+		Status:    status,
+		Version:   version.Version,
+		Commit:    version.Commit,
+		BuildTime: version.BuildTime,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// Up reports a healthy component
+func Up(details map[string]interface{}) Result {
+	return Result{Status: StatusUp, Details: details}
+}
+
+// Degraded reports a component that works with reduced capacity
+func Degraded(reason string, details map[string]interface{}) Result {
+	return Result{Status: StatusDegraded, Error: reason, Details: details}
+}
+
+// Down reports a failed component
+func Down(err error, details map[string]interface{}) Result {
+	return Result{Status: StatusDown, Error: err.Error(), Details: details}
+}
@@ -0,0 +1,47 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker_Run(t *testing.T) {
+	checker := NewChecker(50 * time.Millisecond)
+	checker.Register("ok", func(ctx context.Context) Result {
+		return Up(map[string]interface{}{"connections": 1})
+	})
+	checker.Register("pool", func(ctx context.Context) Result {
+		return Degraded("below minimum", nil)
+	})
+
+	report := checker.Run(context.Background())
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.Equal(t, StatusUp, report.Components["ok"].Status)
+	assert.Equal(t, StatusDegraded, report.Components["pool"].Status)
+
+	checker.Register("db", func(ctx context.Context) Result {
+		return Down(errors.New("connection refused"), nil)
+	})
+	report = checker.Run(context.Background())
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, "connection refused", report.Components["db"].Error)
+}
+
+func TestChecker_RunTimeout(t *testing.T) {
+	checker := NewChecker(10 * time.Millisecond)
+	checker.Register("hanging", func(ctx context.Context) Result {
+		time.Sleep(time.Second)
+		return Up(nil)
+	})
+
+	start := time.Now()
+	report := checker.Run(context.Background())
+
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Contains(t, report.Components["hanging"].Error, "timed out")
+}
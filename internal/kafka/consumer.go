@@ -3,14 +3,22 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
 	"sync"
 	"time"
 
+	"url-shortener/internal/logging"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/models"
+	"url-shortener/internal/tracing"
 
 	"github.com/Shopify/sarama"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Consumer handles Kafka message consumption
@@ -20,6 +28,32 @@ type Consumer struct {
 	config   *ConsumerConfig
 	handlers map[string]EventHandler
 	mu       sync.RWMutex
+
+	// Receives messages that failed every attempt
+	deadLetters DeadLetterPublisher
+
+	stateMu sync.RWMutex
+	state   GroupState
+
+	// Set by Start, used by Stop to end the consume loop
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Consumer group states
+const (
+	GroupStateStopped     = "stopped"
+	GroupStateJoining     = "joining"
+	GroupStateStable      = "stable"
+	GroupStateRebalancing = "rebalancing"
+)
+
+// GroupState describes this member's view of the consumer group
+type GroupState struct {
+	State      string    `json:"state"`
+	Partitions int       `json:"partitions"`
+	MemberID   string    `json:"memberId,omitempty"`
+	Since      time.Time `json:"since"`
 }
 
 // ConsumerConfig holds configuration for Kafka consumer
@@ -31,6 +65,13 @@ type ConsumerConfig struct {
 	HeartbeatInterval time.Duration
 	RetryAttempts     int
 	RetryDelay        time.Duration
+
+	// Handler failures are retried HandlerRetries times, waiting
+	// HandlerBackoff before the first retry and twice as long before each
+	// next one, up to HandlerMaxBackoff
+	HandlerRetries    int
+	HandlerBackoff    time.Duration
+	HandlerMaxBackoff time.Duration
 }
 
 // EventHandler defines the interface for handling different event types
@@ -39,8 +80,9 @@ type EventHandler interface {
 	GetEventType() models.InventoryEventType
 }
 
-// NewConsumer creates a new Kafka consumer
-func NewConsumer(config *ConsumerConfig) (*Consumer, error) {
+// NewConsumer creates a new Kafka consumer. Messages that cannot be handled
+// are published to deadLetters.
+func NewConsumer(config *ConsumerConfig, deadLetters DeadLetterPublisher) (*Consumer, error) {
 	saramaConfig := sarama.NewConfig()
 	saramaConfig.Consumer.Group.Session.Timeout = config.SessionTimeout
 	saramaConfig.Consumer.Group.Heartbeat.Interval = config.HeartbeatInterval
@@ -59,13 +101,49 @@ func NewConsumer(config *ConsumerConfig) (*Consumer, error) {
 	}
 
 	return &Consumer{
-		client:   client,
-		consumer: consumer,
-		config:   config,
-		handlers: make(map[string]EventHandler),
+		client:      client,
+		consumer:    consumer,
+		config:      config,
+		handlers:    make(map[string]EventHandler),
+		deadLetters: deadLetters,
+		state:       GroupState{State: GroupStateStopped, Since: time.Now()},
 	}, nil
 }
 
+// GroupState returns the current consumer group membership state
+func (c *Consumer) GroupState() GroupState {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.state
+}
+
+func (c *Consumer) setGroupState(state GroupState) {
+	state.Since = time.Now()
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.state = state
+}
+
+// PingBrokers refreshes cluster metadata and returns the number of brokers
+// the client is connected to
+func (c *Consumer) PingBrokers() (int, error) {
+	return pingBrokers(c.client)
+}
+
+func pingBrokers(client sarama.Client) (int, error) {
+	if err := client.RefreshMetadata(); err != nil {
+		return 0, fmt.Errorf("failed to refresh metadata: %w", err)
+	}
+
+	connected := 0
+	for _, broker := range client.Brokers() {
+		if ok, _ := broker.Connected(); ok {
+			connected++
+		}
+	}
+	return connected, nil
+}
+
 // RegisterHandler registers an event handler
 func (c *Consumer) RegisterHandler(handler EventHandler) {
 	c.mu.Lock()
@@ -81,17 +159,27 @@ func (c *Consumer) Start(ctx context.Context, topics []string) error {
 		prefixedTopics[i] = c.config.TopicPrefix + topic
 	}
 
+	c.setGroupState(GroupState{State: GroupStateJoining})
+
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+
 	// Start consuming in a goroutine
 	go func() {
+		defer close(c.done)
 		for {
 			select {
 			case <-ctx.Done():
-				log.Println("Consumer context cancelled, stopping...")
+				slog.Info("Consumer context cancelled, stopping")
+				c.setGroupState(GroupState{State: GroupStateStopped})
 				return
 			default:
 				err := c.consumer.Consume(ctx, prefixedTopics, c)
+				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+					return
+				}
 				if err != nil {
-					log.Printf("Error consuming messages: %v", err)
+					slog.Error("Error consuming messages", "error", err)
 					time.Sleep(c.config.RetryDelay)
 				}
 			}
@@ -101,16 +189,23 @@ func (c *Consumer) Start(ctx context.Context, topics []string) error {
 	// Handle errors
 	go func() {
 		for err := range c.consumer.Errors() {
-			log.Printf("Consumer error: %v", err)
+			slog.Error("Consumer error", "error", err)
 		}
 	}()
 
-	log.Printf("Consumer started for topics: %v", prefixedTopics)
+	slog.Info("Consumer started", "topics", prefixedTopics)
 	return nil
 }
 
-// Stop stops the consumer
+// Stop ends the current session, letting the message being processed finish
+// and committing marked offsets, then closes the consumer group
 func (c *Consumer) Stop() error {
+	if c.cancel != nil {
+		c.cancel()
+		<-c.done
+	}
+
+	c.setGroupState(GroupState{State: GroupStateStopped})
 	if err := c.consumer.Close(); err != nil {
 		return fmt.Errorf("failed to close consumer: %w", err)
 	}
@@ -123,14 +218,29 @@ func (c *Consumer) Stop() error {
 // Sarama ConsumerGroupHandler implementation
 
 // Setup is run at the beginning of a new session, before ConsumeClaim
-func (c *Consumer) Setup(sarama.ConsumerGroupSession) error {
-	log.Println("Consumer group session setup")
+func (c *Consumer) Setup(session sarama.ConsumerGroupSession) error {
+	partitions := 0
+	for _, claimed := range session.Claims() {
+		partitions += len(claimed)
+	}
+	c.setGroupState(GroupState{
+		State:      GroupStateStable,
+		Partitions: partitions,
+		MemberID:   session.MemberID(),
+	})
+
+	slog.Info("Consumer group session setup", "member_id", session.MemberID(), "partitions", partitions)
 	return nil
 }
 
 // Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited
-func (c *Consumer) Cleanup(sarama.ConsumerGroupSession) error {
-	log.Println("Consumer group session cleanup")
+func (c *Consumer) Cleanup(session sarama.ConsumerGroupSession) error {
+	// Commit synchronously so a rebalance or shutdown does not replay
+	// messages that were already processed
+	session.Commit()
+
+	c.setGroupState(GroupState{State: GroupStateRebalancing})
+	slog.Info("Consumer group session cleanup")
 	return nil
 }
 
@@ -143,13 +253,17 @@ func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 				return nil
 			}
 
-			// Process message
-			if err := c.processMessage(session.Context(), message); err != nil {
-				log.Printf("Error processing message: %v", err)
-				// Continue processing other messages
-			}
+			// Track how far behind the partition head this consumer is
+			metrics.KafkaConsumerLag.
+				WithLabelValues(message.Topic, strconv.Itoa(int(message.Partition))).
+				Set(float64(claim.HighWaterMarkOffset() - message.Offset - 1))
 
-			// Mark message as processed
+			// A message is only marked once it was handled or dead-lettered.
+			// When the session ends first, the next owner of the partition
+			// processes it again.
+			if !c.process(session.Context(), message) {
+				return nil
+			}
 			session.MarkMessage(message, "")
 
 		case <-session.Context().Done():
@@ -158,21 +272,72 @@ func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 	}
 }
 
-// processMessage processes a single Kafka message
-func (c *Consumer) processMessage(ctx context.Context, message *sarama.ConsumerMessage) error {
-	// Parse event type from headers
+// process handles a message and dead-letters it when that fails. It returns
+// false when ctx ended first, leaving the message unprocessed.
+func (c *Consumer) process(ctx context.Context, message *sarama.ConsumerMessage) bool {
+	attempts, err := c.processMessage(ctx, message)
+	if err == nil {
+		return true
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+
+	class := errorClass(err)
+	slog.Error("Dead-lettering message",
+		"topic", message.Topic, "partition", message.Partition, "offset", message.Offset,
+		"attempts", attempts, "error_class", class, "error", err)
+	metrics.KafkaDeadLetters.WithLabelValues(message.Topic, class).Inc()
+
+	// Marking the message without parking it would lose it, so the partition
+	// waits until the dead letter queue takes it
+	for attempt := 1; ; attempt++ {
+		dlqErr := c.deadLetters.PublishDeadLetter(ctx, message, err, attempts)
+		if dlqErr == nil {
+			return true
+		}
+		slog.Error("Failed to dead-letter message",
+			"topic", message.Topic, "partition", message.Partition, "offset", message.Offset, "error", dlqErr)
+		if !sleep(ctx, c.backoff(attempt)) {
+			return false
+		}
+	}
+}
+
+// processMessage processes a single Kafka message, retrying handler failures
+// that are not permanent. It returns how many times the handler ran.
+func (c *Consumer) processMessage(ctx context.Context, message *sarama.ConsumerMessage) (int, error) {
+	// Parse event type and request ID from headers
 	var eventType models.InventoryEventType
 	for _, header := range message.Headers {
-		if string(header.Key) == "eventType" {
+		switch string(header.Key) {
+		case HeaderEventType:
 			eventType = models.InventoryEventType(header.Value)
-			break
+		case HeaderRequestID:
+			ctx = logging.WithRequestID(ctx, string(header.Value))
 		}
 	}
 
+	// Continue the producer's trace
+	ctx, span := tracing.Tracer().Start(tracing.ExtractKafkaHeaders(ctx, message), message.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationDeliver,
+			semconv.MessagingDestinationName(message.Topic),
+			semconv.MessagingKafkaConsumerGroup(c.config.GroupID),
+			semconv.MessagingKafkaDestinationPartition(int(message.Partition)),
+			semconv.MessagingKafkaMessageOffset(int(message.Offset)),
+		),
+	)
+	defer span.End()
+
 	// Deserialize message
 	var event models.InventoryEvent
 	if err := json.Unmarshal(message.Value, &event); err != nil {
-		return fmt.Errorf("failed to unmarshal inventory event: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to unmarshal inventory event")
+		return 0, Permanent(fmt.Errorf("failed to unmarshal inventory event: %w", err))
 	}
 
 	// Get handler for event type
@@ -181,17 +346,60 @@ func (c *Consumer) processMessage(ctx context.Context, message *sarama.ConsumerM
 	c.mu.RUnlock()
 
 	if !exists {
-		log.Printf("No handler found for event type: %s", eventType)
-		return nil
+		err := fmt.Errorf("no handler for event type %q", eventType)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, Permanent(err)
 	}
 
-	// Handle event
-	if err := handler.HandleEvent(ctx, &event); err != nil {
-		return fmt.Errorf("failed to handle event %s: %w", eventType, err)
+	for attempt := 1; ; attempt++ {
+		// Handle event
+		start := time.Now()
+		err := handler.HandleEvent(ctx, &event)
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		metrics.KafkaHandlerDuration.WithLabelValues(string(eventType), result).Observe(time.Since(start).Seconds())
+
+		if err == nil {
+			slog.InfoContext(ctx, "Successfully processed event",
+				"event_type", eventType, "event_id", event.EventID, "product_id", event.ProductID)
+			return attempt, nil
+		}
+
+		if IsPermanent(err) || attempt > c.config.HandlerRetries || !sleep(ctx, c.backoff(attempt)) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return attempt, fmt.Errorf("failed to handle event %s: %w", eventType, err)
+		}
+
+		metrics.KafkaHandlerRetries.WithLabelValues(string(eventType)).Inc()
+		slog.WarnContext(ctx, "Retrying event",
+			"event_type", eventType, "event_id", event.EventID, "attempt", attempt, "error", err)
 	}
+}
 
-	log.Printf("Successfully processed event %s for product %s", eventType, event.ProductID)
-	return nil
+// backoff returns how long to wait before retry number attempt
+func (c *Consumer) backoff(attempt int) time.Duration {
+	delay := c.config.HandlerBackoff
+	for i := 1; i < attempt && delay < c.config.HandlerMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, c.config.HandlerMaxBackoff)
+}
+
+// sleep waits for d and reports whether ctx is still live
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
 }
 
 // InventoryEventHandler handles inventory events
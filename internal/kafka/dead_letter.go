@@ -0,0 +1,363 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// DeadLetterSuffix names the dead letter queue of a topic
+const DeadLetterSuffix = ".dlq"
+
+// Headers recording why a message was dead-lettered
+const (
+	HeaderDeadLetterError             = "dlqError"
+	HeaderDeadLetterErrorClass        = "dlqErrorClass"
+	HeaderDeadLetterAttempts          = "dlqAttempts"
+	HeaderDeadLetterOriginalTopic     = "dlqOriginalTopic"
+	HeaderDeadLetterOriginalPartition = "dlqOriginalPartition"
+	HeaderDeadLetterOriginalOffset    = "dlqOriginalOffset"
+	HeaderDeadLetterFailedAt          = "dlqFailedAt"
+)
+
+// Error classes of dead-lettered messages
+const (
+	ErrorClassPermanent = "permanent" // retrying could not help
+	ErrorClassTransient = "transient" // retries ran out
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a handler error that retrying cannot fix, such as an event
+// referring to something that does not exist. The message is dead-lettered
+// without further attempts.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+func errorClass(err error) string {
+	if IsPermanent(err) {
+		return ErrorClassPermanent
+	}
+	return ErrorClassTransient
+}
+
+// DeadLetterPublisher parks messages the consumer gave up on
+type DeadLetterPublisher interface {
+	PublishDeadLetter(ctx context.Context, message *sarama.ConsumerMessage, cause error, attempts int) error
+}
+
+// PublishDeadLetter copies a consumed message to the dead letter queue of its
+// topic, keeping its key and headers and recording why it failed
+func (p *Producer) PublishDeadLetter(ctx context.Context, message *sarama.ConsumerMessage, cause error, attempts int) error {
+	headers := withoutDeadLetterHeaders(message.Headers)
+	for _, header := range [][2]string{
+		{HeaderDeadLetterError, cause.Error()},
+		{HeaderDeadLetterErrorClass, errorClass(cause)},
+		{HeaderDeadLetterAttempts, strconv.Itoa(attempts)},
+		{HeaderDeadLetterOriginalTopic, message.Topic},
+		{HeaderDeadLetterOriginalPartition, strconv.Itoa(int(message.Partition))},
+		{HeaderDeadLetterOriginalOffset, strconv.FormatInt(message.Offset, 10)},
+		{HeaderDeadLetterFailedAt, time.Now().UTC().Format(time.RFC3339Nano)},
+	} {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(header[0]), Value: []byte(header[1])})
+	}
+
+	deadLetter := &sarama.ProducerMessage{
+		Topic:   message.Topic + DeadLetterSuffix,
+		Key:     keyEncoder(message.Key),
+		Value:   sarama.ByteEncoder(message.Value),
+		Headers: headers,
+	}
+
+	partition, offset, err := p.sendMessage(ctx, deadLetter)
+	if err != nil {
+		return fmt.Errorf("failed to send dead letter: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Dead-lettered message",
+		"topic", message.Topic, "partition", message.Partition, "offset", message.Offset,
+		"dlq_partition", partition, "dlq_offset", offset)
+	return nil
+}
+
+// ReplayDeadLetter publishes a dead-lettered message to the topic it came
+// from, without the headers recording its failure
+func (p *Producer) ReplayDeadLetter(ctx context.Context, message *sarama.ConsumerMessage) error {
+	topic := headerValue(message.Headers, HeaderDeadLetterOriginalTopic)
+	if topic == "" {
+		topic = strings.TrimSuffix(message.Topic, DeadLetterSuffix)
+	}
+
+	replay := &sarama.ProducerMessage{
+		Topic:   topic,
+		Key:     keyEncoder(message.Key),
+		Value:   sarama.ByteEncoder(message.Value),
+		Headers: withoutDeadLetterHeaders(message.Headers),
+	}
+
+	if _, _, err := p.sendMessage(ctx, replay); err != nil {
+		return fmt.Errorf("failed to replay dead letter: %w", err)
+	}
+	return nil
+}
+
+// keyEncoder keeps messages without a key unkeyed
+func keyEncoder(key []byte) sarama.Encoder {
+	if key == nil {
+		return nil
+	}
+	return sarama.ByteEncoder(key)
+}
+
+func withoutDeadLetterHeaders(headers []*sarama.RecordHeader) []sarama.RecordHeader {
+	kept := make([]sarama.RecordHeader, 0, len(headers))
+	for _, header := range headers {
+		if header == nil || strings.HasPrefix(string(header.Key), "dlq") {
+			continue
+		}
+		kept = append(kept, *header)
+	}
+	return kept
+}
+
+func headerValue(headers []*sarama.RecordHeader, key string) string {
+	for _, header := range headers {
+		if header != nil && string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// DeadLetter is a dead-lettered message as shown to operators
+type DeadLetter struct {
+	Partition         int32     `json:"partition"`
+	Offset            int64     `json:"offset"`
+	Key               string    `json:"key,omitempty"`
+	EventType         string    `json:"eventType,omitempty"`
+	OriginalTopic     string    `json:"originalTopic"`
+	OriginalPartition int32     `json:"originalPartition"`
+	OriginalOffset    int64     `json:"originalOffset"`
+	Error             string    `json:"error"`
+	ErrorClass        string    `json:"errorClass"`
+	Attempts          int       `json:"attempts"`
+	FailedAt          time.Time `json:"failedAt"`
+	Value             string    `json:"value"`
+}
+
+func newDeadLetter(message *sarama.ConsumerMessage) DeadLetter {
+	originalPartition, _ := strconv.ParseInt(headerValue(message.Headers, HeaderDeadLetterOriginalPartition), 10, 32)
+	originalOffset, _ := strconv.ParseInt(headerValue(message.Headers, HeaderDeadLetterOriginalOffset), 10, 64)
+	attempts, _ := strconv.Atoi(headerValue(message.Headers, HeaderDeadLetterAttempts))
+	failedAt, _ := time.Parse(time.RFC3339Nano, headerValue(message.Headers, HeaderDeadLetterFailedAt))
+
+	return DeadLetter{
+		Partition:         message.Partition,
+		Offset:            message.Offset,
+		Key:               string(message.Key),
+		EventType:         headerValue(message.Headers, HeaderEventType),
+		OriginalTopic:     headerValue(message.Headers, HeaderDeadLetterOriginalTopic),
+		OriginalPartition: int32(originalPartition),
+		OriginalOffset:    originalOffset,
+		Error:             headerValue(message.Headers, HeaderDeadLetterError),
+		ErrorClass:        headerValue(message.Headers, HeaderDeadLetterErrorClass),
+		Attempts:          attempts,
+		FailedAt:          failedAt,
+		Value:             string(message.Value),
+	}
+}
+
+// DeadLetterQueue reads the dead letter queue of the inventory events topic
+// and replays its messages. Replayed messages stay in the queue; the
+// processor skips events it has already applied.
+type DeadLetterQueue struct {
+	client   sarama.Client
+	consumer sarama.Consumer
+	producer *Producer
+	topic    string
+}
+
+// NewDeadLetterQueue opens the dead letter queue of the inventory events
+// topic under the configured prefix, replaying messages through producer
+func NewDeadLetterQueue(config *ConsumerConfig, producer *Producer) (*DeadLetterQueue, error) {
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Consumer.Return.Errors = true
+
+	client, err := sarama.NewClient(config.Brokers, saramaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to create Kafka consumer: %w", err)
+	}
+
+	return &DeadLetterQueue{
+		client:   client,
+		consumer: consumer,
+		producer: producer,
+		topic:    config.TopicPrefix + EventsTopic + DeadLetterSuffix,
+	}, nil
+}
+
+// Topic returns the name of the dead letter topic
+func (q *DeadLetterQueue) Topic() string {
+	return q.topic
+}
+
+// List returns up to limit dead letters, oldest first in each partition. A
+// limit of zero lists them all.
+func (q *DeadLetterQueue) List(ctx context.Context, limit int) ([]DeadLetter, error) {
+	var deadLetters []DeadLetter
+	err := q.scan(ctx, func(message *sarama.ConsumerMessage) bool {
+		deadLetters = append(deadLetters, newDeadLetter(message))
+		return limit == 0 || len(deadLetters) < limit
+	})
+	return deadLetters, err
+}
+
+// Replay publishes the dead letter at partition and offset back to its topic
+func (q *DeadLetterQueue) Replay(ctx context.Context, partition int32, offset int64) error {
+	oldest, newest, err := q.offsets(partition)
+	if err != nil {
+		return err
+	}
+	if offset < oldest || offset >= newest {
+		return fmt.Errorf("no dead letter at partition %d offset %d", partition, offset)
+	}
+
+	var found *sarama.ConsumerMessage
+	err = q.read(ctx, partition, offset, offset+1, func(message *sarama.ConsumerMessage) bool {
+		if message.Offset == offset {
+			found = message
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if found == nil {
+		return fmt.Errorf("no dead letter at partition %d offset %d", partition, offset)
+	}
+
+	return q.producer.ReplayDeadLetter(ctx, found)
+}
+
+// ReplayAll publishes every dead letter back to its topic and returns how
+// many were replayed
+func (q *DeadLetterQueue) ReplayAll(ctx context.Context) (int, error) {
+	replayed := 0
+	var replayErr error
+	err := q.scan(ctx, func(message *sarama.ConsumerMessage) bool {
+		if replayErr = q.producer.ReplayDeadLetter(ctx, message); replayErr != nil {
+			return false
+		}
+		replayed++
+		return true
+	})
+	if replayErr != nil {
+		return replayed, replayErr
+	}
+	return replayed, err
+}
+
+// scan passes every dead letter to fn until fn returns false
+func (q *DeadLetterQueue) scan(ctx context.Context, fn func(*sarama.ConsumerMessage) bool) error {
+	partitions, err := q.client.Partitions(q.topic)
+	if err != nil {
+		return fmt.Errorf("failed to get partitions of %s: %w", q.topic, err)
+	}
+
+	for _, partition := range partitions {
+		oldest, newest, err := q.offsets(partition)
+		if err != nil {
+			return err
+		}
+
+		more := true
+		if err := q.read(ctx, partition, oldest, newest, func(message *sarama.ConsumerMessage) bool {
+			more = fn(message)
+			return more
+		}); err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
+
+// offsets returns the first offset of partition and the offset after its last message
+func (q *DeadLetterQueue) offsets(partition int32) (int64, int64, error) {
+	oldest, err := q.client.GetOffset(q.topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get oldest offset of %s partition %d: %w", q.topic, partition, err)
+	}
+	newest, err := q.client.GetOffset(q.topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get newest offset of %s partition %d: %w", q.topic, partition, err)
+	}
+	return oldest, newest, nil
+}
+
+// read passes the messages of partition from offset from up to, but not
+// including, offset to to fn until fn returns false
+func (q *DeadLetterQueue) read(ctx context.Context, partition int32, from, to int64, fn func(*sarama.ConsumerMessage) bool) error {
+	if from >= to {
+		return nil
+	}
+
+	pc, err := q.consumer.ConsumePartition(q.topic, partition, from)
+	if err != nil {
+		return fmt.Errorf("failed to consume %s partition %d: %w", q.topic, partition, err)
+	}
+	defer pc.Close()
+
+	for {
+		select {
+		case message := <-pc.Messages():
+			if !fn(message) || message.Offset+1 >= to {
+				return nil
+			}
+		case err := <-pc.Errors():
+			return fmt.Errorf("failed to read %s partition %d: %w", q.topic, partition, err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close closes the consumer and client
+func (q *DeadLetterQueue) Close() error {
+	if err := q.consumer.Close(); err != nil {
+		return fmt.Errorf("failed to close consumer: %w", err)
+	}
+	if err := q.client.Close(); err != nil {
+		return fmt.Errorf("failed to close client: %w", err)
+	}
+	return nil
+}
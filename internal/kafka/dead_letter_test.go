@@ -0,0 +1,214 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"url-shortener/internal/models"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type deadLetterRecorder struct {
+	failures int
+	messages []*sarama.ConsumerMessage
+	causes   []error
+	attempts []int
+}
+
+func (r *deadLetterRecorder) PublishDeadLetter(_ context.Context, message *sarama.ConsumerMessage, cause error, attempts int) error {
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("broker unavailable")
+	}
+	r.messages = append(r.messages, message)
+	r.causes = append(r.causes, cause)
+	r.attempts = append(r.attempts, attempts)
+	return nil
+}
+
+func newTestConsumer(deadLetters DeadLetterPublisher, handler func(context.Context, *models.InventoryEvent) error) *Consumer {
+	c := &Consumer{
+		config: &ConsumerConfig{
+			HandlerRetries:    3,
+			HandlerBackoff:    time.Millisecond,
+			HandlerMaxBackoff: 2 * time.Millisecond,
+		},
+		handlers:    make(map[string]EventHandler),
+		deadLetters: deadLetters,
+	}
+	c.RegisterHandler(NewInventoryEventHandler(models.InventoryEventTypeReserve, handler))
+	return c
+}
+
+func eventMessage(t *testing.T, eventType models.InventoryEventType) *sarama.ConsumerMessage {
+	value, err := json.Marshal(models.InventoryEvent{EventType: eventType, ProductID: "product"})
+	require.NoError(t, err)
+	return &sarama.ConsumerMessage{
+		Topic:   EventsTopic,
+		Key:     []byte("product"),
+		Value:   value,
+		Headers: []*sarama.RecordHeader{{Key: []byte(HeaderEventType), Value: []byte(eventType)}},
+	}
+}
+
+func TestConsumerProcess_RetriesTransientErrors(t *testing.T) {
+	deadLetters := &deadLetterRecorder{}
+	calls := 0
+	c := newTestConsumer(deadLetters, func(context.Context, *models.InventoryEvent) error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+
+	assert.True(t, c.process(context.Background(), eventMessage(t, models.InventoryEventTypeReserve)))
+	assert.Equal(t, 3, calls)
+	assert.Empty(t, deadLetters.messages)
+}
+
+func TestConsumerProcess_DeadLetters(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  func(t *testing.T) *sarama.ConsumerMessage
+		err      error
+		class    string
+		attempts int
+	}{
+		{
+			name:     "retries exhausted",
+			message:  func(t *testing.T) *sarama.ConsumerMessage { return eventMessage(t, models.InventoryEventTypeReserve) },
+			err:      errors.New("connection reset"),
+			class:    ErrorClassTransient,
+			attempts: 4,
+		},
+		{
+			name:     "permanent error",
+			message:  func(t *testing.T) *sarama.ConsumerMessage { return eventMessage(t, models.InventoryEventTypeReserve) },
+			err:      Permanent(errors.New("reservation not found")),
+			class:    ErrorClassPermanent,
+			attempts: 1,
+		},
+		{
+			name:    "no handler",
+			message: func(t *testing.T) *sarama.ConsumerMessage { return eventMessage(t, models.InventoryEventTypeRestock) },
+			class:   ErrorClassPermanent,
+		},
+		{
+			name: "malformed event",
+			message: func(t *testing.T) *sarama.ConsumerMessage {
+				message := eventMessage(t, models.InventoryEventTypeReserve)
+				message.Value = []byte("not json")
+				return message
+			},
+			class: ErrorClassPermanent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The first dead letter publish fails and is retried
+			deadLetters := &deadLetterRecorder{failures: 1}
+			calls := 0
+			c := newTestConsumer(deadLetters, func(context.Context, *models.InventoryEvent) error {
+				calls++
+				return tt.err
+			})
+
+			message := tt.message(t)
+			assert.True(t, c.process(context.Background(), message))
+			assert.Equal(t, tt.attempts, calls)
+
+			require.Len(t, deadLetters.messages, 1)
+			assert.Same(t, message, deadLetters.messages[0])
+			assert.Equal(t, tt.class, errorClass(deadLetters.causes[0]))
+			assert.Equal(t, tt.attempts, deadLetters.attempts[0])
+		})
+	}
+}
+
+func TestConsumerProcess_StopsWhenSessionEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	deadLetters := &deadLetterRecorder{}
+	c := newTestConsumer(deadLetters, func(context.Context, *models.InventoryEvent) error {
+		cancel()
+		return errors.New("connection reset")
+	})
+
+	// The message is left for the next owner of the partition
+	assert.False(t, c.process(ctx, eventMessage(t, models.InventoryEventTypeReserve)))
+	assert.Empty(t, deadLetters.messages)
+}
+
+func TestConsumerBackoff(t *testing.T) {
+	c := &Consumer{config: &ConsumerConfig{HandlerBackoff: 100 * time.Millisecond, HandlerMaxBackoff: time.Second}}
+
+	assert.Equal(t, 100*time.Millisecond, c.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, c.backoff(2))
+	assert.Equal(t, 800*time.Millisecond, c.backoff(4))
+	assert.Equal(t, time.Second, c.backoff(5))
+	assert.Equal(t, time.Second, c.backoff(60))
+}
+
+func TestProducerDeadLetterRoundTrip(t *testing.T) {
+	syncProducer := mocks.NewSyncProducer(t, nil)
+	p := &Producer{producer: syncProducer, config: &ProducerConfig{}}
+
+	original := eventMessage(t, models.InventoryEventTypeReserve)
+	original.Partition, original.Offset = 2, 41
+
+	var parked *sarama.ProducerMessage
+	syncProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+		parked = message
+		return nil
+	})
+	require.NoError(t, p.PublishDeadLetter(context.Background(), original, Permanent(errors.New("boom")), 1))
+
+	require.NotNil(t, parked)
+	assert.Equal(t, EventsTopic+DeadLetterSuffix, parked.Topic)
+
+	// Read it back the way the dead letter queue sees it
+	consumed := &sarama.ConsumerMessage{Topic: parked.Topic, Partition: 0, Offset: 7, Key: original.Key, Value: original.Value}
+	for i := range parked.Headers {
+		consumed.Headers = append(consumed.Headers, &parked.Headers[i])
+	}
+
+	deadLetter := newDeadLetter(consumed)
+	assert.Equal(t, string(models.InventoryEventTypeReserve), deadLetter.EventType)
+	assert.Equal(t, EventsTopic, deadLetter.OriginalTopic)
+	assert.Equal(t, int32(2), deadLetter.OriginalPartition)
+	assert.Equal(t, int64(41), deadLetter.OriginalOffset)
+	assert.Equal(t, "boom", deadLetter.Error)
+	assert.Equal(t, ErrorClassPermanent, deadLetter.ErrorClass)
+	assert.Equal(t, 1, deadLetter.Attempts)
+	assert.False(t, deadLetter.FailedAt.IsZero())
+
+	// Replaying restores the original topic, key and headers
+	var replayed *sarama.ProducerMessage
+	syncProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+		replayed = message
+		return nil
+	})
+	require.NoError(t, p.ReplayDeadLetter(context.Background(), consumed))
+
+	require.NotNil(t, replayed)
+	assert.Equal(t, EventsTopic, replayed.Topic)
+	key, err := replayed.Key.Encode()
+	require.NoError(t, err)
+	assert.Equal(t, "product", string(key))
+	headers := make(map[string]string)
+	for _, header := range replayed.Headers {
+		assert.NotContains(t, string(header.Key), "dlq")
+		headers[string(header.Key)] = string(header.Value)
+	}
+	assert.Equal(t, string(models.InventoryEventTypeReserve), headers[HeaderEventType])
+
+	require.NoError(t, syncProducer.Close())
+}
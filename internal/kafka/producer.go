@@ -4,19 +4,40 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync"
 	"time"
 
+	"url-shortener/internal/logging"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/models"
+	"url-shortener/internal/tracing"
 
 	"github.com/Shopify/sarama"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EventsTopic carries inventory events to the inventory processor
+const EventsTopic = "inventory-events"
+
+// Message header keys
+const (
+	HeaderEventType     = "eventType"
+	HeaderCorrelationID = "correlationId"
+	HeaderRequestID     = "requestId"
 )
 
 // Producer handles Kafka message production
 type Producer struct {
+	client   sarama.Client
 	producer sarama.SyncProducer
 	config   *ProducerConfig
+
+	// Tracks in-flight asynchronous publishes
+	pending sync.WaitGroup
 }
 
 // ProducerConfig holds configuration for Kafka producer
@@ -34,14 +55,21 @@ func NewProducer(config *ProducerConfig) (*Producer, error) {
 	saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
 	saramaConfig.Producer.Retry.Max = config.RetryAttempts
 	saramaConfig.Producer.Retry.Backoff = config.RetryDelay
-	saramaConfig.Producer.Compression = sarama.SnappyCompression
+	saramaConfig.Producer.Compression = sarama.CompressionSnappy
 
-	producer, err := sarama.NewSyncProducer(config.Brokers, saramaConfig)
+	client, err := sarama.NewClient(config.Brokers, saramaConfig)
 	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to create Kafka producer: %w", err)
 	}
 
 	return &Producer{
+		client:   client,
 		producer: producer,
 		config:   config,
 	}, nil
@@ -49,7 +77,36 @@ func NewProducer(config *ProducerConfig) (*Producer, error) {
 
 // Close closes the producer
 func (p *Producer) Close() error {
-	return p.producer.Close()
+	p.pending.Wait()
+	if err := p.producer.Close(); err != nil {
+		return fmt.Errorf("failed to close producer: %w", err)
+	}
+	if err := p.client.Close(); err != nil {
+		return fmt.Errorf("failed to close client: %w", err)
+	}
+	return nil
+}
+
+// PingBrokers refreshes cluster metadata and returns the number of brokers
+// the client is connected to
+func (p *Producer) PingBrokers() (int, error) {
+	return pingBrokers(p.client)
+}
+
+// Flush waits for asynchronous publishes started by PublishInventoryEventAsync
+func (p *Producer) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush pending events: %w", ctx.Err())
+	}
 }
 
 // PublishInventoryEvent publishes an inventory event to Kafka
@@ -77,29 +134,37 @@ func (p *Producer) PublishInventoryEvent(ctx context.Context, event *models.Inve
 
 	// Create Kafka message
 	message := &sarama.ProducerMessage{
-		Topic: p.config.TopicPrefix + "inventory-events",
+		Topic: p.config.TopicPrefix + EventsTopic,
 		Key:   sarama.StringEncoder(event.ProductID), // Partition by product ID
 		Value: sarama.ByteEncoder(eventBytes),
 		Headers: []sarama.RecordHeader{
 			{
-				Key:   []byte("eventType"),
+				Key:   []byte(HeaderEventType),
 				Value: []byte(event.EventType),
 			},
 			{
-				Key:   []byte("correlationId"),
+				Key:   []byte(HeaderCorrelationID),
 				Value: []byte(event.CorrelationID.String()),
 			},
 		},
 	}
 
+	// Propagate the originating request ID to consumers
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		message.Headers = append(message.Headers, sarama.RecordHeader{
+			Key:   []byte(HeaderRequestID),
+			Value: []byte(requestID),
+		})
+	}
+
 	// Send message
-	partition, offset, err := p.producer.SendMessage(message)
+	partition, offset, err := p.sendMessage(ctx, message)
 	if err != nil {
 		return fmt.Errorf("failed to send inventory event: %w", err)
 	}
 
-	log.Printf("Published inventory event %s to partition %d, offset %d",
-		event.EventID, partition, offset)
+	slog.DebugContext(ctx, "Published inventory event",
+		"event_id", event.EventID, "event_type", event.EventType, "partition", partition, "offset", offset)
 
 	return nil
 }
@@ -126,22 +191,128 @@ func (p *Producer) PublishInventoryState(ctx context.Context, state *models.Inve
 	}
 
 	// Send message
-	partition, offset, err := p.producer.SendMessage(message)
+	partition, offset, err := p.sendMessage(ctx, message)
 	if err != nil {
 		return fmt.Errorf("failed to send inventory state: %w", err)
 	}
 
-	log.Printf("Published inventory state for product %s to partition %d, offset %d",
-		state.ProductID, partition, offset)
+	slog.DebugContext(ctx, "Published inventory state",
+		"product_id", state.ProductID, "partition", partition, "offset", offset)
 
 	return nil
 }
 
+// PublishReservationReply publishes the outcome of a reserve event to the
+// reply topic, keyed by the correlation ID the requester is waiting on
+func (p *Producer) PublishReservationReply(ctx context.Context, reply *models.ReservationReply) error {
+	if reply.Timestamp.IsZero() {
+		reply.Timestamp = time.Now()
+	}
+
+	replyBytes, err := json.Marshal(reply)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reservation reply: %w", err)
+	}
+
+	message := &sarama.ProducerMessage{
+		Topic: p.config.TopicPrefix + ReplyTopic,
+		Key:   sarama.StringEncoder(reply.CorrelationID.String()),
+		Value: sarama.ByteEncoder(replyBytes),
+		Headers: []sarama.RecordHeader{
+			{
+				Key:   []byte(HeaderCorrelationID),
+				Value: []byte(reply.CorrelationID.String()),
+			},
+		},
+	}
+
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		message.Headers = append(message.Headers, sarama.RecordHeader{
+			Key:   []byte(HeaderRequestID),
+			Value: []byte(requestID),
+		})
+	}
+
+	partition, offset, err := p.sendMessage(ctx, message)
+	if err != nil {
+		return fmt.Errorf("failed to send reservation reply: %w", err)
+	}
+
+	slog.DebugContext(ctx, "Published reservation reply",
+		"correlation_id", reply.CorrelationID, "reserved", reply.Reserved, "partition", partition, "offset", offset)
+
+	return nil
+}
+
+// sendMessage sends a message inside a producer span, propagating the trace
+// context through the message headers, and records publish metrics
+func (p *Producer) sendMessage(ctx context.Context, message *sarama.ProducerMessage) (int32, int64, error) {
+	ctx, span := tracing.Tracer().Start(ctx, message.Topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationPublish,
+			semconv.MessagingDestinationName(message.Topic),
+		),
+	)
+	defer span.End()
+
+	tracing.InjectKafkaHeaders(ctx, message)
+
+	start := time.Now()
+	partition, offset, err := p.producer.SendMessage(message)
+	metrics.KafkaPublishDuration.WithLabelValues(message.Topic).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.KafkaPublishErrors.WithLabelValues(message.Topic).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return partition, offset, err
+	}
+
+	span.SetAttributes(
+		semconv.MessagingKafkaDestinationPartition(int(partition)),
+		semconv.MessagingKafkaMessageOffset(int(offset)),
+	)
+	return partition, offset, nil
+}
+
+// PublishOutboxMessage publishes a message the outbox relay read from the
+// outbox, under the request ID and trace of the request that queued it
+func (p *Producer) PublishOutboxMessage(ctx context.Context, message *models.OutboxMessage) error {
+	if message.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, message.RequestID)
+	}
+	ctx = tracing.ExtractMap(ctx, message.TraceContext)
+
+	switch message.Kind {
+	case models.OutboxKindInventoryEvent:
+		var event models.InventoryEvent
+		if err := json.Unmarshal(message.Payload, &event); err != nil {
+			return fmt.Errorf("failed to decode outbox message %d: %w", message.ID, err)
+		}
+		return p.PublishInventoryEvent(ctx, &event)
+	case models.OutboxKindInventoryState:
+		var state models.InventoryState
+		if err := json.Unmarshal(message.Payload, &state); err != nil {
+			return fmt.Errorf("failed to decode outbox message %d: %w", message.ID, err)
+		}
+		return p.PublishInventoryState(ctx, &state)
+	default:
+		return fmt.Errorf("unknown kind %q of outbox message %d", message.Kind, message.ID)
+	}
+}
+
 // PublishInventoryEventAsync publishes an inventory event asynchronously
 func (p *Producer) PublishInventoryEventAsync(ctx context.Context, event *models.InventoryEvent) error {
+	// The publish outlives the request that triggered it
+	ctx = context.WithoutCancel(ctx)
+
+	p.pending.Add(1)
 	go func() {
+		defer p.pending.Done()
 		if err := p.PublishInventoryEvent(ctx, event); err != nil {
-			log.Printf("Failed to publish inventory event asynchronously: %v", err)
+			slog.ErrorContext(ctx, "Failed to publish inventory event asynchronously",
+				"event_id", event.EventID, "error", err)
 		}
 	}()
 	return nil
@@ -177,6 +348,27 @@ func (p *Producer) CreateInventoryReserveEvent(productID string, quantity int, u
 	}
 }
 
+// CreateInventoryReserveBatchEvent creates an event reserving every item of
+// a batch or none of them. The items are sorted by product ID; the event is
+// keyed by the first product and its quantity is the batch total.
+func (p *Producer) CreateInventoryReserveBatchEvent(userID string, batchID uuid.UUID, items []models.InventoryEventItem, metadata map[string]interface{}) *models.InventoryEvent {
+	quantity := 0
+	for _, item := range items {
+		quantity += item.Quantity
+	}
+	return &models.InventoryEvent{
+		EventID:       uuid.New(),
+		EventType:     models.InventoryEventTypeReserveBatch,
+		ProductID:     items[0].ProductID,
+		UserID:        userID,
+		Quantity:      quantity,
+		Timestamp:     time.Now(),
+		CorrelationID: batchID,
+		Metadata:      metadata,
+		Items:         items,
+	}
+}
+
 // CreateInventoryConfirmEvent creates an inventory confirm event
 func (p *Producer) CreateInventoryConfirmEvent(productID string, quantity int, userID string, correlationID uuid.UUID, metadata map[string]interface{}) *models.InventoryEvent {
 	return &models.InventoryEvent{
@@ -0,0 +1,67 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"url-shortener/internal/models"
+	"url-shortener/internal/tracing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPublishOutboxMessage_RestoresTrace(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	// The request that queued the message
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+	requestCtx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	payload, err := json.Marshal(models.InventoryEvent{EventType: models.InventoryEventTypeReserve, ProductID: "product"})
+	require.NoError(t, err)
+	message := &models.OutboxMessage{
+		ID:           1,
+		Kind:         models.OutboxKindInventoryEvent,
+		Key:          "product",
+		Payload:      payload,
+		TraceContext: tracing.InjectMap(requestCtx),
+	}
+	require.Contains(t, message.TraceContext, "traceparent")
+
+	syncProducer := mocks.NewSyncProducer(t, nil)
+	p := &Producer{producer: syncProducer, config: &ProducerConfig{}}
+
+	var sent *sarama.ProducerMessage
+	syncProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+		sent = message
+		return nil
+	})
+	// The relay publishes with its own context, outside any request
+	require.NoError(t, p.PublishOutboxMessage(context.Background(), message))
+	require.NotNil(t, sent)
+
+	consumed := &sarama.ConsumerMessage{}
+	for i := range sent.Headers {
+		consumed.Headers = append(consumed.Headers, &sent.Headers[i])
+	}
+	consumerCtx := tracing.ExtractKafkaHeaders(context.Background(), consumed)
+	assert.Equal(t, traceID, trace.SpanContextFromContext(consumerCtx).TraceID())
+
+	require.NoError(t, syncProducer.Close())
+}
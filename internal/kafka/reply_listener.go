@@ -0,0 +1,139 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"url-shortener/internal/models"
+
+	"github.com/Shopify/sarama"
+	"github.com/google/uuid"
+)
+
+// ReplyTopic carries the outcome of reserve events back to the API servers
+const ReplyTopic = "inventory-replies"
+
+// ReplyListener hands reservation replies to the requests waiting on them.
+// It reads every partition of the reply topic outside any consumer group, so
+// each API replica sees all replies, including those for its own requests.
+type ReplyListener struct {
+	consumer sarama.Consumer
+	topic    string
+
+	mu      sync.Mutex
+	waiters map[uuid.UUID]chan models.ReservationReply
+
+	partitions []sarama.PartitionConsumer
+	done       sync.WaitGroup
+}
+
+// NewReplyListener creates a reply listener for the reply topic under the
+// configured prefix
+func NewReplyListener(config *ConsumerConfig) (*ReplyListener, error) {
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Consumer.Return.Errors = true
+
+	consumer, err := sarama.NewConsumer(config.Brokers, saramaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka consumer: %w", err)
+	}
+
+	return newReplyListener(consumer, config.TopicPrefix+ReplyTopic), nil
+}
+
+func newReplyListener(consumer sarama.Consumer, topic string) *ReplyListener {
+	return &ReplyListener{
+		consumer: consumer,
+		topic:    topic,
+		waiters:  make(map[uuid.UUID]chan models.ReservationReply),
+	}
+}
+
+// Start reads replies published from now on. Older replies are never needed:
+// a request registers with Await before its event is published.
+func (l *ReplyListener) Start(ctx context.Context) error {
+	partitions, err := l.consumer.Partitions(l.topic)
+	if err != nil {
+		return fmt.Errorf("failed to get partitions of %s: %w", l.topic, err)
+	}
+
+	for _, partition := range partitions {
+		pc, err := l.consumer.ConsumePartition(l.topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return fmt.Errorf("failed to consume %s partition %d: %w", l.topic, partition, err)
+		}
+		l.partitions = append(l.partitions, pc)
+
+		l.done.Add(2)
+		go func() {
+			defer l.done.Done()
+			for message := range pc.Messages() {
+				l.handle(ctx, message)
+			}
+		}()
+		go func() {
+			defer l.done.Done()
+			for err := range pc.Errors() {
+				slog.ErrorContext(ctx, "Reply listener error", "topic", l.topic, "error", err)
+			}
+		}()
+	}
+
+	slog.InfoContext(ctx, "Reply listener started", "topic", l.topic, "partitions", len(partitions))
+	return nil
+}
+
+// Await registers interest in the reply for correlationID. The returned
+// channel receives at most one reply; cancel must be called once the caller
+// stops waiting.
+func (l *ReplyListener) Await(correlationID uuid.UUID) (<-chan models.ReservationReply, func()) {
+	replies := make(chan models.ReservationReply, 1)
+
+	l.mu.Lock()
+	l.waiters[correlationID] = replies
+	l.mu.Unlock()
+
+	return replies, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.waiters, correlationID)
+	}
+}
+
+func (l *ReplyListener) handle(ctx context.Context, message *sarama.ConsumerMessage) {
+	var reply models.ReservationReply
+	if err := json.Unmarshal(message.Value, &reply); err != nil {
+		slog.WarnContext(ctx, "Ignoring malformed reservation reply",
+			"partition", message.Partition, "offset", message.Offset, "error", err)
+		return
+	}
+	l.dispatch(reply)
+}
+
+// dispatch delivers reply to its waiter, if this replica has one
+func (l *ReplyListener) dispatch(reply models.ReservationReply) {
+	l.mu.Lock()
+	replies, ok := l.waiters[reply.CorrelationID]
+	delete(l.waiters, reply.CorrelationID)
+	l.mu.Unlock()
+
+	if ok {
+		replies <- reply
+	}
+}
+
+// Close stops reading replies and closes the consumer
+func (l *ReplyListener) Close() error {
+	for _, pc := range l.partitions {
+		pc.AsyncClose()
+	}
+	l.done.Wait()
+
+	if err := l.consumer.Close(); err != nil {
+		return fmt.Errorf("failed to close consumer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"url-shortener/internal/models"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func replyMessage(t *testing.T, reply models.ReservationReply) *sarama.ConsumerMessage {
+	value, err := json.Marshal(reply)
+	require.NoError(t, err)
+	return &sarama.ConsumerMessage{Value: value}
+}
+
+func TestReplyListener(t *testing.T) {
+	consumer := mocks.NewConsumer(t, nil)
+	consumer.SetTopicMetadata(map[string][]int32{ReplyTopic: {0, 1}})
+	first := consumer.ExpectConsumePartition(ReplyTopic, 0, sarama.OffsetNewest)
+	second := consumer.ExpectConsumePartition(ReplyTopic, 1, sarama.OffsetNewest)
+
+	listener := newReplyListener(consumer, ReplyTopic)
+	require.NoError(t, listener.Start(context.Background()))
+
+	waiting, abandoned := uuid.New(), uuid.New()
+	replies, cancel := listener.Await(waiting)
+	defer cancel()
+	_, cancelAbandoned := listener.Await(abandoned)
+	cancelAbandoned()
+
+	// Replies for other replicas, abandoned requests and garbage are skipped
+	first.YieldMessage(replyMessage(t, models.ReservationReply{CorrelationID: uuid.New(), Reserved: true}))
+	first.YieldMessage(replyMessage(t, models.ReservationReply{CorrelationID: abandoned, Reserved: true}))
+	first.YieldMessage(&sarama.ConsumerMessage{Value: []byte("not json")})
+	second.YieldMessage(replyMessage(t, models.ReservationReply{
+		CorrelationID: waiting,
+		Reason:        models.ReservationRejectedInsufficientStock,
+	}))
+
+	select {
+	case reply := <-replies:
+		assert.Equal(t, waiting, reply.CorrelationID)
+		assert.False(t, reply.Reserved)
+		assert.Equal(t, models.ReservationRejectedInsufficientStock, reply.Reason)
+	case <-time.After(time.Second):
+		t.Fatal("reply was not delivered")
+	}
+
+	require.NoError(t, listener.Close())
+}
@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "url_shortener"
+
+// HTTP metrics
+var (
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+)
+
+// Cache metrics
+var (
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "Cache lookups by cache tier and result (hit, miss, error).",
+	}, []string{"cache", "result"})
+)
+
+// URL shortener metrics
+var (
+	PreGeneratedPoolSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "urls",
+		Name:      "pregenerated_pool_size",
+		Help:      "Number of unused pre-generated short codes.",
+	})
+)
+
+// Inventory metrics
+var (
+	InventoryReservations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "inventory",
+		Name:      "reservations_total",
+		Help:      "Reserve requests by status returned to the client (reserved, rejected, pending).",
+	}, []string{"status"})
+
+	InventoryDuplicateEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "inventory",
+		Name:      "duplicate_events_total",
+		Help:      "Redelivered events skipped by the processor, by event type and the check that caught them (ledger, status).",
+	}, []string{"event_type", "check"})
+
+	InventoryBatchReservations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "inventory",
+		Name:      "batch_reservations_total",
+		Help:      "Batch reserve requests by status returned to the client (reserved, rejected, pending).",
+	}, []string{"status"})
+
+	InventoryIdempotentReplays = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "inventory",
+		Name:      "idempotent_replays_total",
+		Help:      "Reserve requests answered with the reservation of an earlier request with the same Idempotency-Key.",
+	})
+
+	InventoryOutboxRelayed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "inventory",
+		Name:      "outbox_relayed_total",
+		Help:      "Outbox messages published to Kafka by the outbox relay.",
+	})
+
+	InventoryOutboxErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "inventory",
+		Name:      "outbox_relay_errors_total",
+		Help:      "Outbox relay runs that stopped on a failure; the messages are retried on the next poll.",
+	})
+
+	InventoryStockChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "inventory",
+		Name:      "stock_changes_total",
+		Help:      "Restocks and manual stock adjustments made by admins, by reason (restock, damage, shrinkage, recount).",
+	}, []string{"reason"})
+)
+
+// Redis metrics
+var (
+	RedisCircuitState = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "redis",
+		Name:      "circuit_state",
+		Help:      "State of the Redis circuit breaker (0 closed, 1 half-open, 2 open).",
+	})
+
+	RedisCircuitTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "redis",
+		Name:      "circuit_transitions_total",
+		Help:      "Redis circuit breaker state changes by new state.",
+	}, []string{"state"})
+
+	RedisRejectedCommands = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "redis",
+		Name:      "rejected_commands_total",
+		Help:      "Redis commands failed fast while the circuit was open.",
+	})
+)
+
+// Configuration metrics
+var (
+	ConfigReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "config",
+		Name:      "reloads_total",
+		Help:      "Configuration reloads by result (applied, unchanged, rejected).",
+	}, []string{"result"})
+)
+
+// Kafka metrics
+var (
+	KafkaPublishDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "publish_duration_seconds",
+		Help:      "Time taken to publish a message to Kafka by topic.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"topic"})
+
+	KafkaPublishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "publish_errors_total",
+		Help:      "Failed Kafka publishes by topic.",
+	}, []string{"topic"})
+
+	KafkaConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "consumer_lag",
+		Help:      "Messages between the last consumed offset and the partition high water mark.",
+	}, []string{"topic", "partition"})
+
+	KafkaHandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "handler_duration_seconds",
+		Help:      "Time taken to handle a consumed event by event type and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"event_type", "result"})
+
+	KafkaHandlerRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "handler_retries_total",
+		Help:      "Retries of failed event handlers by event type.",
+	}, []string{"event_type"})
+
+	KafkaDeadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "dead_letters_total",
+		Help:      "Messages moved to a dead letter queue by source topic and error class (permanent, transient).",
+	}, []string{"topic", "class"})
+)
+
+// RegisterDBStats exposes connection pool statistics of db under the given name
+func RegisterDBStats(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler returns the HTTP handler serving the /metrics endpoint
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"url-shortener/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth middleware only lets requests through that carry the admin token
+// as "Authorization: Bearer <token>"
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		presented, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="admin"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error: "Admin token required",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(AdminAuth("admin-token-0123456789"))
+	router.GET("/admin", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"valid token", "Bearer admin-token-0123456789", http.StatusOK},
+		{"missing header", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer admin-token-9876543210", http.StatusUnauthorized},
+		{"token prefix", "Bearer admin-token", http.StatusUnauthorized},
+		{"other scheme", "Basic admin-token-0123456789", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
@@ -1,21 +1,217 @@
 package middleware
 
 import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"url-shortener/internal/config"
+
 	"github.com/gin-gonic/gin"
 )
 
-// CORS middleware for cross-origin requests
-func CORS() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+// CORSPolicy is a compiled CORS configuration for one group of routes
+type CORSPolicy struct {
+	allowAll         bool
+	exactOrigins     map[string]bool
+	wildcardOrigins  []wildcardOrigin
+	allowedMethods   string
+	allowedHeaders   string
+	exposedHeaders   string
+	allowCredentials bool
+	maxAge           string
+}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+// wildcardOrigin matches "<scheme>://*.<domain>" patterns
+type wildcardOrigin struct {
+	prefix string
+	suffix string
+}
+
+// NewCORSPolicy compiles a CORS configuration
+func NewCORSPolicy(cfg config.CORSConfig) *CORSPolicy {
+	policy := &CORSPolicy{
+		exactOrigins:     make(map[string]bool),
+		allowedMethods:   joinHeaderValues(cfg.AllowedMethods),
+		allowedHeaders:   joinHeaderValues(cfg.AllowedHeaders),
+		exposedHeaders:   joinHeaderValues(cfg.ExposedHeaders),
+		allowCredentials: cfg.AllowCredentials,
+	}
+
+	if cfg.MaxAge > 0 {
+		policy.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "":
+			continue
+		case origin == "*":
+			policy.allowAll = true
+		case strings.Contains(origin, "://*."):
+			scheme, domain, _ := strings.Cut(origin, "://*")
+			policy.wildcardOrigins = append(policy.wildcardOrigins, wildcardOrigin{
+				prefix: scheme + "://",
+				suffix: domain,
+			})
+		default:
+			policy.exactOrigins[strings.TrimSuffix(origin, "/")] = true
+		}
+	}
+
+	// Browsers refuse credentials with "*", and reflecting every origin instead
+	// would let any site make credentialed requests
+	if policy.allowAll {
+		policy.allowCredentials = false
+	}
+
+	return policy
+}
+
+// IsOriginAllowed reports whether the policy allows the given origin
+func (p *CORSPolicy) IsOriginAllowed(origin string) bool {
+	if p.allowAll {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if p.exactOrigins[origin] {
+		return true
+	}
+
+	for _, wildcard := range p.wildcardOrigins {
+		if !strings.HasPrefix(origin, wildcard.prefix) || !strings.HasSuffix(origin, wildcard.suffix) {
+			continue
+		}
+		subdomain := origin[len(wildcard.prefix) : len(origin)-len(wildcard.suffix)]
+		if subdomain != "" && !strings.ContainsAny(subdomain, "/:") {
+			return true
 		}
+	}
 
+	return false
+}
+
+// handle applies the policy to a request
+func (p *CORSPolicy) handle(c *gin.Context) {
+	origin := c.GetHeader("Origin")
+	preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+	// The response depends on the Origin header unless every origin gets the
+	// same literal "*", so shared caches must key on it
+	if !p.allowAll {
+		c.Writer.Header().Add("Vary", "Origin")
+	}
+	if preflight {
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+	}
+
+	if origin == "" {
 		c.Next()
+		return
+	}
+
+	if !p.IsOriginAllowed(origin) {
+		if preflight {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+		return
+	}
+
+	if p.allowAll {
+		c.Header("Access-Control-Allow-Origin", "*")
+	} else {
+		c.Header("Access-Control-Allow-Origin", origin)
+	}
+	if p.allowCredentials {
+		c.Header("Access-Control-Allow-Credentials", "true")
+	}
+
+	if preflight {
+		c.Header("Access-Control-Allow-Methods", p.allowedMethods)
+		c.Header("Access-Control-Allow-Headers", p.allowedHeaders)
+		if p.maxAge != "" {
+			c.Header("Access-Control-Max-Age", p.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+
+	if p.exposedHeaders != "" {
+		c.Header("Access-Control-Expose-Headers", p.exposedHeaders)
+	}
+
+	c.Next()
+}
+
+// CORSRouter selects a CORS policy by path prefix and can be updated while serving
+type CORSRouter struct {
+	policies atomic.Pointer[prefixPolicies]
+}
+
+type prefixPolicies struct {
+	defaultPolicy *CORSPolicy
+	byPrefix      []prefixPolicy // longest prefix first
+}
+
+type prefixPolicy struct {
+	prefix string
+	policy *CORSPolicy
+}
+
+// NewCORSRouter creates a router using the policy of the longest matching
+// path prefix, falling back to defaultCfg
+func NewCORSRouter(defaultCfg config.CORSConfig, groups map[string]config.CORSConfig) *CORSRouter {
+	r := &CORSRouter{}
+	r.Update(defaultCfg, groups)
+	return r
+}
+
+// Update compiles and swaps in new policies. Requests in flight keep the
+// policies they started with.
+func (r *CORSRouter) Update(defaultCfg config.CORSConfig, groups map[string]config.CORSConfig) {
+	compiled := &prefixPolicies{
+		defaultPolicy: NewCORSPolicy(defaultCfg),
+		byPrefix:      make([]prefixPolicy, 0, len(groups)),
+	}
+	for prefix, cfg := range groups {
+		compiled.byPrefix = append(compiled.byPrefix, prefixPolicy{prefix: prefix, policy: NewCORSPolicy(cfg)})
+	}
+	sort.Slice(compiled.byPrefix, func(i, j int) bool {
+		return len(compiled.byPrefix[i].prefix) > len(compiled.byPrefix[j].prefix)
+	})
+	r.policies.Store(compiled)
+}
+
+// Handler returns the middleware. It is meant to be installed on the router
+// rather than on a group because gin only runs group middleware for
+// registered routes, and preflight OPTIONS requests have none.
+func (r *CORSRouter) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policies := r.policies.Load()
+		path := c.Request.URL.Path
+		for _, p := range policies.byPrefix {
+			if path == p.prefix || strings.HasPrefix(path, strings.TrimSuffix(p.prefix, "/")+"/") {
+				p.policy.handle(c)
+				return
+			}
+		}
+		policies.defaultPolicy.handle(c)
+	}
+}
+
+func joinHeaderValues(values []string) string {
+	trimmed := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			trimmed = append(trimmed, value)
+		}
 	}
+	return strings.Join(trimmed, ", ")
 }
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"url-shortener/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSPolicy_IsOriginAllowed(t *testing.T) {
+	policy := NewCORSPolicy(config.CORSConfig{
+		AllowedOrigins: []string{"http://localhost:3000", "https://*.example.com"},
+	})
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"http://localhost:3000", true},
+		{"HTTP://LOCALHOST:3000", true},
+		{"http://localhost:8080", false},
+		{"https://app.example.com", true},
+		{"https://a.b.example.com", true},
+		{"https://example.com", false},
+		{"http://app.example.com", false},
+		{"https://evil.com/.example.com", false},
+		{"https://app.example.com.evil.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			assert.Equal(t, tt.allowed, policy.IsOriginAllowed(tt.origin))
+		})
+	}
+}
+
+func TestCORSRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	defaultCfg := config.CORSConfig{
+		AllowedOrigins:   []string{"http://localhost:3000"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	cors := NewCORSRouter(defaultCfg, map[string]config.CORSConfig{
+		"/api/v1/inventory": {AllowedOrigins: []string{"https://shop.example.com"}},
+	})
+
+	router := gin.New()
+	router.Use(cors.Handler())
+	router.GET("/api/v1/inventory/:productId", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/api/v1/shorten", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	send := func(method, path, origin string, preflight bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Origin", origin)
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Preflight for an unregistered OPTIONS route still gets answered
+	w := send(http.MethodOptions, "/api/v1/shorten", "http://localhost:3000", true)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "http://localhost:3000", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, w.Header().Values("Vary"), "Origin")
+
+	// The inventory group carries its own policy
+	w = send(http.MethodGet, "/api/v1/inventory/p1", "http://localhost:3000", false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = send(http.MethodGet, "/api/v1/inventory/p1", "https://shop.example.com", false)
+	assert.Equal(t, "https://shop.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = send(http.MethodOptions, "/api/v1/inventory/p1", "http://localhost:3000", true)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Reloaded policies apply to the next request
+	cors.Update(defaultCfg, map[string]config.CORSConfig{
+		"/api/v1/inventory": {AllowedOrigins: []string{"http://localhost:3000"}},
+	})
+	w = send(http.MethodGet, "/api/v1/inventory/p1", "http://localhost:3000", false)
+	assert.Equal(t, "http://localhost:3000", w.Header().Get("Access-Control-Allow-Origin"))
+	w = send(http.MethodGet, "/api/v1/inventory/p1", "https://shop.example.com", false)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSRouter_AnyOriginWithoutCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(NewCORSRouter(config.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}, nil).Handler())
+	router.GET("/api/v1/inventory/:productId", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/inventory/p1", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// The origin is never reflected and credentials are never allowed
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.NotContains(t, w.Header().Values("Vary"), "Origin")
+}
@@ -1,66 +1,263 @@
 package middleware
 
 import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"url-shortener/internal/config"
+
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 )
 
-// RateLimiter implements a simple in-memory rate limiter
-type RateLimiter struct {
-	requests map[string][]time.Time
-	mutex    sync.RWMutex
-	limit    int
-	window   time.Duration
+// RateLimitResult describes the outcome of a rate limit check
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	ResetAfter time.Duration
 }
 
-// NewRateLimiter creates a new rate limiter
-func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
-	return &RateLimiter{
-		requests: make(map[string][]time.Time),
-		limit:    limit,
-		window:   window,
+// Limiter decides whether a request identified by key may proceed under a policy
+type Limiter interface {
+	Allow(ctx context.Context, key string, policy config.RateLimitPolicy) (*RateLimitResult, error)
+}
+
+// gcraScript implements the generic cell rate algorithm atomically in Redis.
+// All times are in microseconds and read from the Redis clock, so replicas
+// whose clocks drift apart still agree on every key. The script stores the
+// theoretical arrival time (TAT) of the next request and returns:
+// {allowed, remaining, retry_after, reset_after}
+var gcraScript = redis.NewScript(`
+-- TIME is not deterministic; replicate the writes rather than the script
+-- on servers older than Redis 5
+redis.replicate_commands()
+
+local key = KEYS[1]
+local emission = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000000 + tonumber(clock[2])
+
+local tat = tonumber(redis.call('GET', key))
+if not tat or tat < now then
+	tat = now
+end
+
+local new_tat = tat + emission
+local allow_at = new_tat - window
+if now < allow_at then
+	return {0, 0, allow_at - now, tat - now}
+end
+
+redis.call('SET', key, new_tat, 'PX', math.ceil((new_tat - now) / 1000))
+return {1, math.floor((now - allow_at) / emission), 0, new_tat - now}
+`)
+
+// redisRetryInterval is how long the Redis limiter stays on the local
+// fallback after Redis returned an error
+const redisRetryInterval = 5 * time.Second
+
+// RedisLimiter is a GCRA limiter shared by all replicas through Redis.
+// When Redis is unavailable it falls back to a process-local limiter.
+type RedisLimiter struct {
+	client   redis.UniversalClient
+	prefix   string
+	fallback *LocalLimiter
+
+	mutex     sync.RWMutex
+	downUntil time.Time
+}
+
+// NewRedisLimiter creates a new Redis backed limiter
+func NewRedisLimiter(client redis.UniversalClient, prefix string) *RedisLimiter {
+	return &RedisLimiter{
+		client:   client,
+		prefix:   prefix,
+		fallback: NewLocalLimiter(),
+	}
+}
+
+// Allow implements Limiter
+func (rl *RedisLimiter) Allow(ctx context.Context, key string, policy config.RateLimitPolicy) (*RateLimitResult, error) {
+	if rl.isRedisDown() {
+		return rl.fallback.Allow(ctx, key, policy)
+	}
+
+	window := policy.Window.Microseconds()
+	emission := emissionInterval(policy).Microseconds()
+	if emission < 1 {
+		emission = 1
 	}
+
+	values, err := gcraScript.Run(ctx, rl.client, []string{rl.prefix + key}, emission, window).Int64Slice()
+	if err != nil {
+		slog.WarnContext(ctx, "Redis rate limiter unavailable, falling back to local limiting", "error", err)
+		rl.markRedisDown()
+		return rl.fallback.Allow(ctx, key, policy)
+	}
+
+	return &RateLimitResult{
+		Allowed:    values[0] == 1,
+		Limit:      policy.Limit,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+		ResetAfter: time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
+
+func (rl *RedisLimiter) isRedisDown() bool {
+	rl.mutex.RLock()
+	defer rl.mutex.RUnlock()
+	return time.Now().Before(rl.downUntil)
 }
 
-// Allow checks if a request is allowed
-func (rl *RateLimiter) Allow(key string) bool {
+func (rl *RedisLimiter) markRedisDown() {
 	rl.mutex.Lock()
 	defer rl.mutex.Unlock()
+	rl.downUntil = time.Now().Add(redisRetryInterval)
+}
+
+// localSweepInterval controls how often idle keys are evicted from the local limiter
+const localSweepInterval = time.Minute
+
+// LocalLimiter is an in-memory GCRA limiter. It keeps a single timestamp per
+// key and evicts keys whose bucket has fully refilled.
+type LocalLimiter struct {
+	tats      map[string]time.Time
+	mutex     sync.Mutex
+	lastSweep time.Time
+}
+
+// NewLocalLimiter creates a new in-memory limiter
+func NewLocalLimiter() *LocalLimiter {
+	return &LocalLimiter{
+		tats:      make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow implements Limiter
+func (ll *LocalLimiter) Allow(ctx context.Context, key string, policy config.RateLimitPolicy) (*RateLimitResult, error) {
+	ll.mutex.Lock()
+	defer ll.mutex.Unlock()
 
 	now := time.Now()
-	cutoff := now.Add(-rl.window)
-
-	// Clean old requests
-	if requests, exists := rl.requests[key]; exists {
-		var validRequests []time.Time
-		for _, reqTime := range requests {
-			if reqTime.After(cutoff) {
-				validRequests = append(validRequests, reqTime)
-			}
-		}
-		rl.requests[key] = validRequests
+	if now.Sub(ll.lastSweep) > localSweepInterval {
+		ll.sweep(now)
+	}
+
+	emission := emissionInterval(policy)
+	tat, exists := ll.tats[key]
+	if !exists || tat.Before(now) {
+		tat = now
+	}
+
+	newTat := tat.Add(emission)
+	allowAt := newTat.Add(-policy.Window)
+	if now.Before(allowAt) {
+		return &RateLimitResult{
+			Allowed:    false,
+			Limit:      policy.Limit,
+			RetryAfter: allowAt.Sub(now),
+			ResetAfter: tat.Sub(now),
+		}, nil
 	}
 
-	// Check if under limit
-	if len(rl.requests[key]) < rl.limit {
-		rl.requests[key] = append(rl.requests[key], now)
-		return true
+	ll.tats[key] = newTat
+	return &RateLimitResult{
+		Allowed:    true,
+		Limit:      policy.Limit,
+		Remaining:  int(now.Sub(allowAt) / emission),
+		ResetAfter: newTat.Sub(now),
+	}, nil
+}
+
+// Len returns the number of keys currently tracked
+func (ll *LocalLimiter) Len() int {
+	ll.mutex.Lock()
+	defer ll.mutex.Unlock()
+	return len(ll.tats)
+}
+
+func (ll *LocalLimiter) sweep(now time.Time) {
+	for key, tat := range ll.tats {
+		if tat.Before(now) {
+			delete(ll.tats, key)
+		}
 	}
+	ll.lastSweep = now
+}
+
+func emissionInterval(policy config.RateLimitPolicy) time.Duration {
+	return policy.Window / time.Duration(policy.Limit)
+}
+
+// RateLimiter builds rate limiting middleware for route groups
+type RateLimiter struct {
+	limiter Limiter
+	config  atomic.Pointer[config.RateLimitConfig]
+}
 
-	return false
+// NewRateLimiter creates a new rate limiter
+func NewRateLimiter(limiter Limiter, cfg config.RateLimitConfig) *RateLimiter {
+	rl := &RateLimiter{limiter: limiter}
+	rl.Update(cfg)
+	return rl
 }
 
-var globalRateLimiter = NewRateLimiter(100000, time.Minute) // 100000 requests per minute for load testing
+// Update replaces the policies of all middleware created by the rate limiter
+func (rl *RateLimiter) Update(cfg config.RateLimitConfig) {
+	rl.config.Store(&cfg)
+}
 
-// RateLimit middleware for rate limiting
-func RateLimit() gin.HandlerFunc {
+// Policy returns middleware enforcing the given policy. Requests carrying a
+// known API key are limited per key using that key's policy, all other
+// requests are limited per client IP. After an Update the middleware uses the
+// updated policy with the same name.
+func (rl *RateLimiter) Policy(policy config.RateLimitPolicy) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
+		cfg := rl.config.Load()
+		if !cfg.Enabled {
+			c.Next()
+			return
+		}
+
+		effective := policy
+		if current, exists := cfg.PolicyByName(policy.Name); exists {
+			effective = current
+		}
+		identity := "ip:" + c.ClientIP()
+		if apiKey := c.GetHeader(cfg.APIKeyHeader); apiKey != "" {
+			if keyPolicy, exists := cfg.APIKeys[apiKey]; exists {
+				effective = keyPolicy
+				identity = "key:" + apiKey
+			}
+		}
+
+		result, err := rl.limiter.Allow(c.Request.Context(), policy.Name+":"+identity, effective)
+		if err != nil {
+			// Never reject traffic because the limiter itself failed
+			slog.ErrorContext(c.Request.Context(), "Rate limiter error", "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
 
-		if !globalRateLimiter.Allow(clientIP) {
-			c.JSON(429, gin.H{
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error": "Rate limit exceeded",
 			})
 			c.Abort()
@@ -70,3 +267,7 @@ func RateLimit() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
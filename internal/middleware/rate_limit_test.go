@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"url-shortener/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalLimiter_Allow(t *testing.T) {
+	limiter := NewLocalLimiter()
+	policy := config.RateLimitPolicy{Name: "test", Limit: 3, Window: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Allow(context.Background(), "client", policy)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 2-i, result.Remaining)
+	}
+
+	result, err := limiter.Allow(context.Background(), "client", policy)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Greater(t, result.RetryAfter, time.Duration(0))
+
+	// Other keys have their own bucket
+	result, err = limiter.Allow(context.Background(), "other", policy)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
+
+func TestLocalLimiter_EvictsIdleKeys(t *testing.T) {
+	limiter := NewLocalLimiter()
+	policy := config.RateLimitPolicy{Name: "test", Limit: 1000, Window: time.Millisecond}
+
+	_, _ = limiter.Allow(context.Background(), "client", policy)
+	assert.Equal(t, 1, limiter.Len())
+
+	time.Sleep(5 * time.Millisecond)
+	limiter.mutex.Lock()
+	limiter.sweep(time.Now())
+	limiter.mutex.Unlock()
+
+	assert.Equal(t, 0, limiter.Len())
+}
+
+func TestRateLimiter_Policy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.RateLimitConfig{
+		Enabled:      true,
+		APIKeyHeader: "X-API-Key",
+		APIKeys: map[string]config.RateLimitPolicy{
+			"premium": {Name: "key", Limit: 5, Window: time.Minute},
+		},
+	}
+	rateLimiter := NewRateLimiter(NewLocalLimiter(), cfg)
+
+	router := gin.New()
+	router.GET("/", rateLimiter.Policy(config.RateLimitPolicy{Name: "route", Limit: 1, Window: time.Minute}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	send := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	w = send("")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// A known API key gets its own bucket and policy
+	w = send("premium")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "5", w.Header().Get("RateLimit-Limit"))
+
+	// Unknown API keys are still limited by client IP
+	w = send("unknown")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,6 +16,15 @@ const (
 	InventoryEventTypeConfirm InventoryEventType = "INVENTORY_CONFIRM"
 	InventoryEventTypeRelease InventoryEventType = "INVENTORY_RELEASE"
 	InventoryEventTypeRestock InventoryEventType = "INVENTORY_RESTOCK"
+	InventoryEventTypeAdjust  InventoryEventType = "INVENTORY_ADJUST"
+
+	// Reserves every item of a batch or none of them
+	InventoryEventTypeReserveBatch InventoryEventType = "INVENTORY_RESERVE_BATCH"
+
+	// Product changes made by admins
+	InventoryEventTypeProductCreated InventoryEventType = "INVENTORY_PRODUCT_CREATED"
+	InventoryEventTypeProductUpdated InventoryEventType = "INVENTORY_PRODUCT_UPDATED"
+	InventoryEventTypeProductDeleted InventoryEventType = "INVENTORY_PRODUCT_DELETED"
 )
 
 // InventoryEvent represents an inventory event message
@@ -27,6 +37,17 @@ type InventoryEvent struct {
 	Timestamp     time.Time              `json:"timestamp"`
 	CorrelationID uuid.UUID              `json:"correlationId"`
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	// Items of a batch event, sorted by product ID
+	Items []InventoryEventItem `json:"items,omitempty"`
+	// Allocation is where a reserve event's stock may be held
+	Allocation *AllocationPolicy `json:"allocation,omitempty"`
+}
+
+// InventoryEventItem is one reservation of a batch event
+type InventoryEventItem struct {
+	OrderID   uuid.UUID `json:"orderId"`
+	ProductID string    `json:"productId"`
+	Quantity  int       `json:"quantity"`
 }
 
 // InventoryState represents the current state of a product's inventory
@@ -37,6 +58,28 @@ type InventoryState struct {
 	TotalStock     int       `json:"totalStock"`
 	LastUpdated    time.Time `json:"lastUpdated"`
 	Version        int       `json:"version"`
+	// Locations break the stock down by location
+	Locations []LocationStock `json:"locations,omitempty"`
+}
+
+// Kinds of outbox messages
+const (
+	OutboxKindInventoryEvent = "inventory-event"
+	OutboxKindInventoryState = "inventory-state"
+)
+
+// OutboxMessage is a Kafka message recorded in the transaction of the change
+// it describes, waiting for the outbox relay to publish it
+type OutboxMessage struct {
+	ID        int64           `json:"id" db:"id"`
+	Kind      string          `json:"kind" db:"kind"`
+	Key       string          `json:"key" db:"message_key"`
+	Payload   json.RawMessage `json:"payload" db:"payload"`
+	RequestID string          `json:"requestId,omitempty" db:"request_id"`
+	// W3C trace context fields (traceparent, tracestate) of the request that
+	// queued the message
+	TraceContext map[string]string `json:"traceContext,omitempty" db:"trace_context"`
+	CreatedAt    time.Time         `json:"createdAt" db:"created_at"`
 }
 
 // Product represents a product in the system
@@ -51,17 +94,129 @@ type Product struct {
 	Version        int       `json:"version" db:"version"`
 	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
 	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
+	// Locations break the stock down by location, where loaded
+	Locations []LocationStock `json:"locations,omitempty"`
+}
+
+// CreateProductRequest represents a request to create a product
+type CreateProductRequest struct {
+	// ID is generated when empty
+	ID          string  `json:"id,omitempty" binding:"omitempty,uuid"`
+	Name        string  `json:"name" binding:"required,max=255"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price" binding:"min=0"`
+	Stock       int     `json:"stock" binding:"min=0"`
+	// LocationID is where the initial stock is held, DefaultLocationID
+	// when empty
+	LocationID string `json:"locationId,omitempty" binding:"omitempty,max=50"`
+}
+
+// UpdateProductRequest represents a request to change a product's details.
+// Stock is changed by restocks and adjustments only.
+type UpdateProductRequest struct {
+	Name        string  `json:"name" binding:"required,max=255"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price" binding:"min=0"`
+}
+
+// RestockRequest represents a request to add stock to a product
+type RestockRequest struct {
+	Quantity int    `json:"quantity" binding:"required,min=1"`
+	Note     string `json:"note,omitempty"`
+	// LocationID is where the stock arrived, DefaultLocationID when empty
+	LocationID string `json:"locationId,omitempty" binding:"omitempty,max=50"`
 }
 
+// Reasons for manual stock adjustments
+const (
+	AdjustmentReasonDamage    = "DAMAGE"    // units damaged and written off
+	AdjustmentReasonShrinkage = "SHRINKAGE" // units lost or stolen
+	AdjustmentReasonRecount   = "RECOUNT"   // stock counted again
+)
+
+// StockAdjustmentRequest represents a manual stock adjustment at a location.
+// Damage and shrinkage remove Quantity units; a recount sets the location's
+// total stock to Counted.
+type StockAdjustmentRequest struct {
+	Reason   string `json:"reason" binding:"required,oneof=DAMAGE SHRINKAGE RECOUNT"`
+	Quantity int    `json:"quantity,omitempty" binding:"min=0"`
+	Counted  *int   `json:"counted,omitempty" binding:"omitempty,min=0"`
+	Note     string `json:"note,omitempty"`
+	// LocationID is where the stock is adjusted, DefaultLocationID when empty
+	LocationID string `json:"locationId,omitempty" binding:"omitempty,max=50"`
+}
+
+// StockChangeResponse reports a restock or adjustment and the stock it left
+// the product with
+type StockChangeResponse struct {
+	EventID  uuid.UUID `json:"eventId"`
+	Quantity int       `json:"quantity"` // units added, negative when removed
+	Product  *Product  `json:"product"`
+}
+
+// Reservation statuses
+const (
+	ReservationStatusPending   = "PENDING" // recorded, not yet processed
+	ReservationStatusActive    = "ACTIVE"
+	ReservationStatusConfirmed = "CONFIRMED"
+	ReservationStatusReleased  = "RELEASED"
+	ReservationStatusExpired   = "EXPIRED"
+	ReservationStatusRejected  = "REJECTED"
+)
+
 // UserReservation represents a user's reservation of inventory
 type UserReservation struct {
 	ID            string    `json:"id" db:"id"`
+	OrderID       uuid.UUID `json:"orderId" db:"order_id"`
 	UserID        string    `json:"userId" db:"user_id"`
 	ProductID     string    `json:"productId" db:"product_id"`
 	Quantity      int       `json:"quantity" db:"quantity"`
 	ReservedAt    time.Time `json:"reservedAt" db:"reserved_at"`
 	ExpiresAt     time.Time `json:"expiresAt" db:"expires_at"`
 	Status        string    `json:"status" db:"status"`
+	Reason        string    `json:"reason,omitempty" db:"reason"`
+	Extensions    int       `json:"extensions" db:"extensions"`
+	CorrelationID uuid.UUID `json:"correlationId" db:"correlation_id"`
+	// IdempotencyKey is the key the client sent with the reserve request
+	IdempotencyKey string `json:"idempotencyKey,omitempty" db:"idempotency_key"`
+	// BatchID groups the reservations of a batch request
+	BatchID *uuid.UUID `json:"batchId,omitempty" db:"batch_id"`
+	// Allocations are the locations the reserved stock is held at, where
+	// loaded
+	Allocations []LocationAllocation `json:"allocations,omitempty"`
+}
+
+// ReservationPage is one page of a user's reservations, newest first
+type ReservationPage struct {
+	Reservations []*UserReservation `json:"reservations"`
+	Total        int                `json:"total"`
+	Limit        int                `json:"limit"`
+	Offset       int                `json:"offset"`
+}
+
+// Order statuses. An order is PENDING until the processor has confirmed its
+// reservation, CONFIRMED once its stock has been taken off the shelf and
+// COMPLETED once the new stock has been published. Orders whose reservation
+// lapsed first are CANCELLED.
+const (
+	OrderStatusPending   = "PENDING"
+	OrderStatusConfirmed = "CONFIRMED"
+	OrderStatusCompleted = "COMPLETED"
+	OrderStatusCancelled = "CANCELLED"
+)
+
+// Order is a confirmed purchase. It shares its ID with the order ID of the
+// reservation it was made from.
+type Order struct {
+	ID            uuid.UUID `json:"id" db:"id"`
+	UserID        string    `json:"userId" db:"user_id"`
+	ProductID     string    `json:"productId" db:"product_id"`
+	Quantity      int       `json:"quantity" db:"quantity"`
+	Price         float64   `json:"price" db:"price"`
+	TotalAmount   float64   `json:"totalAmount" db:"total_amount"`
+	Status        string    `json:"status" db:"status"`
+	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time `json:"updatedAt" db:"updated_at"`
 	CorrelationID uuid.UUID `json:"correlationId" db:"correlation_id"`
 }
 
@@ -86,35 +241,147 @@ type InventoryEventResponse struct {
 	Error          string    `json:"error,omitempty"`
 }
 
-// ProductAvailabilityRequest represents a request to check product availability
+// ProductAvailabilityRequest represents a request to check product
+// availability, across every location or those of one region
 type ProductAvailabilityRequest struct {
 	ProductID string `json:"productId" binding:"required"`
 	Quantity  int    `json:"quantity" binding:"required,min=1"`
+	Region    string `json:"region,omitempty"`
 }
 
-// ProductAvailabilityResponse represents the response to availability check
+// ProductAvailabilityResponse represents the response to availability check.
+// The stock figures add up the locations listed.
 type ProductAvailabilityResponse struct {
-	ProductID      string `json:"productId"`
-	Available      bool   `json:"available"`
-	AvailableStock int    `json:"availableStock"`
-	TotalStock     int    `json:"totalStock"`
-	ReservedStock  int    `json:"reservedStock"`
+	ProductID      string          `json:"productId"`
+	Available      bool            `json:"available"`
+	AvailableStock int             `json:"availableStock"`
+	TotalStock     int             `json:"totalStock"`
+	ReservedStock  int             `json:"reservedStock"`
+	Region         string          `json:"region,omitempty"`
+	Locations      []LocationStock `json:"locations"`
 }
 
 // PurchaseRequest represents a purchase request
 type PurchaseRequest struct {
-	ProductID string `json:"productId" binding:"required"`
+	ProductID string `json:"productId" binding:"required,uuid"`
 	Quantity  int    `json:"quantity" binding:"required,min=1"`
-	UserID    string `json:"userId" binding:"required"`
+	UserID    string `json:"userId" binding:"required,uuid"`
+	AllocationPolicy
+	// IdempotencyKey is taken from the Idempotency-Key header
+	IdempotencyKey string `json:"-"`
 }
 
+// Purchase statuses reported to the client
+const (
+	PurchaseStatusReserved = "RESERVED"
+	PurchaseStatusRejected = "REJECTED"
+	PurchaseStatusPending  = "PENDING" // the outcome did not arrive in time
+)
+
 // PurchaseResponse represents the response to a purchase request
 type PurchaseResponse struct {
-	Success       bool      `json:"success"`
-	OrderID       uuid.UUID `json:"orderId"`
-	ProductID     string    `json:"productId"`
-	Quantity      int       `json:"quantity"`
-	ReservedUntil time.Time `json:"reservedUntil"`
-	Message       string    `json:"message,omitempty"`
-	Error         string    `json:"error,omitempty"`
+	Success        bool       `json:"success"`
+	Status         string     `json:"status"`
+	OrderID        uuid.UUID  `json:"orderId"`
+	ProductID      string     `json:"productId"`
+	Quantity       int        `json:"quantity"`
+	ReservedUntil  *time.Time `json:"reservedUntil,omitempty"`
+	Reason         string     `json:"reason,omitempty"`
+	AvailableStock *int       `json:"availableStock,omitempty"`
+	StatusURL      string     `json:"statusUrl,omitempty"`
+	Message        string     `json:"message,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	// Replayed is set when the response repeats an earlier request made with
+	// the same Idempotency-Key
+	Replayed bool `json:"replayed,omitempty"`
+	// Allocations are the locations the reserved stock is held at
+	Allocations []LocationAllocation `json:"allocations,omitempty"`
+}
+
+// Reasons a reservation is rejected
+const (
+	ReservationRejectedInsufficientStock = "INSUFFICIENT_STOCK"
+	ReservationRejectedProductNotFound   = "PRODUCT_NOT_FOUND"
+	// Another item of the same batch could not be reserved
+	ReservationRejectedBatch = "BATCH_REJECTED"
+	// The hold ran out before the reserve event was processed, so no stock
+	// was ever reserved
+	ReservationExpiredUnprocessed = "EXPIRED_UNPROCESSED"
+)
+
+// BatchPurchaseItem is one line item of a batch reservation
+type BatchPurchaseItem struct {
+	ProductID string `json:"productId" binding:"required,uuid"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
+}
+
+// BatchPurchaseRequest represents a request to reserve up to 50 products at
+// once. Either every item is reserved or none is.
+type BatchPurchaseRequest struct {
+	UserID string              `json:"userId" binding:"required,uuid"`
+	Items  []BatchPurchaseItem `json:"items" binding:"required,min=1,max=50,dive"`
+	// AllocationPolicy applies to every item
+	AllocationPolicy
+}
+
+// BatchReservationItem is the reservation made for one line item
+type BatchReservationItem struct {
+	OrderID   uuid.UUID `json:"orderId"`
+	ProductID string    `json:"productId"`
+	Quantity  int       `json:"quantity"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// ItemShortfall describes a line item that kept its batch from being
+// reserved. AvailableStock is the stock the item was checked against; it is
+// not known for products that do not exist, for items no allowed location
+// could hold or once the batch is polled.
+type ItemShortfall struct {
+	ProductID      string `json:"productId"`
+	Requested      int    `json:"requested"`
+	AvailableStock *int   `json:"availableStock,omitempty"`
+	Reason         string `json:"reason"`
+}
+
+// BatchPurchaseResponse represents the response to a batch reservation
+type BatchPurchaseResponse struct {
+	Success       bool                   `json:"success"`
+	Status        string                 `json:"status"`
+	BatchID       uuid.UUID              `json:"batchId"`
+	Items         []BatchReservationItem `json:"items"`
+	ReservedUntil *time.Time             `json:"reservedUntil,omitempty"`
+	Shortfalls    []ItemShortfall        `json:"shortfalls,omitempty"`
+	StatusURL     string                 `json:"statusUrl,omitempty"`
+	Message       string                 `json:"message,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+}
+
+// ReservationReply is published by the inventory processor once it has
+// handled a reserve event, keyed by the event's correlation ID
+type ReservationReply struct {
+	CorrelationID  uuid.UUID  `json:"correlationId"`
+	OrderID        uuid.UUID  `json:"orderId"`
+	ProductID      string     `json:"productId"`
+	Quantity       int        `json:"quantity"`
+	Reserved       bool       `json:"reserved"`
+	Reason         string     `json:"reason,omitempty"`
+	AvailableStock int        `json:"availableStock"`
+	ReservedUntil  *time.Time `json:"reservedUntil,omitempty"`
+	Timestamp      time.Time  `json:"timestamp"`
+	// Shortfalls are the items that kept a batch from being reserved
+	Shortfalls []ItemShortfall `json:"shortfalls,omitempty"`
+	// Allocations are where a single reservation's stock is held
+	Allocations []LocationAllocation `json:"allocations,omitempty"`
+}
+
+// InventoryMetrics represents aggregated inventory figures across all products
+type InventoryMetrics struct {
+	TotalProducts      int        `json:"totalProducts"`
+	TotalStock         int        `json:"totalStock"`
+	AvailableStock     int        `json:"availableStock"`
+	ReservedStock      int        `json:"reservedStock"`
+	LowStockProducts   int        `json:"lowStockProducts"`
+	OutOfStockProducts int        `json:"outOfStockProducts"`
+	LastUpdated        *time.Time `json:"lastUpdated"`
 }
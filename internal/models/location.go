@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// DefaultLocationID is the location stock is added to when no location is
+// given. Stock recorded before locations existed is held there.
+const DefaultLocationID = "default"
+
+// Location is a warehouse stock is shipped from
+type Location struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Region    string    `json:"region" db:"region"`
+	Latitude  *float64  `json:"latitude,omitempty" db:"latitude"`
+	Longitude *float64  `json:"longitude,omitempty" db:"longitude"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// CreateLocationRequest represents a request to add a location. Its
+// coordinates are needed to allocate stock to the nearest location.
+type CreateLocationRequest struct {
+	ID        string   `json:"id" binding:"required,max=50"`
+	Name      string   `json:"name" binding:"required,max=255"`
+	Region    string   `json:"region" binding:"required,max=50"`
+	Latitude  *float64 `json:"latitude,omitempty" binding:"omitempty,min=-90,max=90"`
+	Longitude *float64 `json:"longitude,omitempty" binding:"omitempty,min=-180,max=180"`
+}
+
+// LocationStock is a product's stock at one location
+type LocationStock struct {
+	LocationID     string   `json:"locationId"`
+	Name           string   `json:"name"`
+	Region         string   `json:"region"`
+	Latitude       *float64 `json:"latitude,omitempty"`
+	Longitude      *float64 `json:"longitude,omitempty"`
+	TotalStock     int      `json:"totalStock"`
+	AvailableStock int      `json:"availableStock"`
+	ReservedStock  int      `json:"reservedStock"`
+}
+
+// LocationAllocation is the part of a reservation held at one location
+type LocationAllocation struct {
+	LocationID string `json:"locationId"`
+	Quantity   int    `json:"quantity"`
+}
+
+// Allocation strategies, choosing the locations a reservation is held at
+const (
+	// The closest location that has the whole quantity
+	AllocationStrategyNearest = "nearest"
+	// The location with the most stock available
+	AllocationStrategyMostStock = "most_stock"
+	// As many locations as it takes, closest or fullest first
+	AllocationStrategySplit = "split"
+)
+
+// AllocationPolicy tells the processor where a reservation may be held.
+// Without a strategy, the nearest location is used when coordinates are
+// given and the one with the most stock otherwise.
+type AllocationPolicy struct {
+	Strategy   string   `json:"strategy,omitempty" binding:"omitempty,oneof=nearest most_stock split"`
+	LocationID string   `json:"locationId,omitempty" binding:"omitempty,max=50"`
+	Region     string   `json:"region,omitempty" binding:"omitempty,max=50"`
+	Latitude   *float64 `json:"latitude,omitempty" binding:"omitempty,min=-90,max=90"`
+	Longitude  *float64 `json:"longitude,omitempty" binding:"omitempty,min=-180,max=180"`
+}
+
+// IsZero reports whether the policy leaves every choice to the defaults
+func (p AllocationPolicy) IsZero() bool {
+	return p == (AllocationPolicy{})
+}
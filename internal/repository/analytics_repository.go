@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -8,11 +9,11 @@ import (
 )
 
 type AnalyticsRepository interface {
-	Create(analytics *models.Analytics) error
-	GetByURLID(urlID int, limit int) ([]models.Analytics, error)
-	GetTotalClicks(urlID int) (int, error)
-	GetUniqueIPs(urlID int) (int, error)
-	GetTopReferers(urlID int, limit int) ([]struct {
+	Create(ctx context.Context, analytics *models.Analytics) error
+	GetByURLID(ctx context.Context, urlID int, limit int) ([]models.Analytics, error)
+	GetTotalClicks(ctx context.Context, urlID int) (int, error)
+	GetUniqueIPs(ctx context.Context, urlID int) (int, error)
+	GetTopReferers(ctx context.Context, urlID int, limit int) ([]struct {
 		Referer string
 		Count   int
 	}, error)
@@ -26,14 +27,15 @@ func NewAnalyticsRepository(db *sql.DB) AnalyticsRepository {
 	return &analyticsRepository{db: db}
 }
 
-func (r *analyticsRepository) Create(analytics *models.Analytics) error {
+func (r *analyticsRepository) Create(ctx context.Context, analytics *models.Analytics) error {
 	query := `
 		INSERT INTO analytics (url_id, ip_address, user_agent, referer)
 		VALUES ($1, $2, $3, $4)
 		RETURNING id, clicked_at
 	`
 	
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(
+		ctx,
 		query,
 		analytics.URLID,
 		analytics.IPAddress,
@@ -48,7 +50,7 @@ func (r *analyticsRepository) Create(analytics *models.Analytics) error {
 	return nil
 }
 
-func (r *analyticsRepository) GetByURLID(urlID int, limit int) ([]models.Analytics, error) {
+func (r *analyticsRepository) GetByURLID(ctx context.Context, urlID int, limit int) ([]models.Analytics, error) {
 	query := `
 		SELECT id, url_id, ip_address, user_agent, referer, clicked_at
 		FROM analytics
@@ -57,7 +59,7 @@ func (r *analyticsRepository) GetByURLID(urlID int, limit int) ([]models.Analyti
 		LIMIT $2
 	`
 	
-	rows, err := r.db.Query(query, urlID, limit)
+	rows, err := r.db.QueryContext(ctx, query, urlID, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get analytics: %w", err)
 	}
@@ -83,11 +85,11 @@ func (r *analyticsRepository) GetByURLID(urlID int, limit int) ([]models.Analyti
 	return analytics, nil
 }
 
-func (r *analyticsRepository) GetTotalClicks(urlID int) (int, error) {
+func (r *analyticsRepository) GetTotalClicks(ctx context.Context, urlID int) (int, error) {
 	query := `SELECT COUNT(*) FROM analytics WHERE url_id = $1`
 	
 	var count int
-	err := r.db.QueryRow(query, urlID).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query, urlID).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get total clicks: %w", err)
 	}
@@ -95,11 +97,11 @@ func (r *analyticsRepository) GetTotalClicks(urlID int) (int, error) {
 	return count, nil
 }
 
-func (r *analyticsRepository) GetUniqueIPs(urlID int) (int, error) {
+func (r *analyticsRepository) GetUniqueIPs(ctx context.Context, urlID int) (int, error) {
 	query := `SELECT COUNT(DISTINCT ip_address) FROM analytics WHERE url_id = $1`
 	
 	var count int
-	err := r.db.QueryRow(query, urlID).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query, urlID).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get unique IPs: %w", err)
 	}
@@ -107,7 +109,7 @@ func (r *analyticsRepository) GetUniqueIPs(urlID int) (int, error) {
 	return count, nil
 }
 
-func (r *analyticsRepository) GetTopReferers(urlID int, limit int) ([]struct {
+func (r *analyticsRepository) GetTopReferers(ctx context.Context, urlID int, limit int) ([]struct {
 	Referer string
 	Count   int
 }, error) {
@@ -120,7 +122,7 @@ func (r *analyticsRepository) GetTopReferers(urlID int, limit int) ([]struct {
 		LIMIT $2
 	`
 	
-	rows, err := r.db.Query(query, urlID, limit)
+	rows, err := r.db.QueryContext(ctx, query, urlID, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get top referers: %w", err)
 	}
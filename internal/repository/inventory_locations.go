@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"url-shortener/internal/models"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrLocationNotFound is returned when a location does not exist
+	ErrLocationNotFound = errors.New("location not found")
+	// ErrLocationExists is returned when a location ID is already taken
+	ErrLocationExists = errors.New("location already exists")
+)
+
+// Allocator picks the locations quantity units of a product are reserved at
+// from the product's stock per location. It returns nil when the stock it may
+// use does not cover the quantity.
+type Allocator func(stock []models.LocationStock, quantity int) []models.LocationAllocation
+
+// querier reads rows on the database or inside a transaction
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// locationStockQuery selects a product's stock per location in location order
+const locationStockQuery = `
+	SELECT s.location_id, l.name, l.region, l.latitude, l.longitude,
+		s.total_stock, s.available_stock, s.reserved_stock
+	FROM product_stock s
+	JOIN locations l ON l.id = s.location_id
+	WHERE s.product_id = $1
+	ORDER BY s.location_id
+`
+
+// queryLocationStock returns a product's stock per location. query is
+// locationStockQuery, possibly with a locking clause.
+func queryLocationStock(ctx context.Context, db querier, query, productID string) ([]models.LocationStock, error) {
+	rows, err := db.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get location stock: %w", err)
+	}
+	defer rows.Close()
+
+	var stock []models.LocationStock
+	for rows.Next() {
+		var s models.LocationStock
+		var latitude, longitude sql.NullFloat64
+		if err := rows.Scan(&s.LocationID, &s.Name, &s.Region, &latitude, &longitude,
+			&s.TotalStock, &s.AvailableStock, &s.ReservedStock); err != nil {
+			return nil, fmt.Errorf("failed to scan location stock: %w", err)
+		}
+		s.Latitude = nullFloat(latitude)
+		s.Longitude = nullFloat(longitude)
+		stock = append(stock, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating location stock: %w", err)
+	}
+	return stock, nil
+}
+
+func nullFloat(f sql.NullFloat64) *float64 {
+	if !f.Valid {
+		return nil
+	}
+	return &f.Float64
+}
+
+// loadLocations sets the stock per location a change left product with, so
+// it is published along with the totals
+func loadLocations(ctx context.Context, tx *sql.Tx, product *models.Product) error {
+	stock, err := queryLocationStock(ctx, tx, locationStockQuery, product.ID)
+	if err != nil {
+		return err
+	}
+	product.Locations = stock
+	return nil
+}
+
+// ensureLocationStock makes sure a product has a stock row at a location. It
+// returns ErrLocationNotFound when the location does not exist.
+func ensureLocationStock(ctx context.Context, tx *sql.Tx, productID, locationID string) error {
+	query := `
+		INSERT INTO product_stock (product_id, location_id) VALUES ($1, $2)
+		ON CONFLICT (product_id, location_id) DO NOTHING
+	`
+	if _, err := tx.ExecContext(ctx, query, productID, locationID); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+			return ErrLocationNotFound
+		}
+		return fmt.Errorf("failed to create location stock: %w", err)
+	}
+	return nil
+}
+
+// adjustLocationStock applies relative stock changes to a product at one
+// location, provided its available and reserved stock there stay at least
+// zero. It returns ErrInsufficientStock when they would not. The product's
+// totals are changed by adjustStock first, which keeps the lock order
+// products, then product_stock, in every transaction.
+func adjustLocationStock(ctx context.Context, tx *sql.Tx, productID, locationID string, available, reserved, total int) error {
+	query := `
+		UPDATE product_stock
+		SET available_stock = available_stock + $3,
+			reserved_stock = reserved_stock + $4,
+			total_stock = total_stock + $5,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE product_id = $1 AND location_id = $2
+			AND available_stock + $3 >= 0 AND reserved_stock + $4 >= 0
+	`
+	result, err := tx.ExecContext(ctx, query, productID, locationID, available, reserved, total)
+	if err != nil {
+		return fmt.Errorf("failed to update location stock: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	return nil
+}
+
+// allocateStock locks a product's stock per location, lets allocate pick
+// where quantity units are reserved and moves them from available to
+// reserved stock there. It returns ErrInsufficientStock when allocate finds
+// no way to hold them.
+func allocateStock(ctx context.Context, tx *sql.Tx, productID string, quantity int, allocate Allocator) ([]models.LocationAllocation, error) {
+	stock, err := queryLocationStock(ctx, tx, locationStockQuery+` FOR UPDATE OF s`, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	allocations := allocate(stock, quantity)
+	if allocations == nil {
+		return nil, ErrInsufficientStock
+	}
+	for _, allocation := range allocations {
+		if err := adjustLocationStock(ctx, tx, productID, allocation.LocationID, -allocation.Quantity, allocation.Quantity, 0); err != nil {
+			return nil, err
+		}
+	}
+	return allocations, nil
+}
+
+// insertAllocations records where a reservation's stock is held
+func insertAllocations(ctx context.Context, tx *sql.Tx, reservationID string, allocations []models.LocationAllocation) error {
+	query := `INSERT INTO reservation_allocations (reservation_id, location_id, quantity) VALUES ($1, $2, $3)`
+	for _, allocation := range allocations {
+		if _, err := tx.ExecContext(ctx, query, reservationID, allocation.LocationID, allocation.Quantity); err != nil {
+			return fmt.Errorf("failed to record allocation: %w", err)
+		}
+	}
+	return nil
+}
+
+// queryAllocations returns where a reservation's stock is held
+func queryAllocations(ctx context.Context, db querier, reservationID string) ([]models.LocationAllocation, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT location_id, quantity FROM reservation_allocations
+		WHERE reservation_id = $1
+		ORDER BY location_id
+	`, reservationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get allocations: %w", err)
+	}
+	defer rows.Close()
+
+	var allocations []models.LocationAllocation
+	for rows.Next() {
+		var allocation models.LocationAllocation
+		if err := rows.Scan(&allocation.LocationID, &allocation.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan allocation: %w", err)
+		}
+		allocations = append(allocations, allocation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating allocations: %w", err)
+	}
+	return allocations, nil
+}
+
+// settleAllocations takes the stock a reservation held off the shelf at each
+// of its locations when confirmed, and returns it to available stock
+// otherwise
+func settleAllocations(ctx context.Context, tx *sql.Tx, reservation *models.UserReservation, confirmed bool) error {
+	allocations, err := queryAllocations(ctx, tx, reservation.ID)
+	if err != nil {
+		return err
+	}
+	for _, allocation := range allocations {
+		available, total := allocation.Quantity, 0
+		if confirmed {
+			available, total = 0, -allocation.Quantity
+		}
+		if err := adjustLocationStock(ctx, tx, reservation.ProductID, allocation.LocationID, available, -allocation.Quantity, total); err != nil {
+			return err
+		}
+	}
+	reservation.Allocations = allocations
+	return nil
+}
+
+// GetReservationAllocations returns where a reservation's stock is held
+func (r *inventoryRepository) GetReservationAllocations(ctx context.Context, reservationID string) ([]models.LocationAllocation, error) {
+	return queryAllocations(ctx, r.db, reservationID)
+}
+
+// GetLocationStock returns a product's stock per location
+func (r *inventoryRepository) GetLocationStock(ctx context.Context, productID string) ([]models.LocationStock, error) {
+	return queryLocationStock(ctx, r.db, locationStockQuery, productID)
+}
+
+// CreateLocation adds a location. It returns ErrLocationExists when the ID
+// is taken.
+func (r *inventoryRepository) CreateLocation(ctx context.Context, location *models.Location) error {
+	query := `
+		INSERT INTO locations (id, name, region, latitude, longitude)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at
+	`
+	err := r.db.QueryRowContext(ctx, query,
+		location.ID,
+		location.Name,
+		location.Region,
+		location.Latitude,
+		location.Longitude,
+	).Scan(&location.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return ErrLocationExists
+		}
+		return fmt.Errorf("failed to create location: %w", err)
+	}
+	return nil
+}
+
+// GetLocations returns every location ordered by ID
+func (r *inventoryRepository) GetLocations(ctx context.Context) ([]*models.Location, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, name, region, latitude, longitude, created_at
+		FROM locations
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get locations: %w", err)
+	}
+	defer rows.Close()
+
+	var locations []*models.Location
+	for rows.Next() {
+		location := &models.Location{}
+		var latitude, longitude sql.NullFloat64
+		if err := rows.Scan(&location.ID, &location.Name, &location.Region, &latitude, &longitude, &location.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan location: %w", err)
+		}
+		location.Latitude = nullFloat(latitude)
+		location.Longitude = nullFloat(longitude)
+		locations = append(locations, location)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating locations: %w", err)
+	}
+	return locations, nil
+}
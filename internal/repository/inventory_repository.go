@@ -3,35 +3,100 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"url-shortener/internal/models"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrProductNotFound is returned when no product has the requested ID
+	ErrProductNotFound = errors.New("product not found")
+	// ErrProductExists is returned when a product with the same ID exists
+	ErrProductExists = errors.New("product already exists")
+	// ErrProductInUse is returned when a product that still holds reserved
+	// stock is deleted
+	ErrProductInUse = errors.New("product has reserved stock")
+	// ErrReservationNotFound is returned when no reservation matches
+	ErrReservationNotFound = errors.New("reservation not found")
+	// ErrReservationNotExtendable is returned when a reservation is no longer
+	// active or may not be extended again
+	ErrReservationNotExtendable = errors.New("reservation cannot be extended")
+	// ErrOrderNotFound is returned when no order has the requested ID
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrOrderExists is returned when an order was already placed for a reservation
+	ErrOrderExists = errors.New("order already exists")
+	// ErrIdempotencyKeyExists is returned when a user already made a
+	// reservation with the same Idempotency-Key
+	ErrIdempotencyKeyExists = errors.New("idempotency key already used")
+)
+
+// Postgres error codes
+const (
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
 )
 
 // InventoryRepository defines the interface for inventory data operations
 type InventoryRepository interface {
-	// Product operations
-	CreateProduct(ctx context.Context, product *models.Product) error
+	// Product operations. Changes are recorded and queued in the outbox with
+	// the event describing them.
+	CreateProduct(ctx context.Context, product *models.Product, event *models.InventoryEvent, locationID string) error
 	GetProduct(ctx context.Context, productID string) (*models.Product, error)
-	UpdateProduct(ctx context.Context, product *models.Product) error
-	UpdateProductInventory(ctx context.Context, productID string, availableStock, reservedStock, version int) error
+	UpdateProduct(ctx context.Context, product *models.Product, event *models.InventoryEvent) error
+	DeleteProduct(ctx context.Context, event *models.InventoryEvent) error
 	GetAllProducts(ctx context.Context) ([]*models.Product, error)
+	GetInventoryMetrics(ctx context.Context, lowStockThreshold int) (*models.InventoryMetrics, error)
+
+	// Location operations. A product's stock is the sum of its stock at
+	// every location.
+	CreateLocation(ctx context.Context, location *models.Location) error
+	GetLocations(ctx context.Context) ([]*models.Location, error)
+	GetLocationStock(ctx context.Context, productID string) ([]models.LocationStock, error)
+	GetReservationAllocations(ctx context.Context, reservationID string) ([]models.LocationAllocation, error)
 
 	// Reservation operations
-	CreateReservation(ctx context.Context, reservation *models.UserReservation) error
+	CreateReservation(ctx context.Context, reservation *models.UserReservation, event *models.InventoryEvent) error
 	GetReservationByID(ctx context.Context, reservationID string) (*models.UserReservation, error)
 	GetReservationByOrderID(ctx context.Context, orderID uuid.UUID) (*models.UserReservation, error)
 	GetReservationByCorrelationID(ctx context.Context, correlationID uuid.UUID) (*models.UserReservation, error)
+	GetReservationByIdempotencyKey(ctx context.Context, userID, key string) (*models.UserReservation, error)
+	CreateReservationBatch(ctx context.Context, reservations []*models.UserReservation, event *models.InventoryEvent) error
+	GetReservationsByBatchID(ctx context.Context, batchID uuid.UUID) ([]*models.UserReservation, error)
+	RejectReservationBatch(ctx context.Context, batchID uuid.UUID, shortfalls []models.ItemShortfall, expiresAt time.Time) error
 	UpdateReservationStatus(ctx context.Context, reservationID, status string) error
+	ResolvePendingReservation(ctx context.Context, reservationID, status, reason string, expiresAt time.Time) error
+	ExtendReservation(ctx context.Context, reservationID string, expiresAt time.Time, maxExtensions int) (*models.UserReservation, error)
 	GetExpiredReservations(ctx context.Context) ([]*models.UserReservation, error)
-	GetUserReservations(ctx context.Context, userID string) ([]*models.UserReservation, error)
+	ExpirePendingReservations(ctx context.Context) (int64, error)
+	GetUserReservations(ctx context.Context, userID string, limit, offset int) ([]*models.UserReservation, int, error)
+
+	// Stock changes, each in one transaction with the event that caused it
+	// and the reservation it belongs to, if any
+	ReserveStock(ctx context.Context, event *models.InventoryEvent, reservation *models.UserReservation, pending bool, allocate Allocator) (*models.Product, error)
+	ReserveBatchStock(ctx context.Context, event *models.InventoryEvent, reservations []*models.UserReservation, allocate Allocator) ([]*models.Product, error)
+	ConfirmReservationStock(ctx context.Context, event *models.InventoryEvent, reservation *models.UserReservation) (*models.Product, error)
+	ReleaseReservationStock(ctx context.Context, event *models.InventoryEvent, reservation *models.UserReservation, status string) (*models.Product, error)
+	RestockProduct(ctx context.Context, event *models.InventoryEvent, locationID string) (*models.Product, error)
+	AdjustStock(ctx context.Context, event *models.InventoryEvent, counted *int, locationID string) (*models.Product, error)
+
+	// Order operations
+	CreateOrder(ctx context.Context, order *models.Order, event *models.InventoryEvent) error
+	GetOrder(ctx context.Context, orderID uuid.UUID) (*models.Order, error)
+	UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, status string) error
 
 	// Event operations
 	CreateInventoryEvent(ctx context.Context, event *models.InventoryEvent) error
 	GetInventoryEvents(ctx context.Context, productID string, limit int) ([]*models.InventoryEvent, error)
+
+	// Outbox operations
+	QueueEvent(ctx context.Context, event *models.InventoryEvent) error
+	RelayOutbox(ctx context.Context, limit int, publish func(*models.OutboxMessage) error) (int, error)
+	DeleteSentOutbox(ctx context.Context, before time.Time) (int64, error)
 }
 
 type inventoryRepository struct {
@@ -45,55 +110,60 @@ func NewInventoryRepository(db *sql.DB) InventoryRepository {
 
 // Product operations
 
-func (r *inventoryRepository) CreateProduct(ctx context.Context, product *models.Product) error {
+// CreateProduct inserts a product with its initial stock held at a
+// location, records the event and queues it in the outbox along with the
+// stock. It returns ErrProductExists when the ID is taken and
+// ErrLocationNotFound when the location does not exist.
+func (r *inventoryRepository) CreateProduct(ctx context.Context, product *models.Product, event *models.InventoryEvent, locationID string) error {
 	query := `
 		INSERT INTO products (id, name, description, price, total_stock, available_stock, reserved_stock, version)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING created_at, updated_at
 	`
 
-	err := r.db.QueryRowContext(ctx, query,
-		product.ID,
-		product.Name,
-		product.Description,
-		product.Price,
-		product.TotalStock,
-		product.AvailableStock,
-		product.ReservedStock,
-		product.Version,
-	).Scan(&product.CreatedAt, &product.UpdatedAt)
+	return r.runTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query,
+			product.ID,
+			product.Name,
+			product.Description,
+			product.Price,
+			product.TotalStock,
+			product.AvailableStock,
+			product.ReservedStock,
+			product.Version,
+		).Scan(&product.CreatedAt, &product.UpdatedAt)
 
-	if err != nil {
-		return fmt.Errorf("failed to create product: %w", err)
-	}
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+				return ErrProductExists
+			}
+			return fmt.Errorf("failed to create product: %w", err)
+		}
+		if err := ensureLocationStock(ctx, tx, product.ID, locationID); err != nil {
+			return err
+		}
+		if err := adjustLocationStock(ctx, tx, product.ID, locationID, product.AvailableStock, 0, product.TotalStock); err != nil {
+			return err
+		}
 
-	return nil
+		if err := recordEvent(ctx, tx, event); err != nil {
+			return err
+		}
+		if err := loadLocations(ctx, tx, product); err != nil {
+			return err
+		}
+		return queueChange(ctx, tx, event, product)
+	})
 }
 
 func (r *inventoryRepository) GetProduct(ctx context.Context, productID string) (*models.Product, error) {
-	query := `
-		SELECT id, name, description, price, total_stock, available_stock, reserved_stock, version, created_at, updated_at
-		FROM products
-		WHERE id = $1
-	`
-
-	product := &models.Product{}
-	err := r.db.QueryRowContext(ctx, query, productID).Scan(
-		&product.ID,
-		&product.Name,
-		&product.Description,
-		&product.Price,
-		&product.TotalStock,
-		&product.AvailableStock,
-		&product.ReservedStock,
-		&product.Version,
-		&product.CreatedAt,
-		&product.UpdatedAt,
-	)
+	query := `SELECT ` + productColumns + ` FROM products WHERE id = $1 AND deleted_at IS NULL`
 
+	product, err := scanProduct(r.db.QueryRowContext(ctx, query, productID))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("product not found")
+			return nil, ErrProductNotFound
 		}
 		return nil, fmt.Errorf("failed to get product: %w", err)
 	}
@@ -101,69 +171,93 @@ func (r *inventoryRepository) GetProduct(ctx context.Context, productID string)
 	return product, nil
 }
 
-func (r *inventoryRepository) UpdateProduct(ctx context.Context, product *models.Product) error {
+// UpdateProduct changes a product's name, description and price, records
+// the event and queues it in the outbox. The product is filled in with its
+// current stock.
+func (r *inventoryRepository) UpdateProduct(ctx context.Context, product *models.Product, event *models.InventoryEvent) error {
 	query := `
 		UPDATE products
-		SET name = $2, description = $3, price = $4, total_stock = $5, 
-		    available_stock = $6, reserved_stock = $7, version = $8, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $1
-	`
-
-	result, err := r.db.ExecContext(ctx, query,
-		product.ID,
-		product.Name,
-		product.Description,
-		product.Price,
-		product.TotalStock,
-		product.AvailableStock,
-		product.ReservedStock,
-		product.Version,
-	)
-
-	if err != nil {
-		return fmt.Errorf("failed to update product: %w", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
-	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("product not found")
-	}
+		SET name = $2, description = $3, price = $4, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING ` + productColumns
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		updated, err := scanProduct(tx.QueryRowContext(ctx, query,
+			product.ID,
+			product.Name,
+			product.Description,
+			product.Price,
+		))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrProductNotFound
+			}
+			return fmt.Errorf("failed to update product: %w", err)
+		}
+		*product = *updated
 
-	return nil
+		if err := recordEvent(ctx, tx, event); err != nil {
+			return err
+		}
+		if err := loadLocations(ctx, tx, product); err != nil {
+			return err
+		}
+		return queueChange(ctx, tx, event, product)
+	})
 }
 
-func (r *inventoryRepository) UpdateProductInventory(ctx context.Context, productID string, availableStock, reservedStock, version int) error {
-	query := `
-		UPDATE products
-		SET available_stock = $2, reserved_stock = $3, version = $4, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $1
-	`
-
-	result, err := r.db.ExecContext(ctx, query, productID, availableStock, reservedStock, version)
-	if err != nil {
-		return fmt.Errorf("failed to update product inventory: %w", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
-	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("product not found")
-	}
+// DeleteProduct marks the event's product deleted and writes off its
+// available stock, which becomes the event's quantity. It returns
+// ErrProductInUse while reservations hold some of its stock.
+func (r *inventoryRepository) DeleteProduct(ctx context.Context, event *models.InventoryEvent) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		var available, reserved int
+		err := tx.QueryRowContext(ctx, `
+			SELECT available_stock, reserved_stock FROM products
+			WHERE id = $1 AND deleted_at IS NULL
+			FOR UPDATE
+		`, event.ProductID).Scan(&available, &reserved)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrProductNotFound
+			}
+			return fmt.Errorf("failed to get product: %w", err)
+		}
+		if reserved > 0 {
+			return ErrProductInUse
+		}
+		event.Quantity = available
+
+		query := `
+			UPDATE products
+			SET deleted_at = CURRENT_TIMESTAMP, total_stock = 0, available_stock = 0,
+				version = version + 1, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+			RETURNING ` + productColumns
+		product, err := scanProduct(tx.QueryRowContext(ctx, query, event.ProductID))
+		if err != nil {
+			return fmt.Errorf("failed to delete product: %w", err)
+		}
+		query = `UPDATE product_stock SET total_stock = 0, available_stock = 0, updated_at = CURRENT_TIMESTAMP WHERE product_id = $1`
+		if _, err := tx.ExecContext(ctx, query, event.ProductID); err != nil {
+			return fmt.Errorf("failed to delete location stock: %w", err)
+		}
 
-	return nil
+		if err := recordEvent(ctx, tx, event); err != nil {
+			return err
+		}
+		if err := loadLocations(ctx, tx, product); err != nil {
+			return err
+		}
+		return queueChange(ctx, tx, event, product)
+	})
 }
 
 func (r *inventoryRepository) GetAllProducts(ctx context.Context) ([]*models.Product, error) {
 	query := `
 		SELECT id, name, description, price, total_stock, available_stock, reserved_stock, version, created_at, updated_at
 		FROM products
+		WHERE deleted_at IS NULL
 		ORDER BY created_at DESC
 	`
 
@@ -201,117 +295,239 @@ func (r *inventoryRepository) GetAllProducts(ctx context.Context) ([]*models.Pro
 	return products, nil
 }
 
-// Reservation operations
-
-func (r *inventoryRepository) CreateReservation(ctx context.Context, reservation *models.UserReservation) error {
+func (r *inventoryRepository) GetInventoryMetrics(ctx context.Context, lowStockThreshold int) (*models.InventoryMetrics, error) {
 	query := `
-		INSERT INTO user_reservations (id, user_id, product_id, quantity, reserved_at, expires_at, status, correlation_id)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(total_stock), 0),
+			COALESCE(SUM(available_stock), 0),
+			COALESCE(SUM(reserved_stock), 0),
+			COUNT(*) FILTER (WHERE available_stock < $1),
+			COUNT(*) FILTER (WHERE available_stock = 0),
+			MAX(updated_at)
+		FROM products
+		WHERE deleted_at IS NULL
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
-		reservation.ID,
-		reservation.UserID,
-		reservation.ProductID,
-		reservation.Quantity,
-		reservation.ReservedAt,
-		reservation.ExpiresAt,
-		reservation.Status,
-		reservation.CorrelationID,
+	metrics := &models.InventoryMetrics{}
+	var lastUpdated sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, lowStockThreshold).Scan(
+		&metrics.TotalProducts,
+		&metrics.TotalStock,
+		&metrics.AvailableStock,
+		&metrics.ReservedStock,
+		&metrics.LowStockProducts,
+		&metrics.OutOfStockProducts,
+		&lastUpdated,
 	)
-
 	if err != nil {
-		return fmt.Errorf("failed to create reservation: %w", err)
+		return nil, fmt.Errorf("failed to get inventory metrics: %w", err)
 	}
 
-	return nil
+	if lastUpdated.Valid {
+		metrics.LastUpdated = &lastUpdated.Time
+	}
+
+	return metrics, nil
 }
 
-func (r *inventoryRepository) GetReservationByID(ctx context.Context, reservationID string) (*models.UserReservation, error) {
-	query := `
-		SELECT id, user_id, product_id, quantity, reserved_at, expires_at, status, correlation_id
-		FROM user_reservations
-		WHERE id = $1
-	`
+// Reservation operations
 
+// reservationColumns are the columns read by scanReservation
+const reservationColumns = `id, order_id, user_id, product_id, quantity, reserved_at, expires_at, status, COALESCE(reason, ''), extensions, correlation_id, COALESCE(idempotency_key, ''), batch_id`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanReservation(row rowScanner) (*models.UserReservation, error) {
 	reservation := &models.UserReservation{}
-	err := r.db.QueryRowContext(ctx, query, reservationID).Scan(
+	err := row.Scan(
 		&reservation.ID,
+		&reservation.OrderID,
 		&reservation.UserID,
 		&reservation.ProductID,
 		&reservation.Quantity,
 		&reservation.ReservedAt,
 		&reservation.ExpiresAt,
 		&reservation.Status,
+		&reservation.Reason,
+		&reservation.Extensions,
 		&reservation.CorrelationID,
+		&reservation.IdempotencyKey,
+		&reservation.BatchID,
 	)
+	return reservation, err
+}
 
+// queryReservation returns the single reservation selected by query
+func (r *inventoryRepository) queryReservation(ctx context.Context, query string, args ...interface{}) (*models.UserReservation, error) {
+	reservation, err := scanReservation(r.db.QueryRowContext(ctx, query, args...))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("reservation not found")
+			return nil, ErrReservationNotFound
 		}
 		return nil, fmt.Errorf("failed to get reservation: %w", err)
 	}
-
 	return reservation, nil
 }
 
-func (r *inventoryRepository) GetReservationByOrderID(ctx context.Context, orderID uuid.UUID) (*models.UserReservation, error) {
+// queryReservations returns every reservation selected by query
+func (r *inventoryRepository) queryReservations(ctx context.Context, query string, args ...interface{}) ([]*models.UserReservation, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reservations []*models.UserReservation
+	for rows.Next() {
+		reservation, err := scanReservation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan reservation: %w", err)
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reservations: %w", err)
+	}
+
+	return reservations, nil
+}
+
+// CreateReservation records a reservation. When event is not nil it is
+// queued in the outbox in the same transaction. It returns
+// ErrProductNotFound when the product does not exist.
+func (r *inventoryRepository) CreateReservation(ctx context.Context, reservation *models.UserReservation, event *models.InventoryEvent) error {
+	return r.runTx(ctx, func(tx *sql.Tx) error {
+		if err := insertReservation(ctx, tx, reservation); err != nil {
+			return err
+		}
+		if event == nil {
+			return nil
+		}
+		return queueEvent(ctx, tx, event)
+	})
+}
+
+func insertReservation(ctx context.Context, db execer, reservation *models.UserReservation) error {
 	query := `
-		SELECT id, user_id, product_id, quantity, reserved_at, expires_at, status, correlation_id
-		FROM user_reservations
-		WHERE correlation_id = $1
+		INSERT INTO user_reservations (id, order_id, user_id, product_id, quantity, reserved_at, expires_at, status, reason, correlation_id, idempotency_key, batch_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, NULLIF($11, ''), $12)
 	`
 
-	reservation := &models.UserReservation{}
-	err := r.db.QueryRowContext(ctx, query, orderID).Scan(
-		&reservation.ID,
-		&reservation.UserID,
-		&reservation.ProductID,
-		&reservation.Quantity,
-		&reservation.ReservedAt,
-		&reservation.ExpiresAt,
-		&reservation.Status,
-		&reservation.CorrelationID,
+	_, err := db.ExecContext(ctx, query,
+		reservation.ID,
+		reservation.OrderID,
+		reservation.UserID,
+		reservation.ProductID,
+		reservation.Quantity,
+		reservation.ReservedAt,
+		reservation.ExpiresAt,
+		reservation.Status,
+		reservation.Reason,
+		reservation.CorrelationID,
+		reservation.IdempotencyKey,
+		reservation.BatchID,
 	)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("reservation not found")
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+			return ErrProductNotFound
 		}
-		return nil, fmt.Errorf("failed to get reservation: %w", err)
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && reservation.IdempotencyKey != "" {
+			return ErrIdempotencyKeyExists
+		}
+		return fmt.Errorf("failed to create reservation: %w", err)
 	}
 
-	return reservation, nil
+	return nil
 }
 
-func (r *inventoryRepository) GetReservationByCorrelationID(ctx context.Context, correlationID uuid.UUID) (*models.UserReservation, error) {
-	query := `
-		SELECT id, user_id, product_id, quantity, reserved_at, expires_at, status, correlation_id
-		FROM user_reservations
-		WHERE correlation_id = $1
-	`
+// CreateReservationBatch records the reservations of a batch and queues
+// event in the outbox in one transaction. It returns a *ShortfallError
+// naming the products that do not exist.
+func (r *inventoryRepository) CreateReservationBatch(ctx context.Context, reservations []*models.UserReservation, event *models.InventoryEvent) error {
+	productIDs := make([]string, len(reservations))
+	for i, reservation := range reservations {
+		productIDs[i] = reservation.ProductID
+	}
 
-	reservation := &models.UserReservation{}
-	err := r.db.QueryRowContext(ctx, query, correlationID).Scan(
-		&reservation.ID,
-		&reservation.UserID,
-		&reservation.ProductID,
-		&reservation.Quantity,
-		&reservation.ReservedAt,
-		&reservation.ExpiresAt,
-		&reservation.Status,
-		&reservation.CorrelationID,
-	)
+	return r.runTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT id FROM products WHERE id = ANY($1) AND deleted_at IS NULL`, pq.Array(productIDs))
+		if err != nil {
+			return fmt.Errorf("failed to get products: %w", err)
+		}
+		found := make(map[string]bool)
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan product: %w", err)
+			}
+			found[id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating products: %w", err)
+		}
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("reservation not found")
+		var shortfalls []models.ItemShortfall
+		for _, reservation := range reservations {
+			if !found[reservation.ProductID] {
+				shortfalls = append(shortfalls, models.ItemShortfall{
+					ProductID: reservation.ProductID,
+					Requested: reservation.Quantity,
+					Reason:    models.ReservationRejectedProductNotFound,
+				})
+			}
 		}
-		return nil, fmt.Errorf("failed to get reservation: %w", err)
+		if len(shortfalls) > 0 {
+			return &ShortfallError{Shortfalls: shortfalls}
+		}
+
+		for _, reservation := range reservations {
+			if err := insertReservation(ctx, tx, reservation); err != nil {
+				return err
+			}
+		}
+		return queueEvent(ctx, tx, event)
+	})
+}
+
+func (r *inventoryRepository) GetReservationByID(ctx context.Context, reservationID string) (*models.UserReservation, error) {
+	query := `SELECT ` + reservationColumns + ` FROM user_reservations WHERE id = $1`
+	return r.queryReservation(ctx, query, reservationID)
+}
+
+func (r *inventoryRepository) GetReservationByOrderID(ctx context.Context, orderID uuid.UUID) (*models.UserReservation, error) {
+	query := `SELECT ` + reservationColumns + ` FROM user_reservations WHERE order_id = $1`
+	return r.queryReservation(ctx, query, orderID)
+}
+
+func (r *inventoryRepository) GetReservationByCorrelationID(ctx context.Context, correlationID uuid.UUID) (*models.UserReservation, error) {
+	query := `SELECT ` + reservationColumns + ` FROM user_reservations WHERE correlation_id = $1`
+	return r.queryReservation(ctx, query, correlationID)
+}
+
+// GetReservationsByBatchID returns the reservations of a batch ordered by
+// product ID
+func (r *inventoryRepository) GetReservationsByBatchID(ctx context.Context, batchID uuid.UUID) ([]*models.UserReservation, error) {
+	query := `SELECT ` + reservationColumns + ` FROM user_reservations WHERE batch_id = $1 ORDER BY product_id`
+	reservations, err := r.queryReservations(ctx, query, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch reservations: %w", err)
 	}
+	return reservations, nil
+}
 
-	return reservation, nil
+// GetReservationByIdempotencyKey returns the reservation a user made with an
+// Idempotency-Key
+func (r *inventoryRepository) GetReservationByIdempotencyKey(ctx context.Context, userID, key string) (*models.UserReservation, error) {
+	query := `SELECT ` + reservationColumns + ` FROM user_reservations WHERE user_id = $1 AND idempotency_key = $2`
+	return r.queryReservation(ctx, query, userID, key)
 }
 
 func (r *inventoryRepository) UpdateReservationStatus(ctx context.Context, reservationID, status string) error {
@@ -332,117 +548,249 @@ func (r *inventoryRepository) UpdateReservationStatus(ctx context.Context, reser
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("reservation not found")
+		return ErrReservationNotFound
 	}
 
 	return nil
 }
 
-func (r *inventoryRepository) GetExpiredReservations(ctx context.Context) ([]*models.UserReservation, error) {
+// ResolvePendingReservation records the processor's outcome for a pending
+// reservation. It returns ErrReservationNotFound when the reservation is not
+// pending.
+func (r *inventoryRepository) ResolvePendingReservation(ctx context.Context, reservationID, status, reason string, expiresAt time.Time) error {
 	query := `
-		SELECT id, user_id, product_id, quantity, reserved_at, expires_at, status, correlation_id
-		FROM user_reservations
-		WHERE expires_at < $1 AND status = 'ACTIVE'
+		UPDATE user_reservations
+		SET status = $2, reason = NULLIF($3, ''), expires_at = $4
+		WHERE id = $1 AND status = 'PENDING'
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, time.Now())
+	result, err := r.db.ExecContext(ctx, query, reservationID, status, reason, expiresAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get expired reservations: %w", err)
+		return fmt.Errorf("failed to resolve reservation: %w", err)
 	}
-	defer rows.Close()
 
-	var reservations []*models.UserReservation
-	for rows.Next() {
-		reservation := &models.UserReservation{}
-		err := rows.Scan(
-			&reservation.ID,
-			&reservation.UserID,
-			&reservation.ProductID,
-			&reservation.Quantity,
-			&reservation.ReservedAt,
-			&reservation.ExpiresAt,
-			&reservation.Status,
-			&reservation.CorrelationID,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan reservation: %w", err)
-		}
-		reservations = append(reservations, reservation)
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating reservations: %w", err)
+	if rowsAffected == 0 {
+		return ErrReservationNotFound
+	}
+
+	return nil
+}
+
+// RejectReservationBatch rejects the pending reservations of a batch in one
+// statement. Items that fell short get the reason in shortfalls, the others
+// ReservationRejectedBatch.
+func (r *inventoryRepository) RejectReservationBatch(ctx context.Context, batchID uuid.UUID, shortfalls []models.ItemShortfall, expiresAt time.Time) error {
+	productIDs := make([]string, len(shortfalls))
+	reasons := make([]string, len(shortfalls))
+	for i, shortfall := range shortfalls {
+		productIDs[i] = shortfall.ProductID
+		reasons[i] = shortfall.Reason
+	}
+
+	query := `
+		UPDATE user_reservations
+		SET status = 'REJECTED',
+			reason = COALESCE((
+				SELECT s.reason FROM unnest($2::uuid[], $3::text[]) AS s(product_id, reason)
+				WHERE s.product_id = user_reservations.product_id
+			), $4),
+			expires_at = $5
+		WHERE batch_id = $1 AND status = 'PENDING'
+	`
+
+	_, err := r.db.ExecContext(ctx, query, batchID, pq.Array(productIDs), pq.Array(reasons), models.ReservationRejectedBatch, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to reject batch reservations: %w", err)
+	}
+	return nil
+}
+
+// ExtendReservation moves the expiry of an active, unexpired reservation that
+// was extended fewer than maxExtensions times. It returns
+// ErrReservationNotExtendable otherwise.
+func (r *inventoryRepository) ExtendReservation(ctx context.Context, reservationID string, expiresAt time.Time, maxExtensions int) (*models.UserReservation, error) {
+	query := `
+		UPDATE user_reservations
+		SET expires_at = $2, extensions = extensions + 1
+		WHERE id = $1 AND status = 'ACTIVE' AND expires_at > $4 AND expires_at < $2 AND extensions < $3
+		RETURNING ` + reservationColumns
+
+	reservation, err := scanReservation(r.db.QueryRowContext(ctx, query, reservationID, expiresAt, maxExtensions, time.Now()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrReservationNotExtendable
+		}
+		return nil, fmt.Errorf("failed to extend reservation: %w", err)
 	}
+	return reservation, nil
+}
+
+func (r *inventoryRepository) GetExpiredReservations(ctx context.Context) ([]*models.UserReservation, error) {
+	query := `SELECT ` + reservationColumns + ` FROM user_reservations WHERE expires_at < $1 AND status = 'ACTIVE'`
 
+	reservations, err := r.queryReservations(ctx, query, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired reservations: %w", err)
+	}
 	return reservations, nil
 }
 
-func (r *inventoryRepository) GetUserReservations(ctx context.Context, userID string) ([]*models.UserReservation, error) {
+// ExpirePendingReservations expires pending reservations whose event was never
+// processed. They hold no stock, so no release is needed; the reason tells
+// them apart from holds that expired after being reserved.
+func (r *inventoryRepository) ExpirePendingReservations(ctx context.Context) (int64, error) {
 	query := `
-		SELECT id, user_id, product_id, quantity, reserved_at, expires_at, status, correlation_id
+		UPDATE user_reservations
+		SET status = 'EXPIRED', reason = $2
+		WHERE expires_at < $1 AND status = 'PENDING'
+	`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), models.ReservationExpiredUnprocessed)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire pending reservations: %w", err)
+	}
+
+	expired, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return expired, nil
+}
+
+// GetUserReservations returns a page of the user's reservations, newest
+// first, and how many the user has in total
+func (r *inventoryRepository) GetUserReservations(ctx context.Context, userID string, limit, offset int) ([]*models.UserReservation, int, error) {
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_reservations WHERE user_id = $1`, userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count user reservations: %w", err)
+	}
+
+	query := `
+		SELECT ` + reservationColumns + `
 		FROM user_reservations
 		WHERE user_id = $1
-		ORDER BY reserved_at DESC
+		ORDER BY reserved_at DESC, id
+		LIMIT $2 OFFSET $3
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, userID)
+	reservations, err := r.queryReservations(ctx, query, userID, limit, offset)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user reservations: %w", err)
+		return nil, 0, fmt.Errorf("failed to get user reservations: %w", err)
 	}
-	defer rows.Close()
+	return reservations, total, nil
+}
+
+// Order operations
+
+// CreateOrder places an order at the product's current price and fills in
+// the price, total amount and timestamps. When event is not nil it is queued
+// in the outbox in the same transaction. It returns ErrOrderExists when the
+// order was already placed and ErrProductNotFound when the product is gone.
+func (r *inventoryRepository) CreateOrder(ctx context.Context, order *models.Order, event *models.InventoryEvent) error {
+	query := `
+		INSERT INTO orders (id, user_id, product_id, quantity, price, total_amount, status, correlation_id)
+		SELECT $1, $2, p.id, $3, p.price, p.price * $3, $4, $5
+		FROM products p
+		WHERE p.id = $6
+		RETURNING price, total_amount, created_at, updated_at
+	`
+
+	return r.runTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query,
+			order.ID,
+			order.UserID,
+			order.Quantity,
+			order.Status,
+			order.CorrelationID,
+			order.ProductID,
+		).Scan(&order.Price, &order.TotalAmount, &order.CreatedAt, &order.UpdatedAt)
 
-	var reservations []*models.UserReservation
-	for rows.Next() {
-		reservation := &models.UserReservation{}
-		err := rows.Scan(
-			&reservation.ID,
-			&reservation.UserID,
-			&reservation.ProductID,
-			&reservation.Quantity,
-			&reservation.ReservedAt,
-			&reservation.ExpiresAt,
-			&reservation.Status,
-			&reservation.CorrelationID,
-		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan reservation: %w", err)
+			var pqErr *pq.Error
+			switch {
+			case err == sql.ErrNoRows:
+				return ErrProductNotFound
+			case errors.As(err, &pqErr) && pqErr.Code == uniqueViolation:
+				return ErrOrderExists
+			}
+			return fmt.Errorf("failed to create order: %w", err)
 		}
-		reservations = append(reservations, reservation)
-	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating reservations: %w", err)
+		if event == nil {
+			return nil
+		}
+		return queueEvent(ctx, tx, event)
+	})
+}
+
+func (r *inventoryRepository) GetOrder(ctx context.Context, orderID uuid.UUID) (*models.Order, error) {
+	query := `
+		SELECT id, user_id, product_id, quantity, price, total_amount, status, created_at, updated_at, correlation_id
+		FROM orders
+		WHERE id = $1
+	`
+
+	order := &models.Order{}
+	err := r.db.QueryRowContext(ctx, query, orderID).Scan(
+		&order.ID,
+		&order.UserID,
+		&order.ProductID,
+		&order.Quantity,
+		&order.Price,
+		&order.TotalAmount,
+		&order.Status,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+		&order.CorrelationID,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
 
-	return reservations, nil
+	return order, nil
 }
 
-// Event operations
-
-func (r *inventoryRepository) CreateInventoryEvent(ctx context.Context, event *models.InventoryEvent) error {
+func (r *inventoryRepository) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, status string) error {
 	query := `
-		INSERT INTO inventory_events (id, event_id, event_type, product_id, user_id, quantity, correlation_id, metadata)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		UPDATE orders
+		SET status = $2
+		WHERE id = $1
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
-		uuid.New().String(),
-		event.EventID,
-		event.EventType,
-		event.ProductID,
-		event.UserID,
-		event.Quantity,
-		event.CorrelationID,
-		nil, // metadata - would need JSON serialization
-	)
+	result, err := r.db.ExecContext(ctx, query, orderID, status)
+	if err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
 
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to create inventory event: %w", err)
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrOrderNotFound
 	}
 
 	return nil
 }
 
+// Event operations
+
+// CreateInventoryEvent records an event as processed. It returns
+// ErrDuplicateEvent when the event was recorded before.
+func (r *inventoryRepository) CreateInventoryEvent(ctx context.Context, event *models.InventoryEvent) error {
+	return recordEvent(ctx, r.db, event)
+}
+
 func (r *inventoryRepository) GetInventoryEvents(ctx context.Context, productID string, limit int) ([]*models.InventoryEvent, error) {
 	query := `
 		SELECT event_id, event_type, product_id, user_id, quantity, correlation_id, processed_at
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"url-shortener/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// orderDB is an orders table behind a database/sql driver. Orders are
+// priced from prices the way the INSERT ... SELECT from products does.
+type orderDB struct {
+	prices  map[string]float64
+	orders  map[string]bool
+	queued  []string // outbox kinds
+	inserts [][]driver.NamedValue
+}
+
+func (db *orderDB) Connect(context.Context) (driver.Conn, error) { return &orderConn{db: db}, nil }
+func (db *orderDB) Driver() driver.Driver                        { return nil }
+
+type orderConn struct {
+	db     *orderDB
+	queued []string
+}
+
+func (c *orderConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *orderConn) Close() error                        { return nil }
+func (c *orderConn) Begin() (driver.Tx, error)           { return c, nil }
+
+func (c *orderConn) Commit() error {
+	c.db.queued = append(c.db.queued, c.queued...)
+	c.queued = nil
+	return nil
+}
+
+func (c *orderConn) Rollback() error {
+	c.queued = nil
+	return nil
+}
+
+func (c *orderConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if !strings.Contains(query, "INSERT INTO orders") {
+		return nil, errors.New("unexpected query")
+	}
+	c.db.inserts = append(c.db.inserts, args)
+
+	orderID, quantity, productID := args[0].Value.(string), args[2].Value.(int64), args[5].Value.(string)
+	price, ok := c.db.prices[productID]
+	if !ok {
+		return &orderRows{}, nil
+	}
+	if c.db.orders[orderID] {
+		return nil, &pq.Error{Code: uniqueViolation}
+	}
+	c.db.orders[orderID] = true
+
+	now := time.Now()
+	return &orderRows{values: [][]driver.Value{{price, price * float64(quantity), now, now}}}, nil
+}
+
+func (c *orderConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if !strings.Contains(query, "INSERT INTO outbox") {
+		return nil, errors.New("unexpected statement")
+	}
+	c.queued = append(c.queued, args[0].Value.(string))
+	return driver.RowsAffected(1), nil
+}
+
+type orderRows struct {
+	values [][]driver.Value
+}
+
+func (r *orderRows) Columns() []string {
+	return []string{"price", "total_amount", "created_at", "updated_at"}
+}
+func (r *orderRows) Close() error { return nil }
+
+func (r *orderRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestCreateOrder(t *testing.T) {
+	const productID = "0b3c1f2e-5d41-4c1a-9e7f-1a2b3c4d5e6f"
+	db := &orderDB{prices: map[string]float64{productID: 19.99}, orders: map[string]bool{}}
+	repo := NewInventoryRepository(sql.OpenDB(db))
+
+	order := &models.Order{
+		ID:        uuid.New(),
+		UserID:    "user",
+		ProductID: productID,
+		Quantity:  3,
+		// Whatever the caller priced the order at is ignored
+		Price:       0.01,
+		TotalAmount: 0.03,
+		Status:      models.OrderStatusPending,
+	}
+	event := &models.InventoryEvent{EventType: models.InventoryEventTypeConfirm, ProductID: productID}
+	require.NoError(t, repo.CreateOrder(context.Background(), order, event))
+
+	assert.Equal(t, 19.99, order.Price)
+	assert.InDelta(t, 59.97, order.TotalAmount, 1e-9)
+	assert.False(t, order.CreatedAt.IsZero())
+	for _, arg := range db.inserts[0] {
+		assert.NotEqual(t, 0.01, arg.Value, "the caller's price reached the database")
+	}
+	assert.Equal(t, []string{models.OutboxKindInventoryEvent}, db.queued)
+
+	// Confirming the reservation again places no second order or event
+	again := *order
+	err := repo.CreateOrder(context.Background(), &again, event)
+	assert.ErrorIs(t, err, ErrOrderExists)
+	assert.Len(t, db.queued, 1)
+
+	unknown := &models.Order{ID: uuid.New(), ProductID: "7f6e5d4c-3b2a-4190-8f7e-6d5c4b3a2910", Quantity: 1}
+	assert.ErrorIs(t, repo.CreateOrder(context.Background(), unknown, event), ErrProductNotFound)
+	assert.Len(t, db.queued, 1)
+}
@@ -0,0 +1,538 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"url-shortener/internal/models"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrInsufficientStock is returned when a product has too little stock
+	// available for a reservation
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrReservationChanged is returned when a reservation is no longer in
+	// the status a stock change expects, typically because the event that
+	// caused the change was delivered again
+	ErrReservationChanged = errors.New("reservation status changed")
+	// ErrDuplicateEvent is returned when an event was already processed
+	ErrDuplicateEvent = errors.New("event already processed")
+)
+
+// Postgres error codes of transactions that can succeed when run again
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// txAttempts bounds how often a transaction aborted by a conflict is retried
+const txAttempts = 3
+
+// productColumns are the columns read by scanProduct
+const productColumns = `id, name, description, price, total_stock, available_stock, reserved_stock, version, created_at, updated_at`
+
+func scanProduct(row rowScanner) (*models.Product, error) {
+	product := &models.Product{}
+	err := row.Scan(
+		&product.ID,
+		&product.Name,
+		&product.Description,
+		&product.Price,
+		&product.TotalStock,
+		&product.AvailableStock,
+		&product.ReservedStock,
+		&product.Version,
+		&product.CreatedAt,
+		&product.UpdatedAt,
+	)
+	return product, err
+}
+
+// inTx runs fn in a transaction and commits it, running it again when
+// Postgres aborts it on a serialization failure or deadlock
+func (r *inventoryRepository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	var err error
+	for attempt := 1; attempt <= txAttempts; attempt++ {
+		if err = r.runTx(ctx, fn); !retryable(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * 10 * time.Millisecond):
+		}
+	}
+	return err
+}
+
+func (r *inventoryRepository) runTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func retryable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == serializationFailure || pqErr.Code == deadlockDetected)
+}
+
+// execer runs statements on the database or inside a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// recordEvent adds an event to the ledger of processed events and returns
+// ErrDuplicateEvent when it is already there. Recorded in the transaction of
+// the change the event caused, a redelivered event is never applied twice.
+func recordEvent(ctx context.Context, db execer, event *models.InventoryEvent) error {
+	var metadata []byte
+	if len(event.Metadata) > 0 {
+		var err error
+		if metadata, err = json.Marshal(event.Metadata); err != nil {
+			return fmt.Errorf("failed to encode event metadata: %w", err)
+		}
+	}
+
+	query := `
+		INSERT INTO inventory_events (event_id, event_type, product_id, user_id, quantity, correlation_id, metadata)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5, $6, $7)
+		ON CONFLICT (event_id) DO NOTHING
+	`
+
+	result, err := db.ExecContext(ctx, query,
+		event.EventID,
+		event.EventType,
+		event.ProductID,
+		event.UserID,
+		event.Quantity,
+		event.CorrelationID,
+		metadata,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+			return ErrProductNotFound
+		}
+		return fmt.Errorf("failed to create inventory event: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrDuplicateEvent
+	}
+	return nil
+}
+
+// adjustStock applies relative stock changes to a product, provided its
+// available and reserved stock stay at least zero, and returns the result.
+// It returns ErrInsufficientStock when they would not and
+// ErrProductNotFound when the product does not exist or was deleted.
+func adjustStock(ctx context.Context, tx *sql.Tx, productID string, available, reserved, total int) (*models.Product, error) {
+	query := `
+		UPDATE products
+		SET available_stock = available_stock + $2,
+			reserved_stock = reserved_stock + $3,
+			total_stock = total_stock + $4,
+			version = version + 1,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL AND available_stock + $2 >= 0 AND reserved_stock + $3 >= 0
+		RETURNING ` + productColumns
+
+	product, err := scanProduct(tx.QueryRowContext(ctx, query, productID, available, reserved, total))
+	if err == nil {
+		return product, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to update product stock: %w", err)
+	}
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM products WHERE id = $1 AND deleted_at IS NULL)`, productID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+	if !exists {
+		return nil, ErrProductNotFound
+	}
+	return nil, ErrInsufficientStock
+}
+
+// setReservationStatus moves a reservation from one status to another and
+// returns ErrReservationChanged when it was not in the expected status. A
+// reservation only expires once its hold has run out, so one extended after
+// it was found expired is left as it is.
+func setReservationStatus(ctx context.Context, tx *sql.Tx, reservationID, from, to string, expiresAt *time.Time) error {
+	query := `
+		UPDATE user_reservations
+		SET status = $3, expires_at = COALESCE($4, expires_at)
+		WHERE id = $1 AND status = $2
+	`
+	args := []interface{}{reservationID, from, to, expiresAt}
+	if to == models.ReservationStatusExpired {
+		query += ` AND expires_at <= $5`
+		args = append(args, time.Now())
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update reservation status: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrReservationChanged
+	}
+	return nil
+}
+
+// ReserveStock moves a reservation's quantity from available to reserved
+// stock at the locations allocate picks, activates the reservation, records
+// the event and queues the new stock in the outbox in one transaction. A
+// pending reservation is activated in place, any other is inserted as
+// active. It returns the product's new stock and sets the reservation's
+// allocations.
+func (r *inventoryRepository) ReserveStock(ctx context.Context, event *models.InventoryEvent, reservation *models.UserReservation, pending bool, allocate Allocator) (*models.Product, error) {
+	var product *models.Product
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := recordEvent(ctx, tx, event); err != nil {
+			return err
+		}
+
+		var err error
+		product, err = adjustStock(ctx, tx, reservation.ProductID, -reservation.Quantity, reservation.Quantity, 0)
+		if err != nil {
+			return err
+		}
+		allocations, err := allocateStock(ctx, tx, reservation.ProductID, reservation.Quantity, allocate)
+		if err != nil {
+			return err
+		}
+
+		if pending {
+			err = setReservationStatus(ctx, tx, reservation.ID, models.ReservationStatusPending, models.ReservationStatusActive, &reservation.ExpiresAt)
+		} else {
+			reservation.Status = models.ReservationStatusActive
+			err = insertReservation(ctx, tx, reservation)
+		}
+		if err != nil {
+			return err
+		}
+		if err := insertAllocations(ctx, tx, reservation.ID, allocations); err != nil {
+			return err
+		}
+		reservation.Allocations = allocations
+
+		if err := loadLocations(ctx, tx, product); err != nil {
+			return err
+		}
+		return queueState(ctx, tx, product)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// ShortfallError is returned when some items of a batch cannot be reserved.
+// Nothing of the batch is reserved.
+type ShortfallError struct {
+	Shortfalls []models.ItemShortfall
+}
+
+func (e *ShortfallError) Error() string {
+	return fmt.Sprintf("%d of the batch items cannot be reserved", len(e.Shortfalls))
+}
+
+// ReserveBatchStock reserves the stock of every pending reservation of a
+// batch, activates them, records the event and queues the new stock in the
+// outbox in one transaction, or returns a *ShortfallError naming each item
+// that cannot be reserved and changes nothing. Each item is held at the
+// locations allocate picks. The products are locked in ID order so batches
+// sharing products cannot deadlock. It returns the products' new stock.
+func (r *inventoryRepository) ReserveBatchStock(ctx context.Context, event *models.InventoryEvent, reservations []*models.UserReservation, allocate Allocator) ([]*models.Product, error) {
+	productIDs := make([]string, len(reservations))
+	for i, reservation := range reservations {
+		productIDs[i] = reservation.ProductID
+	}
+
+	var products []*models.Product
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		products = nil
+
+		query := `
+			SELECT id, available_stock FROM products
+			WHERE id = ANY($1) AND deleted_at IS NULL
+			ORDER BY id
+			FOR UPDATE
+		`
+		rows, err := tx.QueryContext(ctx, query, pq.Array(productIDs))
+		if err != nil {
+			return fmt.Errorf("failed to lock products: %w", err)
+		}
+		available := make(map[string]int)
+		for rows.Next() {
+			var id string
+			var stock int
+			if err := rows.Scan(&id, &stock); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan product: %w", err)
+			}
+			available[id] = stock
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating products: %w", err)
+		}
+
+		var shortfalls []models.ItemShortfall
+		for _, reservation := range reservations {
+			stock, ok := available[reservation.ProductID]
+			switch {
+			case !ok:
+				shortfalls = append(shortfalls, models.ItemShortfall{
+					ProductID: reservation.ProductID,
+					Requested: reservation.Quantity,
+					Reason:    models.ReservationRejectedProductNotFound,
+				})
+			case stock < reservation.Quantity:
+				shortfalls = append(shortfalls, models.ItemShortfall{
+					ProductID:      reservation.ProductID,
+					Requested:      reservation.Quantity,
+					AvailableStock: &stock,
+					Reason:         models.ReservationRejectedInsufficientStock,
+				})
+			}
+		}
+		if len(shortfalls) > 0 {
+			return &ShortfallError{Shortfalls: shortfalls}
+		}
+
+		if err := recordEvent(ctx, tx, event); err != nil {
+			return err
+		}
+
+		for _, reservation := range reservations {
+			product, err := adjustStock(ctx, tx, reservation.ProductID, -reservation.Quantity, reservation.Quantity, 0)
+			if err != nil {
+				return err
+			}
+			allocations, err := allocateStock(ctx, tx, reservation.ProductID, reservation.Quantity, allocate)
+			if errors.Is(err, ErrInsufficientStock) {
+				// There is enough stock, but not where the policy allows
+				return &ShortfallError{Shortfalls: []models.ItemShortfall{{
+					ProductID: reservation.ProductID,
+					Requested: reservation.Quantity,
+					Reason:    models.ReservationRejectedInsufficientStock,
+				}}}
+			}
+			if err != nil {
+				return err
+			}
+			if err := setReservationStatus(ctx, tx, reservation.ID, models.ReservationStatusPending, models.ReservationStatusActive, &reservation.ExpiresAt); err != nil {
+				return err
+			}
+			if err := insertAllocations(ctx, tx, reservation.ID, allocations); err != nil {
+				return err
+			}
+			reservation.Allocations = allocations
+			if err := loadLocations(ctx, tx, product); err != nil {
+				return err
+			}
+			if err := queueState(ctx, tx, product); err != nil {
+				return err
+			}
+			products = append(products, product)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// ConfirmReservationStock confirms an active reservation, removes its
+// quantity from the reserved and total stock at the locations it is held
+// at, moves its order, if any, to
+// CONFIRMED, records the event and queues the new stock in the outbox in one
+// transaction. It returns the product's new stock.
+func (r *inventoryRepository) ConfirmReservationStock(ctx context.Context, event *models.InventoryEvent, reservation *models.UserReservation) (*models.Product, error) {
+	var product *models.Product
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := recordEvent(ctx, tx, event); err != nil {
+			return err
+		}
+		if err := setReservationStatus(ctx, tx, reservation.ID, models.ReservationStatusActive, models.ReservationStatusConfirmed, nil); err != nil {
+			return err
+		}
+
+		var err error
+		product, err = adjustStock(ctx, tx, reservation.ProductID, 0, -reservation.Quantity, -reservation.Quantity)
+		if err != nil {
+			return err
+		}
+		if err := settleAllocations(ctx, tx, reservation, true); err != nil {
+			return err
+		}
+
+		// Confirmations published before orders were recorded have none
+		query := `UPDATE orders SET status = $2 WHERE id = $1 AND status = $3`
+		if _, err := tx.ExecContext(ctx, query, reservation.OrderID, models.OrderStatusConfirmed, models.OrderStatusPending); err != nil {
+			return fmt.Errorf("failed to update order status: %w", err)
+		}
+
+		if err := loadLocations(ctx, tx, product); err != nil {
+			return err
+		}
+		return queueState(ctx, tx, product)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// ReleaseReservationStock moves an active reservation to status, returns its
+// quantity from reserved to available stock at the locations it was held
+// at, records the event and queues the new stock in the outbox in one
+// transaction. It returns the product's new stock.
+func (r *inventoryRepository) ReleaseReservationStock(ctx context.Context, event *models.InventoryEvent, reservation *models.UserReservation, status string) (*models.Product, error) {
+	var product *models.Product
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := recordEvent(ctx, tx, event); err != nil {
+			return err
+		}
+		if err := setReservationStatus(ctx, tx, reservation.ID, models.ReservationStatusActive, status, nil); err != nil {
+			return err
+		}
+
+		var err error
+		product, err = adjustStock(ctx, tx, reservation.ProductID, reservation.Quantity, -reservation.Quantity, 0)
+		if err != nil {
+			return err
+		}
+		if err := settleAllocations(ctx, tx, reservation, false); err != nil {
+			return err
+		}
+
+		if err := loadLocations(ctx, tx, product); err != nil {
+			return err
+		}
+		return queueState(ctx, tx, product)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// RestockProduct adds the event's quantity to the total and available stock
+// at a location, records the event and queues it in the outbox along with
+// the new stock. It returns the product's new stock.
+func (r *inventoryRepository) RestockProduct(ctx context.Context, event *models.InventoryEvent, locationID string) (*models.Product, error) {
+	var product *models.Product
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := recordEvent(ctx, tx, event); err != nil {
+			return err
+		}
+
+		var err error
+		product, err = adjustStock(ctx, tx, event.ProductID, event.Quantity, 0, event.Quantity)
+		if err != nil {
+			return err
+		}
+		if err := ensureLocationStock(ctx, tx, event.ProductID, locationID); err != nil {
+			return err
+		}
+		if err := adjustLocationStock(ctx, tx, event.ProductID, locationID, event.Quantity, 0, event.Quantity); err != nil {
+			return err
+		}
+
+		if err := loadLocations(ctx, tx, product); err != nil {
+			return err
+		}
+		return queueChange(ctx, tx, event, product)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// AdjustStock changes the total and available stock at a location by the
+// event's quantity, or, when counted is set, to counted units in total at
+// the location and sets the event's quantity to the difference. It records
+// the event and queues it in the outbox along with the new stock. It returns
+// ErrInsufficientStock when the stock left would not cover the reserved
+// stock.
+func (r *inventoryRepository) AdjustStock(ctx context.Context, event *models.InventoryEvent, counted *int, locationID string) (*models.Product, error) {
+	var product *models.Product
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		if counted != nil {
+			// The product's lock covers its stock at every location
+			var total int
+			query := `
+				SELECT COALESCE((
+					SELECT total_stock FROM product_stock WHERE product_id = p.id AND location_id = $2
+				), 0)
+				FROM products p
+				WHERE p.id = $1 AND p.deleted_at IS NULL
+				FOR UPDATE OF p
+			`
+			err := tx.QueryRowContext(ctx, query, event.ProductID, locationID).Scan(&total)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					return ErrProductNotFound
+				}
+				return fmt.Errorf("failed to get product: %w", err)
+			}
+			event.Quantity = *counted - total
+		}
+
+		if err := recordEvent(ctx, tx, event); err != nil {
+			return err
+		}
+
+		var err error
+		product, err = adjustStock(ctx, tx, event.ProductID, event.Quantity, 0, event.Quantity)
+		if err != nil {
+			return err
+		}
+		if err := ensureLocationStock(ctx, tx, event.ProductID, locationID); err != nil {
+			return err
+		}
+		if err := adjustLocationStock(ctx, tx, event.ProductID, locationID, event.Quantity, 0, event.Quantity); err != nil {
+			return err
+		}
+
+		if err := loadLocations(ctx, tx, product); err != nil {
+			return err
+		}
+		return queueChange(ctx, tx, event, product)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"serialization failure", &pq.Error{Code: serializationFailure}, true},
+		{"deadlock", &pq.Error{Code: deadlockDetected}, true},
+		{"wrapped on commit", fmt.Errorf("failed to commit transaction: %w", &pq.Error{Code: serializationFailure}), true},
+		{"unique violation", &pq.Error{Code: uniqueViolation}, false},
+		{"foreign key violation", &pq.Error{Code: foreignKeyViolation}, false},
+		{"insufficient stock", ErrInsufficientStock, false},
+		{"no rows", sql.ErrNoRows, false},
+		{"other error", errors.New("connection reset"), false},
+		{"no error", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, retryable(tt.err))
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"url-shortener/internal/logging"
+	"url-shortener/internal/models"
+	"url-shortener/internal/tracing"
+
+	"github.com/lib/pq"
+)
+
+// outboxRelayLock is the advisory lock held by the relay publishing the
+// outbox, so only one relay at a time publishes and messages stay in order
+const outboxRelayLock = 7_340_001
+
+// queueMessage adds a message to the outbox along with the request ID and
+// trace context of ctx. It is published once the transaction db belongs to
+// commits, and never if it rolls back.
+func queueMessage(ctx context.Context, db execer, kind, key string, payload interface{}) error {
+	value, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox message: %w", err)
+	}
+
+	var traceContext []byte
+	if fields := tracing.InjectMap(ctx); fields != nil {
+		if traceContext, err = json.Marshal(fields); err != nil {
+			return fmt.Errorf("failed to encode outbox trace context: %w", err)
+		}
+	}
+
+	query := `
+		INSERT INTO outbox (kind, message_key, payload, request_id, trace_context)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+	`
+	if _, err := db.ExecContext(ctx, query, kind, key, value, logging.RequestIDFromContext(ctx), traceContext); err != nil {
+		return fmt.Errorf("failed to queue outbox message: %w", err)
+	}
+	return nil
+}
+
+// queueEvent adds an inventory event to the outbox, keyed by its product
+func queueEvent(ctx context.Context, db execer, event *models.InventoryEvent) error {
+	return queueMessage(ctx, db, models.OutboxKindInventoryEvent, event.ProductID, event)
+}
+
+// queueState adds the stock a change left a product with to the outbox
+func queueState(ctx context.Context, db execer, product *models.Product) error {
+	return queueMessage(ctx, db, models.OutboxKindInventoryState, product.ID, &models.InventoryState{
+		ProductID:      product.ID,
+		AvailableStock: product.AvailableStock,
+		ReservedStock:  product.ReservedStock,
+		TotalStock:     product.TotalStock,
+		LastUpdated:    product.UpdatedAt,
+		Version:        product.Version,
+		Locations:      product.Locations,
+	})
+}
+
+// queueChange adds an event and the product state it left behind to the
+// outbox
+func queueChange(ctx context.Context, db execer, event *models.InventoryEvent, product *models.Product) error {
+	if err := queueEvent(ctx, db, event); err != nil {
+		return err
+	}
+	return queueState(ctx, db, product)
+}
+
+// QueueEvent adds an inventory event to the outbox on its own
+func (r *inventoryRepository) QueueEvent(ctx context.Context, event *models.InventoryEvent) error {
+	return queueEvent(ctx, r.db, event)
+}
+
+// RelayOutbox passes up to limit unsent outbox messages to publish, oldest
+// first, and marks those it accepted as sent. It stops at the first message
+// publish fails on, so later messages never overtake it, and returns how many
+// were sent along with that failure. While another relay holds the outbox it
+// returns without sending anything.
+func (r *inventoryRepository) RelayOutbox(ctx context.Context, limit int, publish func(*models.OutboxMessage) error) (int, error) {
+	var sent []int64
+	var publishErr error
+	err := r.runTx(ctx, func(tx *sql.Tx) error {
+		var locked bool
+		if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxRelayLock).Scan(&locked); err != nil {
+			return fmt.Errorf("failed to lock outbox: %w", err)
+		}
+		if !locked {
+			return nil
+		}
+
+		query := `
+			SELECT id, kind, message_key, payload, COALESCE(request_id, ''), trace_context, created_at
+			FROM outbox
+			WHERE sent_at IS NULL
+			ORDER BY id
+			LIMIT $1
+		`
+		rows, err := tx.QueryContext(ctx, query, limit)
+		if err != nil {
+			return fmt.Errorf("failed to get outbox messages: %w", err)
+		}
+
+		var messages []*models.OutboxMessage
+		for rows.Next() {
+			message := &models.OutboxMessage{}
+			var traceContext []byte
+			if err := rows.Scan(&message.ID, &message.Kind, &message.Key, &message.Payload, &message.RequestID, &traceContext, &message.CreatedAt); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan outbox message: %w", err)
+			}
+			if traceContext != nil {
+				if err := json.Unmarshal(traceContext, &message.TraceContext); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to decode outbox trace context: %w", err)
+				}
+			}
+			messages = append(messages, message)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating outbox messages: %w", err)
+		}
+
+		for _, message := range messages {
+			if publishErr = publish(message); publishErr != nil {
+				break
+			}
+			sent = append(sent, message.ID)
+		}
+		if len(sent) == 0 {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE outbox SET sent_at = CURRENT_TIMESTAMP WHERE id = ANY($1)`, pq.Array(sent)); err != nil {
+			return fmt.Errorf("failed to mark outbox messages sent: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(sent), publishErr
+}
+
+// DeleteSentOutbox deletes outbox messages sent before the given time
+func (r *inventoryRepository) DeleteSentOutbox(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE sent_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sent outbox messages: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return deleted, nil
+}
@@ -1,26 +1,39 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"url-shortener/internal/models"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrURLNotFound is returned when no active link has the short code
+	ErrURLNotFound = errors.New("URL not found")
+	// ErrURLExpired is returned for links past their expiry time
+	ErrURLExpired = errors.New("URL has expired")
 )
 
 type URLRepository interface {
-	Create(url *models.URL) error
-	GetByShortCode(shortCode string) (*models.URL, error)
-	GetByID(id int) (*models.URL, error)
-	Update(url *models.URL) error
-	Delete(id int) error
-	IsShortCodeExists(shortCode string) (bool, error)
+	Create(ctx context.Context, url *models.URL) error
+	GetByShortCode(ctx context.Context, shortCode string) (*models.URL, error)
+	GetByID(ctx context.Context, id int) (*models.URL, error)
+	Update(ctx context.Context, url *models.URL) error
+	Delete(ctx context.Context, id int) error
+	IsShortCodeExists(ctx context.Context, shortCode string) (bool, error)
+	ExpireByShortCodes(ctx context.Context, shortCodes []string) ([]models.URL, error)
+	GetMostClicked(ctx context.Context, limit int) ([]models.URL, error)
 
 	// Pre-generated URL methods
-	CreatePreGeneratedURL(shortCode string) error
-	GetUnusedPreGeneratedURL() (*models.PreGeneratedURL, error)
-	MarkPreGeneratedURLAsUsed(shortCode string) error
-	GetPreGeneratedURLCount() (int, error)
+	CreatePreGeneratedURL(ctx context.Context, shortCode string) error
+	GetUnusedPreGeneratedURL(ctx context.Context) (*models.PreGeneratedURL, error)
+	MarkPreGeneratedURLAsUsed(ctx context.Context, shortCode string) error
+	GetPreGeneratedURLCount(ctx context.Context) (int, error)
 }
 
 type urlRepository struct {
@@ -31,14 +44,15 @@ func NewURLRepository(db *sql.DB) URLRepository {
 	return &urlRepository{db: db}
 }
 
-func (r *urlRepository) Create(url *models.URL) error {
+func (r *urlRepository) Create(ctx context.Context, url *models.URL) error {
 	query := `
 		INSERT INTO urls (short_code, original_url, expires_at, is_active, is_used)
 		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at
 	`
 
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(
+		ctx,
 		query,
 		url.ShortCode,
 		url.OriginalURL,
@@ -54,7 +68,7 @@ func (r *urlRepository) Create(url *models.URL) error {
 	return nil
 }
 
-func (r *urlRepository) GetByShortCode(shortCode string) (*models.URL, error) {
+func (r *urlRepository) GetByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
 	query := `
 		SELECT id, short_code, original_url, created_at, expires_at, is_active, is_used
 		FROM urls
@@ -62,7 +76,7 @@ func (r *urlRepository) GetByShortCode(shortCode string) (*models.URL, error) {
 	`
 
 	url := &models.URL{}
-	err := r.db.QueryRow(query, shortCode).Scan(
+	err := r.db.QueryRowContext(ctx, query, shortCode).Scan(
 		&url.ID,
 		&url.ShortCode,
 		&url.OriginalURL,
@@ -74,20 +88,20 @@ func (r *urlRepository) GetByShortCode(shortCode string) (*models.URL, error) {
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("URL not found")
+			return nil, ErrURLNotFound
 		}
 		return nil, fmt.Errorf("failed to get URL: %w", err)
 	}
 
 	// Check if URL has expired
 	if url.ExpiresAt != nil && url.ExpiresAt.Before(time.Now()) {
-		return nil, fmt.Errorf("URL has expired")
+		return nil, ErrURLExpired
 	}
 
 	return url, nil
 }
 
-func (r *urlRepository) GetByID(id int) (*models.URL, error) {
+func (r *urlRepository) GetByID(ctx context.Context, id int) (*models.URL, error) {
 	query := `
 		SELECT id, short_code, original_url, created_at, expires_at, is_active, is_used
 		FROM urls
@@ -95,7 +109,7 @@ func (r *urlRepository) GetByID(id int) (*models.URL, error) {
 	`
 
 	url := &models.URL{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&url.ID,
 		&url.ShortCode,
 		&url.OriginalURL,
@@ -115,14 +129,14 @@ func (r *urlRepository) GetByID(id int) (*models.URL, error) {
 	return url, nil
 }
 
-func (r *urlRepository) Update(url *models.URL) error {
+func (r *urlRepository) Update(ctx context.Context, url *models.URL) error {
 	query := `
 		UPDATE urls
 		SET original_url = $2, expires_at = $3, is_active = $4
 		WHERE id = $1
 	`
 
-	_, err := r.db.Exec(query, url.ID, url.OriginalURL, url.ExpiresAt, url.IsActive)
+	_, err := r.db.ExecContext(ctx, query, url.ID, url.OriginalURL, url.ExpiresAt, url.IsActive)
 	if err != nil {
 		return fmt.Errorf("failed to update URL: %w", err)
 	}
@@ -130,10 +144,10 @@ func (r *urlRepository) Update(url *models.URL) error {
 	return nil
 }
 
-func (r *urlRepository) Delete(id int) error {
+func (r *urlRepository) Delete(ctx context.Context, id int) error {
 	query := `UPDATE urls SET is_active = FALSE WHERE id = $1`
 
-	_, err := r.db.Exec(query, id)
+	_, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete URL: %w", err)
 	}
@@ -141,11 +155,11 @@ func (r *urlRepository) Delete(id int) error {
 	return nil
 }
 
-func (r *urlRepository) IsShortCodeExists(shortCode string) (bool, error) {
+func (r *urlRepository) IsShortCodeExists(ctx context.Context, shortCode string) (bool, error) {
 	query := `SELECT EXISTS(SELECT 1 FROM urls WHERE short_code = $1)`
 
 	var exists bool
-	err := r.db.QueryRow(query, shortCode).Scan(&exists)
+	err := r.db.QueryRowContext(ctx, query, shortCode).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check short code existence: %w", err)
 	}
@@ -153,14 +167,97 @@ func (r *urlRepository) IsShortCodeExists(shortCode string) (bool, error) {
 	return exists, nil
 }
 
+// ExpireByShortCodes deactivates the given links immediately and returns the
+// links that were still active
+func (r *urlRepository) ExpireByShortCodes(ctx context.Context, shortCodes []string) ([]models.URL, error) {
+	query := `
+		UPDATE urls
+		SET is_active = FALSE, expires_at = LEAST(COALESCE(expires_at, CURRENT_TIMESTAMP), CURRENT_TIMESTAMP)
+		WHERE short_code = ANY($1) AND is_active = TRUE
+		RETURNING id, short_code, original_url, created_at, expires_at, is_active, is_used
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(shortCodes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire URLs: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []models.URL
+	for rows.Next() {
+		var url models.URL
+		if err := rows.Scan(
+			&url.ID,
+			&url.ShortCode,
+			&url.OriginalURL,
+			&url.CreatedAt,
+			&url.ExpiresAt,
+			&url.IsActive,
+			&url.IsUsed,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan expired URL: %w", err)
+		}
+		urls = append(urls, url)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to expire URLs: %w", err)
+	}
+
+	return urls, nil
+}
+
+// GetMostClicked returns up to limit active, unexpired links ordered by their
+// number of recorded clicks
+func (r *urlRepository) GetMostClicked(ctx context.Context, limit int) ([]models.URL, error) {
+	query := `
+		SELECT u.id, u.short_code, u.original_url, u.created_at, u.expires_at, u.is_active, u.is_used
+		FROM urls u
+		JOIN analytics a ON a.url_id = u.id
+		WHERE u.is_active = TRUE AND (u.expires_at IS NULL OR u.expires_at > CURRENT_TIMESTAMP)
+		GROUP BY u.id
+		ORDER BY COUNT(*) DESC
+		LIMIT $1
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get most clicked URLs: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []models.URL
+	for rows.Next() {
+		var url models.URL
+		if err := rows.Scan(
+			&url.ID,
+			&url.ShortCode,
+			&url.OriginalURL,
+			&url.CreatedAt,
+			&url.ExpiresAt,
+			&url.IsActive,
+			&url.IsUsed,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan most clicked URL: %w", err)
+		}
+		urls = append(urls, url)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get most clicked URLs: %w", err)
+	}
+
+	return urls, nil
+}
+
 // Pre-generated URL methods
-func (r *urlRepository) CreatePreGeneratedURL(shortCode string) error {
+func (r *urlRepository) CreatePreGeneratedURL(ctx context.Context, shortCode string) error {
 	query := `
 		INSERT INTO pre_generated_urls (short_code, is_used)
 		VALUES ($1, FALSE)
 	`
 
-	_, err := r.db.Exec(query, shortCode)
+	_, err := r.db.ExecContext(ctx, query, shortCode)
 	if err != nil {
 		return fmt.Errorf("failed to create pre-generated URL: %w", err)
 	}
@@ -168,7 +265,7 @@ func (r *urlRepository) CreatePreGeneratedURL(shortCode string) error {
 	return nil
 }
 
-func (r *urlRepository) GetUnusedPreGeneratedURL() (*models.PreGeneratedURL, error) {
+func (r *urlRepository) GetUnusedPreGeneratedURL(ctx context.Context) (*models.PreGeneratedURL, error) {
 	query := `
 		SELECT short_code, created_at, is_used
 		FROM pre_generated_urls
@@ -178,7 +275,7 @@ func (r *urlRepository) GetUnusedPreGeneratedURL() (*models.PreGeneratedURL, err
 	`
 
 	url := &models.PreGeneratedURL{}
-	err := r.db.QueryRow(query).Scan(
+	err := r.db.QueryRowContext(ctx, query).Scan(
 		&url.ShortCode,
 		&url.CreatedAt,
 		&url.IsUsed,
@@ -194,10 +291,10 @@ func (r *urlRepository) GetUnusedPreGeneratedURL() (*models.PreGeneratedURL, err
 	return url, nil
 }
 
-func (r *urlRepository) MarkPreGeneratedURLAsUsed(shortCode string) error {
+func (r *urlRepository) MarkPreGeneratedURLAsUsed(ctx context.Context, shortCode string) error {
 	query := `UPDATE pre_generated_urls SET is_used = TRUE WHERE short_code = $1`
 
-	_, err := r.db.Exec(query, shortCode)
+	_, err := r.db.ExecContext(ctx, query, shortCode)
 	if err != nil {
 		return fmt.Errorf("failed to mark pre-generated URL as used: %w", err)
 	}
@@ -205,11 +302,11 @@ func (r *urlRepository) MarkPreGeneratedURLAsUsed(shortCode string) error {
 	return nil
 }
 
-func (r *urlRepository) GetPreGeneratedURLCount() (int, error) {
+func (r *urlRepository) GetPreGeneratedURLCount(ctx context.Context) (int, error) {
 	query := `SELECT COUNT(*) FROM pre_generated_urls WHERE is_used = FALSE`
 
 	var count int
-	err := r.db.QueryRow(query).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get pre-generated URL count: %w", err)
 	}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"url-shortener/internal/config"
+)
+
+// Step is one stage of an ordered teardown
+type Step struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// New creates an HTTP server for handler listening on port
+func New(port string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// Run serves srv until SIGINT or SIGTERM is received, then shuts down in order:
+// startShutdown is called so readiness starts failing, new connections are
+// refused after cfg.ReadinessDelay, in-flight requests get cfg.DrainTimeout to
+// complete, and finally the teardown steps run in sequence sharing
+// cfg.FlushTimeout. A failing step is logged and does not stop later steps.
+func Run(srv *http.Server, cfg config.ShutdownConfig, startShutdown func(), steps ...Step) error {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Server starting", "addr", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
+
+	var runErr error
+	select {
+	case sig := <-quit:
+		slog.Info("Shutting down server", "signal", sig.String())
+
+		if startShutdown != nil {
+			startShutdown()
+		}
+		time.Sleep(cfg.ReadinessDelay)
+
+		drainCtx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+		if err := srv.Shutdown(drainCtx); err != nil {
+			slog.Error("Failed to drain in-flight requests", "error", err)
+			srv.Close()
+		}
+		cancel()
+	case err := <-serveErr:
+		runErr = fmt.Errorf("failed to start server: %w", err)
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), cfg.FlushTimeout)
+	defer cancel()
+	for _, step := range steps {
+		start := time.Now()
+		if err := step.Run(flushCtx); err != nil {
+			slog.Error("Shutdown step failed", "step", step.Name, "error", err)
+			continue
+		}
+		slog.Info("Shutdown step completed", "step", step.Name, "duration", time.Since(start))
+	}
+
+	slog.Info("Server stopped")
+	return runErr
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+)
+
+// ErrInvalidAllocation is returned when an allocation policy cannot be
+// followed as given
+var ErrInvalidAllocation = errors.New("invalid allocation policy")
+
+// validateAllocationPolicy checks what the request binding cannot: the
+// coordinates come in pairs and the nearest location needs them
+func validateAllocationPolicy(policy models.AllocationPolicy) error {
+	if (policy.Latitude == nil) != (policy.Longitude == nil) {
+		return fmt.Errorf("%w: latitude and longitude go together", ErrInvalidAllocation)
+	}
+	if policy.Strategy == models.AllocationStrategyNearest && policy.Latitude == nil {
+		return fmt.Errorf("%w: the nearest strategy needs latitude and longitude", ErrInvalidAllocation)
+	}
+	return nil
+}
+
+// eventAllocation returns the policy to send with a reserve event, nil when
+// it leaves every choice to the defaults
+func eventAllocation(policy models.AllocationPolicy) *models.AllocationPolicy {
+	if policy.IsZero() {
+		return nil
+	}
+	return &policy
+}
+
+// newAllocator returns the allocator following policy, which may be nil
+func newAllocator(policy *models.AllocationPolicy) repository.Allocator {
+	var p models.AllocationPolicy
+	if policy != nil {
+		p = *policy
+	}
+	return func(stock []models.LocationStock, quantity int) []models.LocationAllocation {
+		return allocate(stock, quantity, p)
+	}
+}
+
+// allocate picks where quantity units are reserved among the locations the
+// policy allows. The nearest and most stock strategies hold the whole
+// quantity at one location; split takes what it needs from as many
+// locations as it takes. It returns nil when the quantity cannot be held.
+func allocate(stock []models.LocationStock, quantity int, policy models.AllocationPolicy) []models.LocationAllocation {
+	var candidates []models.LocationStock
+	for _, s := range stock {
+		if policy.LocationID != "" && s.LocationID != policy.LocationID {
+			continue
+		}
+		if policy.Region != "" && s.Region != policy.Region {
+			continue
+		}
+		if s.AvailableStock > 0 {
+			candidates = append(candidates, s)
+		}
+	}
+
+	// Closest first when the requester's position is known, fullest first
+	// otherwise
+	byDistance := policy.Latitude != nil && policy.Longitude != nil &&
+		policy.Strategy != models.AllocationStrategyMostStock
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if byDistance {
+			da, db := distance(policy, a), distance(policy, b)
+			if da != db {
+				return da < db
+			}
+		}
+		if a.AvailableStock != b.AvailableStock {
+			return a.AvailableStock > b.AvailableStock
+		}
+		return a.LocationID < b.LocationID
+	})
+
+	if policy.Strategy == models.AllocationStrategySplit {
+		var allocations []models.LocationAllocation
+		remaining := quantity
+		for _, s := range candidates {
+			take := min(s.AvailableStock, remaining)
+			allocations = append(allocations, models.LocationAllocation{LocationID: s.LocationID, Quantity: take})
+			if remaining -= take; remaining == 0 {
+				return allocations
+			}
+		}
+		return nil
+	}
+
+	for _, s := range candidates {
+		if s.AvailableStock >= quantity {
+			return []models.LocationAllocation{{LocationID: s.LocationID, Quantity: quantity}}
+		}
+	}
+	return nil
+}
+
+// earthRadiusKm is the mean radius of the Earth
+const earthRadiusKm = 6371
+
+// distance returns the great-circle distance in kilometres from the
+// requester to a location. Locations without coordinates are infinitely far.
+func distance(policy models.AllocationPolicy, s models.LocationStock) float64 {
+	if s.Latitude == nil || s.Longitude == nil {
+		return math.Inf(1)
+	}
+	lat1, lat2 := radians(*policy.Latitude), radians(*s.Latitude)
+	dLat := lat2 - lat1
+	dLon := radians(*s.Longitude - *policy.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"testing"
+
+	"url-shortener/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func coordinates(lat, lon float64) (*float64, *float64) {
+	return &lat, &lon
+}
+
+func TestAllocate(t *testing.T) {
+	hanoiLat, hanoiLon := coordinates(21.03, 105.85)
+	danangLat, danangLon := coordinates(16.05, 108.20)
+	saigonLat, saigonLon := coordinates(10.78, 106.70)
+	stock := []models.LocationStock{
+		{LocationID: "dad-1", Region: "central", Latitude: danangLat, Longitude: danangLon, AvailableStock: 4},
+		{LocationID: "han-1", Region: "north", Latitude: hanoiLat, Longitude: hanoiLon, AvailableStock: 3},
+		{LocationID: "sgn-1", Region: "south", Latitude: saigonLat, Longitude: saigonLon, AvailableStock: 10},
+		{LocationID: "sgn-2", Region: "south", AvailableStock: 0},
+	}
+	nearHanoiLat, nearHanoiLon := coordinates(21.0, 105.8)
+
+	tests := []struct {
+		name     string
+		quantity int
+		policy   models.AllocationPolicy
+		want     []models.LocationAllocation
+	}{
+		{
+			name:     "most stock by default",
+			quantity: 2,
+			want:     []models.LocationAllocation{{LocationID: "sgn-1", Quantity: 2}},
+		},
+		{
+			name:     "nearest by default with coordinates",
+			quantity: 2,
+			policy:   models.AllocationPolicy{Latitude: nearHanoiLat, Longitude: nearHanoiLon},
+			want:     []models.LocationAllocation{{LocationID: "han-1", Quantity: 2}},
+		},
+		{
+			name:     "nearest location that has the whole quantity",
+			quantity: 4,
+			policy:   models.AllocationPolicy{Strategy: models.AllocationStrategyNearest, Latitude: nearHanoiLat, Longitude: nearHanoiLon},
+			want:     []models.LocationAllocation{{LocationID: "dad-1", Quantity: 4}},
+		},
+		{
+			name:     "most stock ignores coordinates",
+			quantity: 2,
+			policy:   models.AllocationPolicy{Strategy: models.AllocationStrategyMostStock, Latitude: nearHanoiLat, Longitude: nearHanoiLon},
+			want:     []models.LocationAllocation{{LocationID: "sgn-1", Quantity: 2}},
+		},
+		{
+			name:     "split nearest first",
+			quantity: 6,
+			policy:   models.AllocationPolicy{Strategy: models.AllocationStrategySplit, Latitude: nearHanoiLat, Longitude: nearHanoiLon},
+			want:     []models.LocationAllocation{{LocationID: "han-1", Quantity: 3}, {LocationID: "dad-1", Quantity: 3}},
+		},
+		{
+			name:     "split fullest first",
+			quantity: 12,
+			policy:   models.AllocationPolicy{Strategy: models.AllocationStrategySplit},
+			want:     []models.LocationAllocation{{LocationID: "sgn-1", Quantity: 10}, {LocationID: "dad-1", Quantity: 2}},
+		},
+		{
+			name:     "split short of stock",
+			quantity: 18,
+			policy:   models.AllocationPolicy{Strategy: models.AllocationStrategySplit},
+		},
+		{
+			name:     "no single location has the quantity",
+			quantity: 11,
+		},
+		{
+			name:     "region",
+			quantity: 2,
+			policy:   models.AllocationPolicy{Region: "north"},
+			want:     []models.LocationAllocation{{LocationID: "han-1", Quantity: 2}},
+		},
+		{
+			name:     "region short of stock",
+			quantity: 5,
+			policy:   models.AllocationPolicy{Region: "north"},
+		},
+		{
+			name:     "pinned location",
+			quantity: 4,
+			policy:   models.AllocationPolicy{LocationID: "dad-1"},
+			want:     []models.LocationAllocation{{LocationID: "dad-1", Quantity: 4}},
+		},
+		{
+			name:     "pinned location without stock",
+			quantity: 1,
+			policy:   models.AllocationPolicy{LocationID: "sgn-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, allocate(stock, tt.quantity, tt.policy))
+		})
+	}
+}
+
+func TestValidateAllocationPolicy(t *testing.T) {
+	lat, lon := coordinates(10, 106)
+
+	assert.NoError(t, validateAllocationPolicy(models.AllocationPolicy{}))
+	assert.NoError(t, validateAllocationPolicy(models.AllocationPolicy{Strategy: models.AllocationStrategyNearest, Latitude: lat, Longitude: lon}))
+	assert.ErrorIs(t, validateAllocationPolicy(models.AllocationPolicy{Strategy: models.AllocationStrategyNearest}), ErrInvalidAllocation)
+	assert.ErrorIs(t, validateAllocationPolicy(models.AllocationPolicy{Latitude: lat}), ErrInvalidAllocation)
+}
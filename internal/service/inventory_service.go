@@ -3,12 +3,17 @@ package service
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"url-shortener/internal/config"
 	"url-shortener/internal/kafka"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/models"
 	"url-shortener/internal/repository"
 
@@ -16,59 +21,112 @@ import (
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrReservationNotOwned is returned when a user acts on someone else's reservation
+	ErrReservationNotOwned = errors.New("reservation belongs to a different user")
+	// ErrReservationNotActive is returned when a reservation no longer holds stock
+	ErrReservationNotActive = errors.New("reservation is not active")
+	// ErrExtensionLimit is returned when a hold may not be extended any further
+	ErrExtensionLimit = errors.New("reservation cannot be extended any further")
+	// ErrIdempotencyKeyReused is returned when an Idempotency-Key is sent
+	// again with a different product or quantity
+	ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+	// ErrDuplicateBatchItem is returned when a batch lists a product twice
+	ErrDuplicateBatchItem = errors.New("batch lists a product more than once")
+)
+
 // InventoryService handles inventory operations using Kafka
 type InventoryService interface {
 	CheckAvailability(ctx context.Context, req *models.ProductAvailabilityRequest) (*models.ProductAvailabilityResponse, error)
 	ReserveInventory(ctx context.Context, req *models.PurchaseRequest) (*models.PurchaseResponse, error)
-	ConfirmPurchase(ctx context.Context, orderID uuid.UUID, userID string) error
+	ReserveBatch(ctx context.Context, req *models.BatchPurchaseRequest) (*models.BatchPurchaseResponse, error)
+	GetReservationBatch(ctx context.Context, batchID uuid.UUID, userID string) (*models.BatchPurchaseResponse, error)
+	ConfirmPurchase(ctx context.Context, orderID uuid.UUID, userID string) (*models.Order, error)
 	ReleaseReservation(ctx context.Context, orderID uuid.UUID, userID string) error
+	GetReservation(ctx context.Context, orderID uuid.UUID, userID string) (*models.UserReservation, error)
+	GetUserReservations(ctx context.Context, userID string, limit, offset int) (*models.ReservationPage, error)
+	ExtendReservation(ctx context.Context, orderID uuid.UUID, userID string) (*models.UserReservation, error)
 	GetProductInventory(ctx context.Context, productID string) (*models.InventoryState, error)
+	GetInventoryMetrics(ctx context.Context) (*models.InventoryMetrics, error)
 	StartInventoryProcessor(ctx context.Context) error
 	StopInventoryProcessor()
+	RunOutboxRelay(ctx context.Context)
+	SetReservationTimeout(timeout time.Duration)
+}
+
+// replyPublisher tells requesters how their reservations went
+type replyPublisher interface {
+	PublishReservationReply(ctx context.Context, reply *models.ReservationReply) error
 }
 
 type inventoryService struct {
 	db          *sql.DB
-	redisClient *redis.Client
+	redisClient redis.UniversalClient
 	producer    *kafka.Producer
+	publisher   replyPublisher
 	consumer    *kafka.Consumer
+	replies     *kafka.ReplyListener
 	repository  repository.InventoryRepository
+	outbox      *outboxRelay
 
 	// State management
 	stateCache map[string]*models.InventoryState
 	stateMutex sync.RWMutex
 
 	// Configuration
-	reservationTimeout time.Duration
+	reservationTimeout atomic.Int64 // time.Duration, changed by SetReservationTimeout
 	cleanupInterval    time.Duration
+	replyTimeout       time.Duration
+	maxExtensions      int
+	maxHold            time.Duration
 
 	// Control
 	stopChan chan bool
 	running  bool
 }
 
-// NewInventoryService creates a new inventory service
+// NewInventoryService creates a new inventory service. The API server passes
+// the reply listener and no consumer; the worker does the opposite.
 func NewInventoryService(
 	db *sql.DB,
-	redisClient *redis.Client,
+	redisClient redis.UniversalClient,
 	producer *kafka.Producer,
 	consumer *kafka.Consumer,
+	replies *kafka.ReplyListener,
 	repository repository.InventoryRepository,
+	cfg config.InventoryConfig,
 ) InventoryService {
-	return &inventoryService{
-		db:                 db,
-		redisClient:        redisClient,
-		producer:           producer,
-		consumer:           consumer,
-		repository:         repository,
-		stateCache:         make(map[string]*models.InventoryState),
-		reservationTimeout: 15 * time.Minute,
-		cleanupInterval:    5 * time.Minute,
-		stopChan:           make(chan bool),
-	}
+	s := &inventoryService{
+		db:              db,
+		redisClient:     redisClient,
+		producer:        producer,
+		publisher:       producer,
+		consumer:        consumer,
+		replies:         replies,
+		repository:      repository,
+		stateCache:      make(map[string]*models.InventoryState),
+		cleanupInterval: cfg.CleanupInterval,
+		replyTimeout:    cfg.ReplyTimeout,
+		maxExtensions:   cfg.MaxExtensions,
+		maxHold:         cfg.MaxHold,
+		stopChan:        make(chan bool),
+	}
+	s.outbox = newOutboxRelay(repository, producer, cfg)
+	s.SetReservationTimeout(cfg.ReservationTimeout)
+	return s
 }
 
-// CheckAvailability checks if a product has available inventory
+// SetReservationTimeout changes how long new reservations are held
+func (s *inventoryService) SetReservationTimeout(timeout time.Duration) {
+	s.reservationTimeout.Store(int64(timeout))
+}
+
+func (s *inventoryService) reservationTTL() time.Duration {
+	return time.Duration(s.reservationTimeout.Load())
+}
+
+// CheckAvailability checks if a product has available inventory, across
+// every location or, when a region is given, at the locations in it
 func (s *inventoryService) CheckAvailability(ctx context.Context, req *models.ProductAvailabilityRequest) (*models.ProductAvailabilityResponse, error) {
 	// Get current inventory state
 	state, err := s.getInventoryState(ctx, req.ProductID)
@@ -76,8 +134,32 @@ func (s *inventoryService) CheckAvailability(ctx context.Context, req *models.Pr
 		return nil, fmt.Errorf("failed to get inventory state: %w", err)
 	}
 
+	response := &models.ProductAvailabilityResponse{
+		ProductID:      req.ProductID,
+		AvailableStock: state.AvailableStock,
+		TotalStock:     state.TotalStock,
+		ReservedStock:  state.ReservedStock,
+		Region:         req.Region,
+		Locations:      []models.LocationStock{},
+	}
+	if req.Region == "" {
+		response.Locations = append(response.Locations, state.Locations...)
+	} else {
+		response.AvailableStock, response.TotalStock, response.ReservedStock = 0, 0, 0
+		for _, location := range state.Locations {
+			if location.Region != req.Region {
+				continue
+			}
+			response.AvailableStock += location.AvailableStock
+			response.TotalStock += location.TotalStock
+			response.ReservedStock += location.ReservedStock
+			response.Locations = append(response.Locations, location)
+		}
+	}
+
 	// Check availability
-	available := state.AvailableStock >= req.Quantity
+	available := response.AvailableStock >= req.Quantity
+	response.Available = available
 
 	// Publish check event for analytics
 	event := s.producer.CreateInventoryCheckEvent(
@@ -91,22 +173,32 @@ func (s *inventoryService) CheckAvailability(ctx context.Context, req *models.Pr
 	)
 
 	if err := s.producer.PublishInventoryEventAsync(ctx, event); err != nil {
-		log.Printf("Failed to publish inventory check event: %v", err)
+		slog.WarnContext(ctx, "Failed to publish inventory check event", "product_id", req.ProductID, "error", err)
 	}
 
-	return &models.ProductAvailabilityResponse{
-		ProductID:      req.ProductID,
-		Available:      available,
-		AvailableStock: state.AvailableStock,
-		TotalStock:     state.TotalStock,
-		ReservedStock:  state.ReservedStock,
-	}, nil
+	return response, nil
 }
 
-// ReserveInventory reserves inventory for a user
+// ReserveInventory reserves inventory for a user. The reservation is recorded
+// as pending under the order ID, then it waits up to the reply timeout for
+// the inventory processor to accept or reject it and reports it as pending
+// when no outcome arrives in time. A request retried with the same
+// Idempotency-Key gets the reservation of the first one.
 func (s *inventoryService) ReserveInventory(ctx context.Context, req *models.PurchaseRequest) (*models.PurchaseResponse, error) {
+	if err := validateAllocationPolicy(req.AllocationPolicy); err != nil {
+		return nil, err
+	}
+	if req.IdempotencyKey != "" {
+		response, err := s.replayReservation(ctx, req)
+		if !errors.Is(err, repository.ErrReservationNotFound) {
+			return response, err
+		}
+	}
+
 	// Generate order ID
 	orderID := uuid.New()
+	now := time.Now()
+	reservedUntil := now.Add(s.reservationTTL())
 
 	// Create reservation event
 	event := s.producer.CreateInventoryReserveEvent(
@@ -115,43 +207,178 @@ func (s *inventoryService) ReserveInventory(ctx context.Context, req *models.Pur
 		req.UserID,
 		map[string]interface{}{
 			"orderId":       orderID.String(),
-			"reservedUntil": time.Now().Add(s.reservationTimeout).Format(time.RFC3339),
+			"reservedUntil": reservedUntil.Format(time.RFC3339),
 		},
 	)
+	event.Allocation = eventAllocation(req.AllocationPolicy)
 
-	// Publish reservation event
-	if err := s.producer.PublishInventoryEvent(ctx, event); err != nil {
-		return nil, fmt.Errorf("failed to publish reservation event: %w", err)
+	response := &models.PurchaseResponse{
+		Status:    models.PurchaseStatusPending,
+		OrderID:   orderID,
+		ProductID: req.ProductID,
+		Quantity:  req.Quantity,
+		Message:   "Reservation is being processed",
 	}
 
-	// Wait for processing result (in real implementation, this would be async)
-	// For now, we'll simulate a successful reservation
-	reservedUntil := time.Now().Add(s.reservationTimeout)
+	// Record the reservation so its status can be polled. Pending
+	// reservations the processor never sees expire on their own.
+	reservation := &models.UserReservation{
+		ID:             uuid.New().String(),
+		OrderID:        orderID,
+		UserID:         req.UserID,
+		ProductID:      req.ProductID,
+		Quantity:       req.Quantity,
+		ReservedAt:     now,
+		ExpiresAt:      reservedUntil,
+		Status:         models.ReservationStatusPending,
+		CorrelationID:  event.CorrelationID,
+		IdempotencyKey: req.IdempotencyKey,
+	}
+	// Register for the reply before queueing the event so it cannot be missed
+	var replies <-chan models.ReservationReply
+	if s.replies != nil {
+		var cancel func()
+		replies, cancel = s.replies.Await(event.CorrelationID)
+		defer cancel()
+	}
+
+	// The reservation event is queued with the reservation and published by
+	// the outbox relay
+	if err := s.repository.CreateReservation(ctx, reservation, event); err != nil {
+		if errors.Is(err, repository.ErrIdempotencyKeyExists) {
+			// A concurrent request with the same key got there first
+			return s.replayReservation(ctx, req)
+		}
+		if errors.Is(err, repository.ErrProductNotFound) {
+			applyReservationReply(response, models.ReservationReply{Reason: models.ReservationRejectedProductNotFound})
+			metrics.InventoryReservations.WithLabelValues(strings.ToLower(response.Status)).Inc()
+			return response, nil
+		}
+		return nil, fmt.Errorf("failed to record reservation: %w", err)
+	}
+	s.outbox.notify()
 
-	return &models.PurchaseResponse{
-		Success:       true,
-		OrderID:       orderID,
-		ProductID:     req.ProductID,
-		Quantity:      req.Quantity,
-		ReservedUntil: reservedUntil,
-		Message:       "Inventory reserved successfully",
-	}, nil
+	if replies != nil {
+		timer := time.NewTimer(s.replyTimeout)
+		defer timer.Stop()
+
+		// A cancelled request is still answered as pending: the event is
+		// already on its way to the processor
+		select {
+		case reply := <-replies:
+			applyReservationReply(response, reply)
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+
+	metrics.InventoryReservations.WithLabelValues(strings.ToLower(response.Status)).Inc()
+	return response, nil
+}
+
+// replayReservation answers a request with the reservation an earlier
+// request with the same Idempotency-Key made. It returns
+// ErrReservationNotFound when there was no earlier request.
+func (s *inventoryService) replayReservation(ctx context.Context, req *models.PurchaseRequest) (*models.PurchaseResponse, error) {
+	reservation, err := s.repository.GetReservationByIdempotencyKey(ctx, req.UserID, req.IdempotencyKey)
+	if errors.Is(err, repository.ErrReservationNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reservation: %w", err)
+	}
+
+	if reservation.ProductID != req.ProductID || reservation.Quantity != req.Quantity {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	response := &models.PurchaseResponse{
+		Status:    models.PurchaseStatusPending,
+		OrderID:   reservation.OrderID,
+		ProductID: reservation.ProductID,
+		Quantity:  reservation.Quantity,
+		Message:   "Reservation is being processed",
+		Replayed:  true,
+	}
+	switch reservation.Status {
+	case models.ReservationStatusPending:
+	case models.ReservationStatusRejected:
+		applyReservationReply(response, models.ReservationReply{Reason: reservation.Reason})
+		// The stock available back then is not recorded
+		response.AvailableStock = nil
+	case models.ReservationStatusExpired:
+		if reservation.Reason == models.ReservationExpiredUnprocessed {
+			// The hold ran out before any stock was reserved
+			applyReservationReply(response, models.ReservationReply{Reason: reservation.Reason})
+			break
+		}
+		applyReservationReply(response, models.ReservationReply{Reserved: true, ReservedUntil: &reservation.ExpiresAt})
+	default:
+		// The stock was reserved, even if the hold has ended since
+		applyReservationReply(response, models.ReservationReply{Reserved: true, ReservedUntil: &reservation.ExpiresAt})
+	}
+
+	metrics.InventoryIdempotentReplays.Inc()
+	return response, nil
 }
 
-// ConfirmPurchase confirms a purchase and reduces inventory
-func (s *inventoryService) ConfirmPurchase(ctx context.Context, orderID uuid.UUID, userID string) error {
+// applyReservationReply fills response with the processor's outcome
+func applyReservationReply(response *models.PurchaseResponse, reply models.ReservationReply) {
+	if reply.Reserved {
+		response.Success = true
+		response.Status = models.PurchaseStatusReserved
+		response.ReservedUntil = reply.ReservedUntil
+		response.Allocations = reply.Allocations
+		response.Message = "Inventory reserved successfully"
+		return
+	}
+
+	available := reply.AvailableStock
+	response.Status = models.PurchaseStatusRejected
+	response.Reason = reply.Reason
+	response.Message = ""
+	switch reply.Reason {
+	case models.ReservationRejectedProductNotFound:
+		response.Error = "Product not found"
+	case models.ReservationExpiredUnprocessed:
+		response.Error = "Reservation expired before it was processed"
+	default:
+		response.AvailableStock = &available
+		response.Error = "Insufficient inventory"
+	}
+}
+
+// ConfirmPurchase places a pending order for an active reservation and asks
+// the processor to commit its stock. Confirming again returns the same order.
+func (s *inventoryService) ConfirmPurchase(ctx context.Context, orderID uuid.UUID, userID string) (*models.Order, error) {
 	// Get reservation details
 	reservation, err := s.repository.GetReservationByOrderID(ctx, orderID)
 	if err != nil {
-		return fmt.Errorf("failed to get reservation: %w", err)
+		return nil, fmt.Errorf("failed to get reservation: %w", err)
 	}
 
 	if reservation.UserID != userID {
-		return fmt.Errorf("unauthorized: reservation belongs to different user")
+		return nil, ErrReservationNotOwned
 	}
 
-	if reservation.Status != "ACTIVE" {
-		return fmt.Errorf("reservation is not active")
+	switch {
+	case reservation.Status == models.ReservationStatusConfirmed:
+		order, err := s.repository.GetOrder(ctx, orderID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get order: %w", err)
+		}
+		return order, nil
+	case reservation.Status != models.ReservationStatusActive || !reservation.ExpiresAt.After(time.Now()):
+		return nil, ErrReservationNotActive
+	}
+
+	order := &models.Order{
+		ID:            orderID,
+		UserID:        reservation.UserID,
+		ProductID:     reservation.ProductID,
+		Quantity:      reservation.Quantity,
+		Status:        models.OrderStatusPending,
+		CorrelationID: reservation.CorrelationID,
 	}
 
 	// Create confirmation event
@@ -165,12 +392,22 @@ func (s *inventoryService) ConfirmPurchase(ctx context.Context, orderID uuid.UUI
 		},
 	)
 
-	// Publish confirmation event
-	if err := s.producer.PublishInventoryEvent(ctx, event); err != nil {
-		return fmt.Errorf("failed to publish confirmation event: %w", err)
+	// The confirmation event is queued with the order, so an order that
+	// exists already has its event on the way
+	err = s.repository.CreateOrder(ctx, order, event)
+	if errors.Is(err, repository.ErrOrderExists) {
+		order, err = s.repository.GetOrder(ctx, orderID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get order: %w", err)
+		}
+		return order, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
 	}
+	s.outbox.notify()
 
-	return nil
+	return order, nil
 }
 
 // ReleaseReservation releases a reservation
@@ -182,7 +419,11 @@ func (s *inventoryService) ReleaseReservation(ctx context.Context, orderID uuid.
 	}
 
 	if reservation.UserID != userID {
-		return fmt.Errorf("unauthorized: reservation belongs to different user")
+		return ErrReservationNotOwned
+	}
+
+	if reservation.Status != models.ReservationStatusActive {
+		return ErrReservationNotActive
 	}
 
 	// Create release event
@@ -196,19 +437,99 @@ func (s *inventoryService) ReleaseReservation(ctx context.Context, orderID uuid.
 		},
 	)
 
-	// Publish release event
-	if err := s.producer.PublishInventoryEvent(ctx, event); err != nil {
-		return fmt.Errorf("failed to publish release event: %w", err)
+	if err := s.repository.QueueEvent(ctx, event); err != nil {
+		return fmt.Errorf("failed to queue release event: %w", err)
 	}
+	s.outbox.notify()
 
 	return nil
 }
 
+// GetReservation returns the user's reservation made for an order along with
+// the locations its stock is held at
+func (s *inventoryService) GetReservation(ctx context.Context, orderID uuid.UUID, userID string) (*models.UserReservation, error) {
+	reservation, err := s.repository.GetReservationByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reservation: %w", err)
+	}
+
+	if reservation.UserID != userID {
+		return nil, ErrReservationNotOwned
+	}
+	reservation.Allocations, err = s.repository.GetReservationAllocations(ctx, reservation.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reservation allocations: %w", err)
+	}
+	return reservation, nil
+}
+
+// GetUserReservations returns a page of a user's reservations, newest first
+func (s *inventoryService) GetUserReservations(ctx context.Context, userID string, limit, offset int) (*models.ReservationPage, error) {
+	reservations, total, err := s.repository.GetUserReservations(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user reservations: %w", err)
+	}
+
+	if reservations == nil {
+		reservations = []*models.UserReservation{}
+	}
+	return &models.ReservationPage{
+		Reservations: reservations,
+		Total:        total,
+		Limit:        limit,
+		Offset:       offset,
+	}, nil
+}
+
+// ExtendReservation renews an active hold by the reservation timeout. A hold
+// is extended at most maxExtensions times and never past maxHold after it
+// was made.
+func (s *inventoryService) ExtendReservation(ctx context.Context, orderID uuid.UUID, userID string) (*models.UserReservation, error) {
+	reservation, err := s.repository.GetReservationByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reservation: %w", err)
+	}
+
+	if reservation.UserID != userID {
+		return nil, ErrReservationNotOwned
+	}
+
+	now := time.Now()
+	if reservation.Status != models.ReservationStatusActive || !reservation.ExpiresAt.After(now) {
+		return nil, ErrReservationNotActive
+	}
+
+	expiresAt := now.Add(s.reservationTTL())
+	if limit := reservation.ReservedAt.Add(s.maxHold); expiresAt.After(limit) {
+		expiresAt = limit
+	}
+	if reservation.Extensions >= s.maxExtensions || !expiresAt.After(reservation.ExpiresAt) {
+		return nil, ErrExtensionLimit
+	}
+
+	extended, err := s.repository.ExtendReservation(ctx, reservation.ID, expiresAt, s.maxExtensions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extend reservation: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Extended reservation",
+		"order_id", orderID, "expires_at", extended.ExpiresAt, "extensions", extended.Extensions)
+	return extended, nil
+}
+
 // GetProductInventory gets the current inventory state for a product
 func (s *inventoryService) GetProductInventory(ctx context.Context, productID string) (*models.InventoryState, error) {
 	return s.getInventoryState(ctx, productID)
 }
 
+// lowStockThreshold is the available stock below which a product counts as low on stock
+const lowStockThreshold = 10
+
+// GetInventoryMetrics aggregates inventory figures across all products
+func (s *inventoryService) GetInventoryMetrics(ctx context.Context) (*models.InventoryMetrics, error) {
+	return s.repository.GetInventoryMetrics(ctx, lowStockThreshold)
+}
+
 // StartInventoryProcessor starts the inventory event processor
 func (s *inventoryService) StartInventoryProcessor(ctx context.Context) error {
 	if s.running {
@@ -221,7 +542,7 @@ func (s *inventoryService) StartInventoryProcessor(ctx context.Context) error {
 	s.registerEventHandlers()
 
 	// Start consumer
-	topics := []string{"inventory-events"}
+	topics := []string{kafka.EventsTopic}
 	if err := s.consumer.Start(ctx, topics); err != nil {
 		return fmt.Errorf("failed to start consumer: %w", err)
 	}
@@ -229,7 +550,7 @@ func (s *inventoryService) StartInventoryProcessor(ctx context.Context) error {
 	// Start cleanup routine
 	go s.startCleanupRoutine(ctx)
 
-	log.Println("Inventory processor started successfully")
+	slog.InfoContext(ctx, "Inventory processor started successfully")
 	return nil
 }
 
@@ -243,14 +564,30 @@ func (s *inventoryService) StopInventoryProcessor() {
 	s.stopChan <- true
 
 	if err := s.consumer.Stop(); err != nil {
-		log.Printf("Error stopping consumer: %v", err)
+		slog.Error("Error stopping consumer", "error", err)
 	}
 
-	log.Println("Inventory processor stopped")
+	slog.Info("Inventory processor stopped")
 }
 
 // registerEventHandlers registers all event handlers
 func (s *inventoryService) registerEventHandlers() {
+	// Check events are published for analytics consumers and admin changes
+	// are applied when they are made; the processor has nothing to do for them
+	for _, eventType := range []models.InventoryEventType{
+		models.InventoryEventTypeCheck,
+		models.InventoryEventTypeRestock,
+		models.InventoryEventTypeAdjust,
+		models.InventoryEventTypeProductCreated,
+		models.InventoryEventTypeProductUpdated,
+		models.InventoryEventTypeProductDeleted,
+	} {
+		s.consumer.RegisterHandler(kafka.NewInventoryEventHandler(
+			eventType,
+			func(ctx context.Context, event *models.InventoryEvent) error { return nil },
+		))
+	}
+
 	// Reserve event handler
 	reserveHandler := kafka.NewInventoryEventHandler(
 		models.InventoryEventTypeReserve,
@@ -258,6 +595,13 @@ func (s *inventoryService) registerEventHandlers() {
 	)
 	s.consumer.RegisterHandler(reserveHandler)
 
+	// Batch reserve event handler
+	reserveBatchHandler := kafka.NewInventoryEventHandler(
+		models.InventoryEventTypeReserveBatch,
+		s.handleReserveBatchEvent,
+	)
+	s.consumer.RegisterHandler(reserveBatchHandler)
+
 	// Confirm event handler
 	confirmHandler := kafka.NewInventoryEventHandler(
 		models.InventoryEventTypeConfirm,
@@ -273,111 +617,196 @@ func (s *inventoryService) registerEventHandlers() {
 	s.consumer.RegisterHandler(releaseHandler)
 }
 
-// handleReserveEvent handles inventory reserve events
+// handleReserveEvent handles inventory reserve events. The pending
+// reservation becomes active or rejected and every outcome is replied to the
+// requester; rejections are not errors and are not retried.
 func (s *inventoryService) handleReserveEvent(ctx context.Context, event *models.InventoryEvent) error {
-	// Get current product state
-	product, err := s.repository.GetProduct(ctx, event.ProductID)
-	if err != nil {
-		return fmt.Errorf("failed to get product: %w", err)
-	}
-
-	// Check if enough inventory is available
-	if product.AvailableStock < event.Quantity {
-		log.Printf("Insufficient inventory for product %s: requested %d, available %d",
-			event.ProductID, event.Quantity, product.AvailableStock)
-		return nil // Don't fail, just log
-	}
-
-	// Create reservation
-	reservation := &models.UserReservation{
-		ID:            uuid.New().String(),
-		UserID:        event.UserID,
+	reply := &models.ReservationReply{
+		CorrelationID: event.CorrelationID,
+		OrderID:       eventOrderID(event),
 		ProductID:     event.ProductID,
 		Quantity:      event.Quantity,
-		ReservedAt:    time.Now(),
-		ExpiresAt:     time.Now().Add(s.reservationTimeout),
-		Status:        "ACTIVE",
-		CorrelationID: event.CorrelationID,
 	}
 
-	// Save reservation
-	if err := s.repository.CreateReservation(ctx, reservation); err != nil {
-		return fmt.Errorf("failed to create reservation: %w", err)
-	}
+	// The API server records the reservation as pending before publishing
+	// the event; any other status means the event was delivered again
+	reservation, err := s.repository.GetReservationByCorrelationID(ctx, event.CorrelationID)
+	pending := err == nil
+	switch {
+	case errors.Is(err, repository.ErrReservationNotFound):
+		// Published before reservations were recorded up front
+		if reply.OrderID == uuid.Nil {
+			reply.OrderID = uuid.New()
+		}
+		reservation = &models.UserReservation{
+			ID:            uuid.New().String(),
+			OrderID:       reply.OrderID,
+			UserID:        event.UserID,
+			ProductID:     event.ProductID,
+			Quantity:      event.Quantity,
+			ReservedAt:    time.Now(),
+			CorrelationID: event.CorrelationID,
+		}
+	case err != nil:
+		return fmt.Errorf("failed to get reservation: %w", err)
+	case reservation.Status != models.ReservationStatusPending:
+		s.skipDuplicateEvent(ctx, event, "status")
+		return nil
+	}
+
+	// The hold starts once the stock is reserved
+	pendingExpiry := reservation.ExpiresAt
+	reservation.ExpiresAt = time.Now().Add(s.reservationTTL())
+	product, err := s.repository.ReserveStock(ctx, event, reservation, pending, newAllocator(event.Allocation))
+	switch {
+	case errors.Is(err, repository.ErrDuplicateEvent):
+		s.skipDuplicateEvent(ctx, event, "ledger")
+		return nil
+	case errors.Is(err, repository.ErrProductNotFound):
+		slog.WarnContext(ctx, "Rejected reservation of unknown product", "product_id", event.ProductID)
+		return s.rejectReservation(ctx, reservation, pending, pendingExpiry, reply, models.ReservationRejectedProductNotFound)
+	case errors.Is(err, repository.ErrInsufficientStock):
+		if current, err := s.repository.GetProduct(ctx, event.ProductID); err == nil {
+			reply.AvailableStock = current.AvailableStock
+		}
+		slog.WarnContext(ctx, "Insufficient inventory",
+			"product_id", event.ProductID, "requested", reservation.Quantity, "available", reply.AvailableStock)
+		return s.rejectReservation(ctx, reservation, pending, pendingExpiry, reply, models.ReservationRejectedInsufficientStock)
+	case errors.Is(err, repository.ErrReservationChanged):
+		s.skipDuplicateEvent(ctx, event, "status")
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to reserve stock: %w", err)
+	}
+
+	s.applyProductState(product)
+
+	reply.Reserved = true
+	reply.AvailableStock = product.AvailableStock
+	reply.ReservedUntil = &reservation.ExpiresAt
+	reply.Allocations = reservation.Allocations
+	s.publishReservationReply(ctx, reply)
+
+	slog.InfoContext(ctx, "Successfully reserved inventory",
+		"quantity", reservation.Quantity, "product_id", event.ProductID, "user_id", event.UserID)
+	return nil
+}
 
-	// Update product inventory
-	if err := s.repository.UpdateProductInventory(ctx, event.ProductID,
-		product.AvailableStock-event.Quantity,
-		product.ReservedStock+event.Quantity,
-		product.Version+1); err != nil {
-		return fmt.Errorf("failed to update product inventory: %w", err)
+// rejectReservation records why a pending reservation was rejected and tells
+// the requester. Rejections are final, so the event is not retried.
+func (s *inventoryService) rejectReservation(ctx context.Context, reservation *models.UserReservation, pending bool, expiresAt time.Time, reply *models.ReservationReply, reason string) error {
+	if pending {
+		err := s.repository.ResolvePendingReservation(ctx, reservation.ID, models.ReservationStatusRejected, reason, expiresAt)
+		if err != nil && !errors.Is(err, repository.ErrReservationNotFound) {
+			return fmt.Errorf("failed to reject reservation: %w", err)
+		}
 	}
 
-	// Update cache
-	s.updateStateCache(event.ProductID, &models.InventoryState{
-		ProductID:      event.ProductID,
-		AvailableStock: product.AvailableStock - event.Quantity,
-		ReservedStock:  product.ReservedStock + event.Quantity,
-		TotalStock:     product.TotalStock,
-		LastUpdated:    time.Now(),
-		Version:        product.Version + 1,
-	})
+	reply.Reason = reason
+	s.publishReservationReply(ctx, reply)
+	return nil
+}
 
-	// Publish state update
-	state := s.getStateFromCache(event.ProductID)
-	if state != nil {
-		s.producer.PublishInventoryState(ctx, state)
+// publishReservationReply tells the requester how its reservation went. A
+// lost reply only leaves the request pending, so failures are logged.
+func (s *inventoryService) publishReservationReply(ctx context.Context, reply *models.ReservationReply) {
+	if err := s.publisher.PublishReservationReply(ctx, reply); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish reservation reply",
+			"correlation_id", reply.CorrelationID, "error", err)
 	}
+}
 
-	log.Printf("Successfully reserved %d units of product %s for user %s",
-		event.Quantity, event.ProductID, event.UserID)
-	return nil
+// eventOrderID returns the order ID the API server put in the event metadata
+func eventOrderID(event *models.InventoryEvent) uuid.UUID {
+	orderID, _ := event.Metadata["orderId"].(string)
+	id, err := uuid.Parse(orderID)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
 }
 
-// handleConfirmEvent handles inventory confirm events
+// handleConfirmEvent handles inventory confirm events. The reservation, its
+// stock and its order are confirmed together, and the order is COMPLETED
+// right after. A redelivered event completes an order that was left
+// CONFIRMED when that last step failed.
 func (s *inventoryService) handleConfirmEvent(ctx context.Context, event *models.InventoryEvent) error {
 	// Get reservation
 	reservation, err := s.repository.GetReservationByCorrelationID(ctx, event.CorrelationID)
+	if errors.Is(err, repository.ErrReservationNotFound) {
+		// Reservations are recorded before their events are published
+		return kafka.Permanent(fmt.Errorf("failed to get reservation: %w", err))
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get reservation: %w", err)
 	}
 
-	// Update reservation status
-	if err := s.repository.UpdateReservationStatus(ctx, reservation.ID, "CONFIRMED"); err != nil {
-		return fmt.Errorf("failed to update reservation status: %w", err)
+	switch reservation.Status {
+	case models.ReservationStatusActive:
+	case models.ReservationStatusConfirmed:
+		if err := s.completeOrder(ctx, reservation.OrderID); err != nil {
+			return err
+		}
+		s.skipDuplicateEvent(ctx, event, "status")
+		return nil
+	default:
+		// The hold lapsed or was released before the confirmation arrived
+		slog.WarnContext(ctx, "Cancelling order for inactive reservation",
+			"order_id", reservation.OrderID, "status", reservation.Status)
+		return s.advanceOrder(ctx, reservation.OrderID, models.OrderStatusCancelled)
 	}
 
-	// Update product inventory (move from reserved to sold)
-	product, err := s.repository.GetProduct(ctx, event.ProductID)
+	// Move the quantity from reserved to sold
+	product, err := s.repository.ConfirmReservationStock(ctx, event, reservation)
+	if errors.Is(err, repository.ErrDuplicateEvent) {
+		s.skipDuplicateEvent(ctx, event, "ledger")
+		return nil
+	}
+	if errors.Is(err, repository.ErrReservationChanged) {
+		// Released or confirmed concurrently; the next delivery sorts it out
+		return fmt.Errorf("reservation %s changed while confirming: %w", reservation.OrderID, err)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to get product: %w", err)
+		return fmt.Errorf("failed to confirm reservation stock: %w", err)
 	}
 
-	if err := s.repository.UpdateProductInventory(ctx, event.ProductID,
-		product.AvailableStock,
-		product.ReservedStock-event.Quantity,
-		product.Version+1); err != nil {
-		return fmt.Errorf("failed to update product inventory: %w", err)
+	s.applyProductState(product)
+
+	if err := s.advanceOrder(ctx, reservation.OrderID, models.OrderStatusCompleted); err != nil {
+		return err
 	}
 
-	// Update cache
-	s.updateStateCache(event.ProductID, &models.InventoryState{
-		ProductID:      event.ProductID,
-		AvailableStock: product.AvailableStock,
-		ReservedStock:  product.ReservedStock - event.Quantity,
-		TotalStock:     product.TotalStock,
-		LastUpdated:    time.Now(),
-		Version:        product.Version + 1,
-	})
+	slog.InfoContext(ctx, "Successfully confirmed purchase",
+		"quantity", reservation.Quantity, "product_id", event.ProductID, "user_id", event.UserID)
+	return nil
+}
 
-	// Publish state update
-	state := s.getStateFromCache(event.ProductID)
-	if state != nil {
-		s.producer.PublishInventoryState(ctx, state)
+// completeOrder completes an order its confirmation left CONFIRMED
+func (s *inventoryService) completeOrder(ctx context.Context, orderID uuid.UUID) error {
+	order, err := s.repository.GetOrder(ctx, orderID)
+	if errors.Is(err, repository.ErrOrderNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get order: %w", err)
 	}
+	if order.Status != models.OrderStatusConfirmed {
+		return nil
+	}
+	return s.advanceOrder(ctx, orderID, models.OrderStatusCompleted)
+}
 
-	log.Printf("Successfully confirmed purchase of %d units of product %s for user %s",
-		event.Quantity, event.ProductID, event.UserID)
+// advanceOrder moves an order to status. Confirmations published before
+// orders were recorded have no order to move.
+func (s *inventoryService) advanceOrder(ctx context.Context, orderID uuid.UUID, status string) error {
+	err := s.repository.UpdateOrderStatus(ctx, orderID, status)
+	if errors.Is(err, repository.ErrOrderNotFound) {
+		slog.WarnContext(ctx, "No order to update", "order_id", orderID, "status", status)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
 	return nil
 }
 
@@ -385,55 +814,86 @@ func (s *inventoryService) handleConfirmEvent(ctx context.Context, event *models
 func (s *inventoryService) handleReleaseEvent(ctx context.Context, event *models.InventoryEvent) error {
 	// Get reservation
 	reservation, err := s.repository.GetReservationByCorrelationID(ctx, event.CorrelationID)
+	if errors.Is(err, repository.ErrReservationNotFound) {
+		// Reservations are recorded before their events are published
+		return kafka.Permanent(fmt.Errorf("failed to get reservation: %w", err))
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get reservation: %w", err)
 	}
 
-	// Update reservation status
-	if err := s.repository.UpdateReservationStatus(ctx, reservation.ID, "RELEASED"); err != nil {
-		return fmt.Errorf("failed to update reservation status: %w", err)
+	// Confirmed or already released reservations hold no stock to give back
+	if reservation.Status != models.ReservationStatusActive {
+		slog.InfoContext(ctx, "Skipping release of inactive reservation",
+			"order_id", reservation.OrderID, "status", reservation.Status)
+		return nil
 	}
 
-	// Update product inventory (move from reserved back to available)
-	product, err := s.repository.GetProduct(ctx, event.ProductID)
-	if err != nil {
-		return fmt.Errorf("failed to get product: %w", err)
+	// Holds found expired by the cleanup may have been extended since; the
+	// repository only expires those still past their expiry
+	status := models.ReservationStatusReleased
+	if reason, _ := event.Metadata["reason"].(string); reason == "expired" {
+		status = models.ReservationStatusExpired
 	}
 
-	if err := s.repository.UpdateProductInventory(ctx, event.ProductID,
-		product.AvailableStock+event.Quantity,
-		product.ReservedStock-event.Quantity,
-		product.Version+1); err != nil {
-		return fmt.Errorf("failed to update product inventory: %w", err)
+	// Move the quantity from reserved back to available
+	product, err := s.repository.ReleaseReservationStock(ctx, event, reservation, status)
+	if errors.Is(err, repository.ErrDuplicateEvent) {
+		s.skipDuplicateEvent(ctx, event, "ledger")
+		return nil
 	}
-
-	// Update cache
-	s.updateStateCache(event.ProductID, &models.InventoryState{
-		ProductID:      event.ProductID,
-		AvailableStock: product.AvailableStock + event.Quantity,
-		ReservedStock:  product.ReservedStock - event.Quantity,
-		TotalStock:     product.TotalStock,
-		LastUpdated:    time.Now(),
-		Version:        product.Version + 1,
-	})
-
-	// Publish state update
-	state := s.getStateFromCache(event.ProductID)
-	if state != nil {
-		s.producer.PublishInventoryState(ctx, state)
+	if errors.Is(err, repository.ErrReservationChanged) {
+		slog.InfoContext(ctx, "Skipping release of reservation that changed or was extended concurrently",
+			"order_id", reservation.OrderID, "status", status)
+		return nil
 	}
+	if err != nil {
+		return fmt.Errorf("failed to release reservation stock: %w", err)
+	}
+
+	s.applyProductState(product)
 
-	log.Printf("Successfully released %d units of product %s for user %s",
-		event.Quantity, event.ProductID, event.UserID)
+	slog.InfoContext(ctx, "Successfully released reservation",
+		"quantity", reservation.Quantity, "product_id", event.ProductID, "user_id", event.UserID)
 	return nil
 }
 
+// skipDuplicateEvent counts an event that was delivered again after being
+// processed. check names what caught it: the ledger of processed events or
+// the status of the reservation the event belongs to.
+func (s *inventoryService) skipDuplicateEvent(ctx context.Context, event *models.InventoryEvent, check string) {
+	metrics.InventoryDuplicateEvents.WithLabelValues(string(event.EventType), check).Inc()
+	slog.InfoContext(ctx, "Skipping event that was already processed",
+		"event_type", event.EventType, "event_id", event.EventID, "correlation_id", event.CorrelationID, "check", check)
+}
+
+// applyProductState caches the stock a change left a product with. The
+// change queued the state for the outbox relay, which is woken to publish it.
+func (s *inventoryService) applyProductState(product *models.Product) {
+	state := &models.InventoryState{
+		ProductID:      product.ID,
+		AvailableStock: product.AvailableStock,
+		ReservedStock:  product.ReservedStock,
+		TotalStock:     product.TotalStock,
+		LastUpdated:    product.UpdatedAt,
+		Version:        product.Version,
+		Locations:      product.Locations,
+	}
+	s.updateStateCache(product.ID, state)
+	s.outbox.notify()
+}
+
 // Helper methods
 
+// getInventoryState returns a product's stock. Only the worker applies stock
+// changes, so only it keeps the cache; the API server reads the database,
+// where a cached state would go stale as soon as the worker changed it.
 func (s *inventoryService) getInventoryState(ctx context.Context, productID string) (*models.InventoryState, error) {
 	// Try cache first
-	if state := s.getStateFromCache(productID); state != nil {
-		return state, nil
+	if s.consumer != nil {
+		if state := s.getStateFromCache(productID); state != nil {
+			return state, nil
+		}
 	}
 
 	// Get from database
@@ -441,6 +901,10 @@ func (s *inventoryService) getInventoryState(ctx context.Context, productID stri
 	if err != nil {
 		return nil, err
 	}
+	locations, err := s.repository.GetLocationStock(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
 
 	state := &models.InventoryState{
 		ProductID:      productID,
@@ -449,10 +913,12 @@ func (s *inventoryService) getInventoryState(ctx context.Context, productID stri
 		TotalStock:     product.TotalStock,
 		LastUpdated:    product.UpdatedAt,
 		Version:        product.Version,
+		Locations:      locations,
 	}
 
-	// Update cache
-	s.updateStateCache(productID, state)
+	if s.consumer != nil {
+		s.updateStateCache(productID, state)
+	}
 	return state, nil
 }
 
@@ -483,9 +949,15 @@ func (s *inventoryService) startCleanupRoutine(ctx context.Context) {
 }
 
 func (s *inventoryService) cleanupExpiredReservations(ctx context.Context) {
+	if expired, err := s.repository.ExpirePendingReservations(ctx); err != nil {
+		slog.ErrorContext(ctx, "Failed to expire pending reservations", "error", err)
+	} else if expired > 0 {
+		slog.WarnContext(ctx, "Expired reservations that were never processed", "count", expired)
+	}
+
 	expiredReservations, err := s.repository.GetExpiredReservations(ctx)
 	if err != nil {
-		log.Printf("Failed to get expired reservations: %v", err)
+		slog.ErrorContext(ctx, "Failed to get expired reservations", "error", err)
 		return
 	}
 
@@ -501,12 +973,14 @@ func (s *inventoryService) cleanupExpiredReservations(ctx context.Context) {
 			},
 		)
 
-		if err := s.producer.PublishInventoryEvent(ctx, event); err != nil {
-			log.Printf("Failed to publish release event for expired reservation: %v", err)
+		if err := s.repository.QueueEvent(ctx, event); err != nil {
+			slog.ErrorContext(ctx, "Failed to queue release event for expired reservation",
+				"reservation_id", reservation.ID, "error", err)
 		}
 	}
+	s.outbox.notify()
 
 	if len(expiredReservations) > 0 {
-		log.Printf("Cleaned up %d expired reservations", len(expiredReservations))
+		slog.InfoContext(ctx, "Cleaned up expired reservations", "count", len(expiredReservations))
 	}
 }
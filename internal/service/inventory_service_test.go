@@ -0,0 +1,737 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"url-shortener/internal/kafka"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stockRepository serves a product whose stock the test changes, counting
+// the reads
+type stockRepository struct {
+	repository.InventoryRepository
+	product *models.Product
+	reads   int
+}
+
+func (r *stockRepository) GetProduct(_ context.Context, productID string) (*models.Product, error) {
+	r.reads++
+	product := *r.product
+	return &product, nil
+}
+
+func (r *stockRepository) GetLocationStock(_ context.Context, productID string) ([]models.LocationStock, error) {
+	return []models.LocationStock{{LocationID: models.DefaultLocationID, AvailableStock: r.product.AvailableStock}}, nil
+}
+
+func TestInventoryService_GetProductInventory_ReadsDatabaseWithoutConsumer(t *testing.T) {
+	repo := &stockRepository{product: &models.Product{ID: productA, AvailableStock: 5, TotalStock: 5}}
+	s := &inventoryService{repository: repo, stateCache: make(map[string]*models.InventoryState)}
+
+	state, err := s.GetProductInventory(context.Background(), productA)
+	require.NoError(t, err)
+	assert.Equal(t, 5, state.AvailableStock)
+
+	// The worker reserves stock; the API server sees it on the next read
+	repo.product.AvailableStock = 3
+	repo.product.ReservedStock = 2
+
+	state, err = s.GetProductInventory(context.Background(), productA)
+	require.NoError(t, err)
+	assert.Equal(t, 3, state.AvailableStock)
+	assert.Equal(t, 2, state.ReservedStock)
+	assert.Equal(t, 3, state.Locations[0].AvailableStock)
+	assert.Equal(t, 2, repo.reads)
+	assert.Empty(t, s.stateCache)
+}
+
+// confirmRepository confirms a reservation and its order like the database
+// would, failing the first failUpdates order status updates
+type confirmRepository struct {
+	repository.InventoryRepository
+	reservation *models.UserReservation
+	order       *models.Order
+	product     *models.Product
+	failUpdates int
+}
+
+func (r *confirmRepository) GetReservationByCorrelationID(_ context.Context, _ uuid.UUID) (*models.UserReservation, error) {
+	reservation := *r.reservation
+	return &reservation, nil
+}
+
+func (r *confirmRepository) ConfirmReservationStock(_ context.Context, _ *models.InventoryEvent, reservation *models.UserReservation) (*models.Product, error) {
+	r.reservation.Status = models.ReservationStatusConfirmed
+	r.order.Status = models.OrderStatusConfirmed
+	r.product.ReservedStock -= reservation.Quantity
+	r.product.TotalStock -= reservation.Quantity
+	product := *r.product
+	return &product, nil
+}
+
+func (r *confirmRepository) GetOrder(_ context.Context, _ uuid.UUID) (*models.Order, error) {
+	order := *r.order
+	return &order, nil
+}
+
+func (r *confirmRepository) UpdateOrderStatus(_ context.Context, _ uuid.UUID, status string) error {
+	if r.failUpdates > 0 {
+		r.failUpdates--
+		return errors.New("connection reset")
+	}
+	r.order.Status = status
+	return nil
+}
+
+func TestInventoryService_HandleConfirmEvent_CompletesOrderOnRedelivery(t *testing.T) {
+	orderID := uuid.New()
+	repo := &confirmRepository{
+		reservation: &models.UserReservation{OrderID: orderID, ProductID: productA, Quantity: 2, Status: models.ReservationStatusActive},
+		order:       &models.Order{ID: orderID, Status: models.OrderStatusPending},
+		product:     &models.Product{ID: productA, TotalStock: 10, ReservedStock: 2, AvailableStock: 8},
+		failUpdates: 1,
+	}
+	s := newBatchTestService(repo)
+	s.stateCache = make(map[string]*models.InventoryState)
+	event := &models.InventoryEvent{EventID: uuid.New(), EventType: models.InventoryEventTypeConfirm, CorrelationID: uuid.New(), ProductID: productA}
+
+	// The order could not be completed after the stock was confirmed
+	require.Error(t, s.handleConfirmEvent(context.Background(), event))
+	assert.Equal(t, models.OrderStatusConfirmed, repo.order.Status)
+
+	// The redelivered event finds the reservation confirmed and completes it
+	require.NoError(t, s.handleConfirmEvent(context.Background(), event))
+	assert.Equal(t, models.OrderStatusCompleted, repo.order.Status)
+
+	// Further deliveries leave the completed order alone
+	repo.failUpdates = 1
+	require.NoError(t, s.handleConfirmEvent(context.Background(), event))
+	assert.Equal(t, models.OrderStatusCompleted, repo.order.Status)
+}
+
+// replyRecorder records the reservation replies it is asked to publish
+type replyRecorder struct {
+	replies []*models.ReservationReply
+}
+
+func (r *replyRecorder) PublishReservationReply(_ context.Context, reply *models.ReservationReply) error {
+	r.replies = append(r.replies, reply)
+	return nil
+}
+
+// reserveRepository reserves stock of product for the pending reservation,
+// or fails with reserveErr
+type reserveRepository struct {
+	repository.InventoryRepository
+	reservation *models.UserReservation
+	product     *models.Product
+	reserveErr  error
+	calls       int
+	resolved    []string
+}
+
+func (r *reserveRepository) GetReservationByCorrelationID(_ context.Context, _ uuid.UUID) (*models.UserReservation, error) {
+	reservation := *r.reservation
+	return &reservation, nil
+}
+
+func (r *reserveRepository) ReserveStock(_ context.Context, _ *models.InventoryEvent, reservation *models.UserReservation, _ bool, allocate repository.Allocator) (*models.Product, error) {
+	r.calls++
+	if r.reserveErr != nil {
+		return nil, r.reserveErr
+	}
+	reservation.Allocations = allocate([]models.LocationStock{{LocationID: models.DefaultLocationID, AvailableStock: r.product.AvailableStock}}, reservation.Quantity)
+	r.product.AvailableStock -= reservation.Quantity
+	r.product.ReservedStock += reservation.Quantity
+	product := *r.product
+	return &product, nil
+}
+
+func (r *reserveRepository) GetProduct(_ context.Context, _ string) (*models.Product, error) {
+	product := *r.product
+	return &product, nil
+}
+
+func (r *reserveRepository) ResolvePendingReservation(_ context.Context, _ string, status, reason string, _ time.Time) error {
+	r.resolved = append(r.resolved, status+" "+reason)
+	return nil
+}
+
+func newReserveTestService(repo repository.InventoryRepository) (*inventoryService, *replyRecorder) {
+	replies := &replyRecorder{}
+	s := newBatchTestService(repo)
+	s.publisher = replies
+	s.stateCache = make(map[string]*models.InventoryState)
+	return s, replies
+}
+
+func newReserveTestRepository(available int) *reserveRepository {
+	return &reserveRepository{
+		reservation: &models.UserReservation{ID: uuid.New().String(), OrderID: uuid.New(), ProductID: productA, Quantity: 2, Status: models.ReservationStatusPending},
+		product:     &models.Product{ID: productA, TotalStock: available, AvailableStock: available},
+	}
+}
+
+func newReserveEvent() *models.InventoryEvent {
+	return &models.InventoryEvent{EventID: uuid.New(), EventType: models.InventoryEventTypeReserve, CorrelationID: uuid.New(), ProductID: productA, Quantity: 2}
+}
+
+func TestInventoryService_HandleReserveEvent(t *testing.T) {
+	repo := newReserveTestRepository(5)
+	s, replies := newReserveTestService(repo)
+
+	require.NoError(t, s.handleReserveEvent(context.Background(), newReserveEvent()))
+
+	require.Len(t, replies.replies, 1)
+	reply := replies.replies[0]
+	assert.True(t, reply.Reserved)
+	assert.Equal(t, 3, reply.AvailableStock)
+	assert.Equal(t, []models.LocationAllocation{{LocationID: models.DefaultLocationID, Quantity: 2}}, reply.Allocations)
+	assert.Equal(t, 1, repo.calls)
+	assert.Equal(t, 2, s.stateCache[productA].ReservedStock)
+	assert.Empty(t, repo.resolved)
+}
+
+func TestInventoryService_HandleReserveEvent_InsufficientStock(t *testing.T) {
+	repo := newReserveTestRepository(1)
+	repo.reserveErr = repository.ErrInsufficientStock
+	s, replies := newReserveTestService(repo)
+
+	// The rejection is final, so the event is not retried
+	require.NoError(t, s.handleReserveEvent(context.Background(), newReserveEvent()))
+
+	assert.Equal(t, []string{models.ReservationStatusRejected + " " + models.ReservationRejectedInsufficientStock}, repo.resolved)
+	require.Len(t, replies.replies, 1)
+	reply := replies.replies[0]
+	assert.False(t, reply.Reserved)
+	assert.Equal(t, models.ReservationRejectedInsufficientStock, reply.Reason)
+	assert.Equal(t, 1, reply.AvailableStock)
+}
+
+func TestInventoryService_HandleReserveEvent_Conflict(t *testing.T) {
+	repo := newReserveTestRepository(5)
+	repo.reserveErr = fmt.Errorf("failed to commit transaction: %w", &pq.Error{Code: "40001"})
+	s, replies := newReserveTestService(repo)
+
+	// A conflict that outlasted the transaction retries is retried by the
+	// consumer, and the reservation stays pending until then
+	err := s.handleReserveEvent(context.Background(), newReserveEvent())
+	require.Error(t, err)
+	assert.False(t, kafka.IsPermanent(err))
+	assert.Empty(t, repo.resolved)
+	assert.Empty(t, replies.replies)
+}
+
+func TestInventoryService_HandleConfirmEvent_SellsReservedStock(t *testing.T) {
+	orderID := uuid.New()
+	repo := &confirmRepository{
+		reservation: &models.UserReservation{OrderID: orderID, ProductID: productA, Quantity: 2, Status: models.ReservationStatusActive},
+		order:       &models.Order{ID: orderID, Status: models.OrderStatusPending},
+		product:     &models.Product{ID: productA, TotalStock: 10, ReservedStock: 2, AvailableStock: 8},
+	}
+	s := newBatchTestService(repo)
+	s.stateCache = make(map[string]*models.InventoryState)
+	event := &models.InventoryEvent{EventID: uuid.New(), EventType: models.InventoryEventTypeConfirm, CorrelationID: uuid.New(), ProductID: productA}
+
+	require.NoError(t, s.handleConfirmEvent(context.Background(), event))
+
+	// The sold quantity leaves the reserved and the total stock
+	state := s.stateCache[productA]
+	require.NotNil(t, state)
+	assert.Equal(t, 8, state.TotalStock)
+	assert.Equal(t, 0, state.ReservedStock)
+	assert.Equal(t, 8, state.AvailableStock)
+	assert.Equal(t, models.OrderStatusCompleted, repo.order.Status)
+}
+
+func TestInventoryService_HandleReserveEvent_SkipsRedelivery(t *testing.T) {
+	t.Run("reservation no longer pending", func(t *testing.T) {
+		repo := newReserveTestRepository(5)
+		repo.reservation.Status = models.ReservationStatusActive
+		s, replies := newReserveTestService(repo)
+
+		require.NoError(t, s.handleReserveEvent(context.Background(), newReserveEvent()))
+		assert.Zero(t, repo.calls)
+		assert.Empty(t, replies.replies)
+	})
+
+	t.Run("event in the ledger", func(t *testing.T) {
+		repo := newReserveTestRepository(5)
+		repo.reserveErr = repository.ErrDuplicateEvent
+		s, replies := newReserveTestService(repo)
+
+		require.NoError(t, s.handleReserveEvent(context.Background(), newReserveEvent()))
+		assert.Equal(t, 1, repo.calls)
+		assert.Empty(t, repo.resolved)
+		assert.Empty(t, replies.replies)
+		assert.Empty(t, s.stateCache)
+	})
+}
+
+// idempotencyRepository holds the reservations made with Idempotency-Keys.
+// Reservations in concurrent are made by a concurrent request just before
+// the one being tested records its own.
+type idempotencyRepository struct {
+	repository.InventoryRepository
+	reservations map[string]*models.UserReservation
+	concurrent   map[string]*models.UserReservation
+	created      int
+}
+
+func (r *idempotencyRepository) GetReservationByIdempotencyKey(_ context.Context, _, key string) (*models.UserReservation, error) {
+	reservation, ok := r.reservations[key]
+	if !ok {
+		return nil, repository.ErrReservationNotFound
+	}
+	return reservation, nil
+}
+
+func (r *idempotencyRepository) CreateReservation(_ context.Context, reservation *models.UserReservation, _ *models.InventoryEvent) error {
+	if existing, ok := r.concurrent[reservation.IdempotencyKey]; ok {
+		r.reservations[reservation.IdempotencyKey] = existing
+		return repository.ErrIdempotencyKeyExists
+	}
+	r.created++
+	r.reservations[reservation.IdempotencyKey] = reservation
+	return nil
+}
+
+func TestInventoryService_ReserveInventory_Replay(t *testing.T) {
+	expiresAt := time.Now().Add(15 * time.Minute)
+	reservation := func(status, reason string) *models.UserReservation {
+		return &models.UserReservation{
+			OrderID:   uuid.New(),
+			ProductID: productA,
+			Quantity:  2,
+			Status:    status,
+			Reason:    reason,
+			ExpiresAt: expiresAt,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		reservation *models.UserReservation
+		status      string
+		reason      string
+	}{
+		{"pending", reservation(models.ReservationStatusPending, ""), models.PurchaseStatusPending, ""},
+		{"active", reservation(models.ReservationStatusActive, ""), models.PurchaseStatusReserved, ""},
+		{"confirmed since", reservation(models.ReservationStatusConfirmed, ""), models.PurchaseStatusReserved, ""},
+		{"rejected", reservation(models.ReservationStatusRejected, models.ReservationRejectedInsufficientStock), models.PurchaseStatusRejected, models.ReservationRejectedInsufficientStock},
+		{"expired after reserving", reservation(models.ReservationStatusExpired, ""), models.PurchaseStatusReserved, ""},
+		{"expired before processing", reservation(models.ReservationStatusExpired, models.ReservationExpiredUnprocessed), models.PurchaseStatusRejected, models.ReservationExpiredUnprocessed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &idempotencyRepository{reservations: map[string]*models.UserReservation{"key-1": tt.reservation}}
+			s := newBatchTestService(repo)
+
+			response, err := s.ReserveInventory(context.Background(), &models.PurchaseRequest{
+				ProductID: productA, Quantity: 2, UserID: "user", IdempotencyKey: "key-1",
+			})
+			require.NoError(t, err)
+			assert.True(t, response.Replayed)
+			assert.Equal(t, tt.reservation.OrderID, response.OrderID)
+			assert.Equal(t, tt.status, response.Status)
+			assert.Equal(t, tt.reason, response.Reason)
+			assert.Nil(t, response.AvailableStock)
+			assert.Zero(t, repo.created)
+		})
+	}
+}
+
+func TestInventoryService_ReserveInventory_IdempotencyKeyReused(t *testing.T) {
+	earlier := &models.UserReservation{OrderID: uuid.New(), ProductID: productA, Quantity: 2, Status: models.ReservationStatusActive}
+
+	tests := []struct {
+		name      string
+		productID string
+		quantity  int
+	}{
+		{"other product", productB, 2},
+		{"other quantity", productA, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &idempotencyRepository{reservations: map[string]*models.UserReservation{"key-1": earlier}}
+			s := newBatchTestService(repo)
+
+			response, err := s.ReserveInventory(context.Background(), &models.PurchaseRequest{
+				ProductID: tt.productID, Quantity: tt.quantity, UserID: "user", IdempotencyKey: "key-1",
+			})
+			assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+			assert.Nil(t, response)
+			assert.Zero(t, repo.created)
+		})
+	}
+}
+
+func TestInventoryService_ReserveInventory_ConcurrentReplay(t *testing.T) {
+	earlier := &models.UserReservation{OrderID: uuid.New(), ProductID: productA, Quantity: 2, Status: models.ReservationStatusPending}
+	repo := &idempotencyRepository{
+		reservations: map[string]*models.UserReservation{},
+		concurrent:   map[string]*models.UserReservation{"key-1": earlier},
+	}
+	s := newBatchTestService(repo)
+
+	// The request that recorded the key first answers both
+	response, err := s.ReserveInventory(context.Background(), &models.PurchaseRequest{
+		ProductID: productA, Quantity: 2, UserID: "user", IdempotencyKey: "key-1",
+	})
+	require.NoError(t, err)
+	assert.True(t, response.Replayed)
+	assert.Equal(t, earlier.OrderID, response.OrderID)
+	assert.Zero(t, repo.created)
+}
+
+// releaseRepository releases stock the way the database would: an expiry
+// only applies while the stored hold has run out. The reservation read by
+// the service is the one the cleanup saw, stored is the one in the database.
+type releaseRepository struct {
+	repository.InventoryRepository
+	seen     *models.UserReservation
+	stored   *models.UserReservation
+	product  *models.Product
+	released int
+}
+
+func (r *releaseRepository) GetReservationByCorrelationID(_ context.Context, _ uuid.UUID) (*models.UserReservation, error) {
+	reservation := *r.seen
+	return &reservation, nil
+}
+
+func (r *releaseRepository) ReleaseReservationStock(_ context.Context, _ *models.InventoryEvent, reservation *models.UserReservation, status string) (*models.Product, error) {
+	if r.stored.Status != models.ReservationStatusActive ||
+		(status == models.ReservationStatusExpired && r.stored.ExpiresAt.After(time.Now())) {
+		return nil, repository.ErrReservationChanged
+	}
+	r.released++
+	r.stored.Status = status
+	r.product.AvailableStock += reservation.Quantity
+	r.product.ReservedStock -= reservation.Quantity
+	product := *r.product
+	return &product, nil
+}
+
+func TestInventoryService_HandleReleaseEvent_Expiry(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name      string
+		storedAt  time.Time
+		status    string
+		released  int
+		available int
+	}{
+		{"hold ran out", expired, models.ReservationStatusExpired, 1, 5},
+		{"extended since it was found expired", time.Now().Add(10 * time.Minute), models.ReservationStatusActive, 0, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := &models.UserReservation{ID: uuid.New().String(), OrderID: uuid.New(), ProductID: productA, Quantity: 2, Status: models.ReservationStatusActive, ExpiresAt: expired}
+			stored := *seen
+			stored.ExpiresAt = tt.storedAt
+			repo := &releaseRepository{seen: seen, stored: &stored, product: &models.Product{ID: productA, TotalStock: 5, AvailableStock: 3, ReservedStock: 2}}
+			s := newBatchTestService(repo)
+			s.stateCache = make(map[string]*models.InventoryState)
+
+			event := &models.InventoryEvent{
+				EventID:       uuid.New(),
+				EventType:     models.InventoryEventTypeRelease,
+				CorrelationID: uuid.New(),
+				ProductID:     productA,
+				Metadata:      map[string]interface{}{"reason": "expired"},
+			}
+			require.NoError(t, s.handleReleaseEvent(context.Background(), event))
+
+			assert.Equal(t, tt.status, stored.Status)
+			assert.Equal(t, tt.released, repo.released)
+			assert.Equal(t, tt.available, repo.product.AvailableStock)
+		})
+	}
+}
+
+// lifecycleRepository holds one reservation and extends it the way the
+// database would
+type lifecycleRepository struct {
+	repository.InventoryRepository
+	reservation *models.UserReservation
+	page        []*models.UserReservation
+	extendedTo  []time.Time
+}
+
+func (r *lifecycleRepository) GetReservationByOrderID(_ context.Context, orderID uuid.UUID) (*models.UserReservation, error) {
+	if r.reservation == nil || orderID != r.reservation.OrderID {
+		return nil, repository.ErrReservationNotFound
+	}
+	reservation := *r.reservation
+	return &reservation, nil
+}
+
+func (r *lifecycleRepository) GetReservationAllocations(_ context.Context, _ string) ([]models.LocationAllocation, error) {
+	return []models.LocationAllocation{{LocationID: models.DefaultLocationID, Quantity: r.reservation.Quantity}}, nil
+}
+
+func (r *lifecycleRepository) GetUserReservations(_ context.Context, _ string, _, _ int) ([]*models.UserReservation, int, error) {
+	return r.page, len(r.page), nil
+}
+
+func (r *lifecycleRepository) ExtendReservation(_ context.Context, _ string, expiresAt time.Time, _ int) (*models.UserReservation, error) {
+	r.extendedTo = append(r.extendedTo, expiresAt)
+	r.reservation.ExpiresAt = expiresAt
+	r.reservation.Extensions++
+	reservation := *r.reservation
+	return &reservation, nil
+}
+
+func TestInventoryService_GetReservation(t *testing.T) {
+	reservation := &models.UserReservation{ID: uuid.New().String(), OrderID: uuid.New(), UserID: "owner", Quantity: 2, Status: models.ReservationStatusActive}
+	s := newBatchTestService(&lifecycleRepository{reservation: reservation})
+
+	got, err := s.GetReservation(context.Background(), reservation.OrderID, "owner")
+	require.NoError(t, err)
+	assert.Equal(t, []models.LocationAllocation{{LocationID: models.DefaultLocationID, Quantity: 2}}, got.Allocations)
+
+	_, err = s.GetReservation(context.Background(), reservation.OrderID, "someone else")
+	assert.ErrorIs(t, err, ErrReservationNotOwned)
+
+	_, err = s.GetReservation(context.Background(), uuid.New(), "owner")
+	assert.ErrorIs(t, err, repository.ErrReservationNotFound)
+}
+
+func TestInventoryService_GetUserReservations(t *testing.T) {
+	s := newBatchTestService(&lifecycleRepository{})
+
+	// An empty page lists no reservations rather than null
+	page, err := s.GetUserReservations(context.Background(), "owner", 20, 40)
+	require.NoError(t, err)
+	assert.NotNil(t, page.Reservations)
+	assert.Empty(t, page.Reservations)
+	assert.Equal(t, 20, page.Limit)
+	assert.Equal(t, 40, page.Offset)
+}
+
+func TestInventoryService_ExtendReservation(t *testing.T) {
+	const ttl = 15 * time.Minute
+
+	tests := []struct {
+		name       string
+		userID     string
+		status     string
+		reservedAt time.Duration // before now
+		expiresIn  time.Duration
+		extensions int
+		err        error
+		extendedBy time.Duration // after now
+	}{
+		{"renews the hold", "owner", models.ReservationStatusActive, 5 * time.Minute, 10 * time.Minute, 0, nil, ttl},
+		{"capped at the maximum hold", "owner", models.ReservationStatusActive, 50 * time.Minute, 5 * time.Minute, 1, nil, 10 * time.Minute},
+		{"already at the maximum hold", "owner", models.ReservationStatusActive, 55 * time.Minute, 5 * time.Minute, 1, ErrExtensionLimit, 0},
+		{"extended too often", "owner", models.ReservationStatusActive, 5 * time.Minute, 10 * time.Minute, 3, ErrExtensionLimit, 0},
+		{"hold ran out", "owner", models.ReservationStatusActive, 20 * time.Minute, -time.Minute, 0, ErrReservationNotActive, 0},
+		{"confirmed", "owner", models.ReservationStatusConfirmed, 5 * time.Minute, 10 * time.Minute, 0, ErrReservationNotActive, 0},
+		{"someone else's", "someone else", models.ReservationStatusActive, 5 * time.Minute, 10 * time.Minute, 0, ErrReservationNotOwned, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			repo := &lifecycleRepository{reservation: &models.UserReservation{
+				ID:         uuid.New().String(),
+				OrderID:    uuid.New(),
+				UserID:     "owner",
+				Status:     tt.status,
+				ReservedAt: now.Add(-tt.reservedAt),
+				ExpiresAt:  now.Add(tt.expiresIn),
+				Extensions: tt.extensions,
+			}}
+			s := newBatchTestService(repo)
+			s.SetReservationTimeout(ttl)
+			s.maxExtensions = 3
+			s.maxHold = time.Hour
+
+			extended, err := s.ExtendReservation(context.Background(), repo.reservation.OrderID, tt.userID)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Empty(t, repo.extendedTo)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, repo.extendedTo, 1)
+			assert.WithinDuration(t, now.Add(tt.extendedBy), extended.ExpiresAt, time.Second)
+			assert.Equal(t, tt.extensions+1, extended.Extensions)
+		})
+	}
+}
+
+// orderRepository places and moves orders the way the database would,
+// recording every status an order passes through
+type orderRepository struct {
+	repository.InventoryRepository
+	reservation *models.UserReservation
+	orders      map[uuid.UUID]*models.Order
+	statuses    []string
+	queued      int
+}
+
+func (r *orderRepository) GetReservationByOrderID(_ context.Context, _ uuid.UUID) (*models.UserReservation, error) {
+	reservation := *r.reservation
+	return &reservation, nil
+}
+
+func (r *orderRepository) GetReservationByCorrelationID(_ context.Context, _ uuid.UUID) (*models.UserReservation, error) {
+	reservation := *r.reservation
+	return &reservation, nil
+}
+
+func (r *orderRepository) CreateOrder(_ context.Context, order *models.Order, _ *models.InventoryEvent) error {
+	if _, ok := r.orders[order.ID]; ok {
+		return repository.ErrOrderExists
+	}
+	created := *order
+	r.orders[order.ID] = &created
+	r.statuses = append(r.statuses, order.Status)
+	r.queued++
+	return nil
+}
+
+func (r *orderRepository) GetOrder(_ context.Context, orderID uuid.UUID) (*models.Order, error) {
+	order, ok := r.orders[orderID]
+	if !ok {
+		return nil, repository.ErrOrderNotFound
+	}
+	found := *order
+	return &found, nil
+}
+
+func (r *orderRepository) ConfirmReservationStock(_ context.Context, _ *models.InventoryEvent, reservation *models.UserReservation) (*models.Product, error) {
+	r.reservation.Status = models.ReservationStatusConfirmed
+	if order, ok := r.orders[reservation.OrderID]; ok && order.Status == models.OrderStatusPending {
+		order.Status = models.OrderStatusConfirmed
+		r.statuses = append(r.statuses, order.Status)
+	}
+	return &models.Product{ID: reservation.ProductID}, nil
+}
+
+func (r *orderRepository) UpdateOrderStatus(_ context.Context, orderID uuid.UUID, status string) error {
+	order, ok := r.orders[orderID]
+	if !ok {
+		return repository.ErrOrderNotFound
+	}
+	order.Status = status
+	r.statuses = append(r.statuses, status)
+	return nil
+}
+
+func newOrderTestService(status string) (*inventoryService, *orderRepository) {
+	repo := &orderRepository{
+		reservation: &models.UserReservation{
+			ID:            uuid.New().String(),
+			OrderID:       uuid.New(),
+			UserID:        "owner",
+			ProductID:     productA,
+			Quantity:      2,
+			Status:        status,
+			ExpiresAt:     time.Now().Add(10 * time.Minute),
+			CorrelationID: uuid.New(),
+		},
+		orders: make(map[uuid.UUID]*models.Order),
+	}
+	s := newBatchTestService(repo)
+	s.stateCache = make(map[string]*models.InventoryState)
+	return s, repo
+}
+
+func newConfirmEvent(reservation *models.UserReservation) *models.InventoryEvent {
+	return &models.InventoryEvent{EventID: uuid.New(), EventType: models.InventoryEventTypeConfirm, CorrelationID: reservation.CorrelationID, ProductID: productA}
+}
+
+func TestInventoryService_OrderLifecycle(t *testing.T) {
+	s, repo := newOrderTestService(models.ReservationStatusActive)
+	orderID := repo.reservation.OrderID
+
+	// The order is placed under the reservation's order ID
+	order, err := s.ConfirmPurchase(context.Background(), orderID, "owner")
+	require.NoError(t, err)
+	assert.Equal(t, orderID, order.ID)
+	assert.Equal(t, models.OrderStatusPending, order.Status)
+	assert.Equal(t, repo.reservation.CorrelationID, order.CorrelationID)
+
+	// Confirming again before the processor got to it returns the same order
+	again, err := s.ConfirmPurchase(context.Background(), orderID, "owner")
+	require.NoError(t, err)
+	assert.Equal(t, orderID, again.ID)
+	assert.Equal(t, 1, repo.queued)
+
+	require.NoError(t, s.handleConfirmEvent(context.Background(), newConfirmEvent(repo.reservation)))
+	assert.Equal(t, []string{models.OrderStatusPending, models.OrderStatusConfirmed, models.OrderStatusCompleted}, repo.statuses)
+
+	// Confirming once the stock is sold returns the completed order
+	again, err = s.ConfirmPurchase(context.Background(), orderID, "owner")
+	require.NoError(t, err)
+	assert.Equal(t, orderID, again.ID)
+	assert.Equal(t, models.OrderStatusCompleted, again.Status)
+	assert.Equal(t, 1, repo.queued)
+
+	_, err = s.ConfirmPurchase(context.Background(), orderID, "someone else")
+	assert.ErrorIs(t, err, ErrReservationNotOwned)
+}
+
+func TestInventoryService_HandleConfirmEvent_Redelivered(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    string // status of the order, none when empty
+		statuses []string
+	}{
+		{"order left confirmed", models.OrderStatusConfirmed, []string{models.OrderStatusCompleted}},
+		{"order completed", models.OrderStatusCompleted, nil},
+		{"order cancelled", models.OrderStatusCancelled, nil},
+		{"no order", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo := newOrderTestService(models.ReservationStatusConfirmed)
+			orderID := repo.reservation.OrderID
+			if tt.order != "" {
+				repo.orders[orderID] = &models.Order{ID: orderID, Status: tt.order}
+			}
+
+			require.NoError(t, s.handleConfirmEvent(context.Background(), newConfirmEvent(repo.reservation)))
+			assert.Equal(t, tt.statuses, repo.statuses)
+		})
+	}
+}
+
+func TestInventoryService_HandleConfirmEvent_InactiveReservation(t *testing.T) {
+	t.Run("order cancelled", func(t *testing.T) {
+		s, repo := newOrderTestService(models.ReservationStatusExpired)
+		orderID := repo.reservation.OrderID
+		repo.orders[orderID] = &models.Order{ID: orderID, Status: models.OrderStatusPending}
+
+		require.NoError(t, s.handleConfirmEvent(context.Background(), newConfirmEvent(repo.reservation)))
+		assert.Equal(t, []string{models.OrderStatusCancelled}, repo.statuses)
+	})
+
+	t.Run("no order to cancel", func(t *testing.T) {
+		s, repo := newOrderTestService(models.ReservationStatusReleased)
+
+		require.NoError(t, s.handleConfirmEvent(context.Background(), newConfirmEvent(repo.reservation)))
+		assert.Empty(t, repo.statuses)
+	})
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"url-shortener/internal/cache"
+	"url-shortener/internal/config"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+// linkCache keeps link metadata in an in-process LRU in front of Redis, which
+// sits in front of Postgres. Entries are evicted explicitly on every mutation
+// rather than left to expire.
+type linkCache struct {
+	cfg         config.CacheConfig
+	urlRepo     repository.URLRepository
+	redisClient redis.UniversalClient
+	local       *cache.LRU[cachedLink]
+	lookups     singleflight.Group
+	invalidator *cache.Invalidator
+}
+
+// cachedLink is an entry of the in-process cache. Unknown short codes are
+// cached with a nil url so scanners cannot hammer Postgres.
+type cachedLink struct {
+	url *models.URL
+}
+
+func newLinkCache(urlRepo repository.URLRepository, redisClient redis.UniversalClient, cfg config.CacheConfig) *linkCache {
+	c := &linkCache{
+		cfg:         cfg,
+		urlRepo:     urlRepo,
+		redisClient: redisClient,
+		local:       cache.NewLRU[cachedLink](cfg.LocalSize),
+		invalidator: cache.NewInvalidator(redisClient, cfg.InvalidationChannel),
+	}
+	c.invalidator.OnInvalidate(func(shortCodes []string) {
+		for _, shortCode := range shortCodes {
+			c.local.Delete(shortCode)
+		}
+	})
+	return c
+}
+
+func linkKey(shortCode string) string {
+	return fmt.Sprintf("url:%s", shortCode)
+}
+
+func reverseKey(originalURL string) string {
+	return fmt.Sprintf("reverse:%s", originalURL)
+}
+
+// resolve returns the metadata of an active, unexpired link. Status and expiry
+// are checked on every hit so cached links stop resolving on time.
+func (c *linkCache) resolve(ctx context.Context, shortCode string) (*models.URL, error) {
+	url, err := c.lookup(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if !url.IsActive {
+		return nil, repository.ErrURLNotFound
+	}
+	if url.ExpiresAt != nil && !url.ExpiresAt.After(time.Now()) {
+		return nil, repository.ErrURLExpired
+	}
+	return url, nil
+}
+
+// lookup tries the in-process cache, then Redis, then Postgres. Concurrent
+// misses for the same code share one Redis and database lookup.
+func (c *linkCache) lookup(ctx context.Context, shortCode string) (*models.URL, error) {
+	if entry, ok := c.local.Get(shortCode); ok {
+		if entry.url == nil {
+			metrics.CacheRequests.WithLabelValues("local", "negative_hit").Inc()
+			return nil, repository.ErrURLNotFound
+		}
+		metrics.CacheRequests.WithLabelValues("local", "hit").Inc()
+		return entry.url, nil
+	}
+	metrics.CacheRequests.WithLabelValues("local", "miss").Inc()
+
+	// The shared lookup must not fail for every waiter because the request
+	// that started it was cancelled, but it keeps that request's deadline.
+	// Each waiter still gives up when its own context is done.
+	results := c.lookups.DoChan(shortCode, func() (interface{}, error) {
+		lookupCtx := context.WithoutCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			lookupCtx, cancel = context.WithDeadline(lookupCtx, deadline)
+			defer cancel()
+		}
+		return c.load(lookupCtx, shortCode)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(*models.URL), nil
+	}
+}
+
+// load fills the cache tiers from Redis or Postgres
+func (c *linkCache) load(ctx context.Context, shortCode string) (*models.URL, error) {
+	value, err := c.redisClient.Get(ctx, linkKey(shortCode)).Result()
+	switch {
+	case err == nil:
+		url, decodeErr := cache.DecodeLink(shortCode, value)
+		if decodeErr == nil {
+			metrics.CacheRequests.WithLabelValues("redis", "hit").Inc()
+			_, localTTL := c.ttls(url)
+			c.local.Set(shortCode, cachedLink{url: url}, localTTL)
+			return url, nil
+		}
+		// Values from another encoding version are replaced from Postgres
+		metrics.CacheRequests.WithLabelValues("redis", "miss").Inc()
+		if !errors.Is(decodeErr, cache.ErrUnsupportedEncoding) {
+			slog.WarnContext(ctx, "Failed to decode cached URL", "short_code", shortCode, "error", decodeErr)
+		}
+	case err == redis.Nil:
+		metrics.CacheRequests.WithLabelValues("redis", "miss").Inc()
+	default:
+		// Redis is slow, down or its circuit is open: fall back to Postgres
+		// and keep serving from the in-process cache
+		metrics.CacheRequests.WithLabelValues("redis", "error").Inc()
+	}
+
+	url, err := c.urlRepo.GetByShortCode(ctx, shortCode)
+	if err != nil {
+		if errors.Is(err, repository.ErrURLNotFound) || errors.Is(err, repository.ErrURLExpired) {
+			c.local.Set(shortCode, cachedLink{}, c.cfg.NegativeTTL)
+		}
+		return nil, err
+	}
+
+	c.store(ctx, url)
+	return url, nil
+}
+
+// ttls bounds the cache lifetimes of a link by its expiry
+func (c *linkCache) ttls(url *models.URL) (redisTTL, localTTL time.Duration) {
+	redisTTL, localTTL = c.cfg.RedisTTL, c.cfg.LocalTTL
+	if url.ExpiresAt != nil {
+		untilExpiry := time.Until(*url.ExpiresAt)
+		redisTTL, localTTL = min(redisTTL, untilExpiry), min(localTTL, untilExpiry)
+	}
+	return redisTTL, localTTL
+}
+
+// store caches a link in both tiers
+func (c *linkCache) store(ctx context.Context, url *models.URL) {
+	redisTTL, localTTL := c.ttls(url)
+	if redisTTL <= 0 {
+		return
+	}
+
+	if err := c.redisClient.Set(ctx, linkKey(url.ShortCode), cache.EncodeLink(url), redisTTL).Err(); err != nil {
+		slog.WarnContext(ctx, "Failed to cache URL", "short_code", url.ShortCode, "error", err)
+	}
+	c.local.Set(url.ShortCode, cachedLink{url: url}, localTTL)
+}
+
+// invalidate evicts links and their duplicate-detection entries from Redis,
+// and drops them from the in-process cache of every replica, including
+// negative entries for codes that were just created
+func (c *linkCache) invalidate(ctx context.Context, urls ...models.URL) {
+	var keys, shortCodes []string
+	for _, url := range urls {
+		if url.ShortCode == "" {
+			continue
+		}
+		keys = append(keys, linkKey(url.ShortCode))
+		shortCodes = append(shortCodes, url.ShortCode)
+		if url.OriginalURL != "" {
+			keys = append(keys, reverseKey(url.OriginalURL))
+		}
+	}
+	if len(shortCodes) == 0 {
+		return
+	}
+
+	if err := c.redisClient.Del(ctx, keys...).Err(); err != nil {
+		slog.WarnContext(ctx, "Failed to evict cached URLs", "short_codes", shortCodes, "error", err)
+	}
+	if err := c.invalidator.Publish(ctx, shortCodes...); err != nil {
+		slog.WarnContext(ctx, "Failed to broadcast cache invalidation", "short_codes", shortCodes, "error", err)
+	}
+}
+
+// warm loads up to limit of the most-clicked links into both tiers and
+// returns how many were cached
+func (c *linkCache) warm(ctx context.Context, limit int) (int, error) {
+	urls, err := c.urlRepo.GetMostClicked(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	pipe := c.redisClient.Pipeline()
+	for i := range urls {
+		url := &urls[i]
+		redisTTL, localTTL := c.ttls(url)
+		if redisTTL <= 0 {
+			continue
+		}
+		pipe.Set(ctx, linkKey(url.ShortCode), cache.EncodeLink(url), redisTTL)
+		c.local.Set(url.ShortCode, cachedLink{url: url}, localTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("failed to cache most clicked URLs: %w", err)
+	}
+
+	return len(urls), nil
+}
+
+// invalidatingURLRepository evicts cached links after every mutation so
+// changes take effect immediately instead of when cache entries expire.
+// Eviction runs even if ctx is cancelled once the mutation has succeeded.
+type invalidatingURLRepository struct {
+	repository.URLRepository
+	links *linkCache
+}
+
+// NewInvalidatingURLRepository wraps urlRepo so that creating, updating,
+// deleting or expiring links through it evicts them from every cache tier
+func NewInvalidatingURLRepository(urlRepo repository.URLRepository, redisClient redis.UniversalClient, cfg config.CacheConfig) repository.URLRepository {
+	return &invalidatingURLRepository{URLRepository: urlRepo, links: newLinkCache(urlRepo, redisClient, cfg)}
+}
+
+func (r *invalidatingURLRepository) Create(ctx context.Context, url *models.URL) error {
+	if err := r.URLRepository.Create(ctx, url); err != nil {
+		return err
+	}
+
+	// A lookup of the code before it existed may have been cached as unknown
+	r.links.invalidate(context.WithoutCancel(ctx), models.URL{ShortCode: url.ShortCode})
+	return nil
+}
+
+func (r *invalidatingURLRepository) Update(ctx context.Context, url *models.URL) error {
+	// The short code and previous destination are needed to find the entries
+	previous, err := r.URLRepository.GetByID(ctx, url.ID)
+	if err != nil {
+		return err
+	}
+	if err := r.URLRepository.Update(ctx, url); err != nil {
+		return err
+	}
+
+	r.links.invalidate(context.WithoutCancel(ctx), *previous)
+	return nil
+}
+
+func (r *invalidatingURLRepository) Delete(ctx context.Context, id int) error {
+	previous, err := r.URLRepository.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.URLRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	r.links.invalidate(context.WithoutCancel(ctx), *previous)
+	return nil
+}
+
+func (r *invalidatingURLRepository) ExpireByShortCodes(ctx context.Context, shortCodes []string) ([]models.URL, error) {
+	expired, err := r.URLRepository.ExpireByShortCodes(ctx, shortCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	r.links.invalidate(context.WithoutCancel(ctx), expired...)
+	return expired, nil
+}
+
+// RunCacheInvalidation applies invalidations from other replicas until ctx is done
+func (s *urlService) RunCacheInvalidation(ctx context.Context) {
+	s.links.invalidator.Run(ctx)
+}
+
+// WarmCache loads the most-clicked links into the cache tiers
+func (s *urlService) WarmCache(ctx context.Context) error {
+	if s.links.cfg.WarmTopN == 0 {
+		return nil
+	}
+
+	count, err := s.links.warm(ctx, s.links.cfg.WarmTopN)
+	if err != nil {
+		return fmt.Errorf("failed to warm URL cache: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Warmed URL cache", "links", count)
+	return nil
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+)
+
+// outboxPublisher publishes messages read from the outbox
+type outboxPublisher interface {
+	PublishOutboxMessage(ctx context.Context, message *models.OutboxMessage) error
+}
+
+// outboxRelay publishes the outbox to Kafka. Messages are recorded in the
+// transaction of the change they describe, so they are published exactly for
+// the changes that committed, at least once and, per product, in commit
+// order. Every replica runs a relay; the outbox lock lets one publish at a
+// time.
+type outboxRelay struct {
+	repository repository.InventoryRepository
+	publisher  outboxPublisher
+	interval   time.Duration
+	batchSize  int
+	retention  time.Duration
+
+	// Wakes the relay when this replica queued messages
+	wake chan struct{}
+}
+
+func newOutboxRelay(repository repository.InventoryRepository, publisher outboxPublisher, cfg config.InventoryConfig) *outboxRelay {
+	return &outboxRelay{
+		repository: repository,
+		publisher:  publisher,
+		interval:   cfg.OutboxInterval,
+		batchSize:  cfg.OutboxBatchSize,
+		retention:  cfg.OutboxRetention,
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// notify makes the relay publish without waiting for its next poll
+func (r *outboxRelay) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run publishes the outbox until ctx is done, deleting sent messages once
+// they are older than the retention
+func (r *outboxRelay) run(ctx context.Context) {
+	poll := time.NewTicker(r.interval)
+	defer poll.Stop()
+	purge := time.NewTicker(min(r.retention, time.Hour))
+	defer purge.Stop()
+
+	for {
+		r.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+		case <-r.wake:
+		case <-purge.C:
+			r.purge(ctx)
+		}
+	}
+}
+
+// drain publishes batches until the outbox is empty or publishing fails.
+// Messages that failed are retried on the next poll.
+func (r *outboxRelay) drain(ctx context.Context) {
+	for {
+		sent, err := r.repository.RelayOutbox(ctx, r.batchSize, func(message *models.OutboxMessage) error {
+			return r.publisher.PublishOutboxMessage(ctx, message)
+		})
+		metrics.InventoryOutboxRelayed.Add(float64(sent))
+		if err != nil {
+			if ctx.Err() == nil {
+				metrics.InventoryOutboxErrors.Inc()
+				slog.ErrorContext(ctx, "Failed to relay outbox", "sent", sent, "error", err)
+			}
+			return
+		}
+		if sent < r.batchSize {
+			return
+		}
+	}
+}
+
+func (r *outboxRelay) purge(ctx context.Context) {
+	deleted, err := r.repository.DeleteSentOutbox(ctx, time.Now().Add(-r.retention))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to delete sent outbox messages", "error", err)
+		return
+	}
+	if deleted > 0 {
+		slog.InfoContext(ctx, "Deleted sent outbox messages", "count", deleted)
+	}
+}
+
+// RunOutboxRelay publishes messages queued in the outbox until ctx is done
+func (s *inventoryService) RunOutboxRelay(ctx context.Context) {
+	s.outbox.run(ctx)
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// outboxRepository serves queued messages the way RelayOutbox does: in
+// order, stopping at the first failed publish
+type outboxRepository struct {
+	repository.InventoryRepository
+	queued []*models.OutboxMessage
+	calls  int
+}
+
+func (r *outboxRepository) RelayOutbox(_ context.Context, limit int, publish func(*models.OutboxMessage) error) (int, error) {
+	r.calls++
+	sent := 0
+	for _, message := range r.queued[:min(limit, len(r.queued))] {
+		if err := publish(message); err != nil {
+			r.queued = r.queued[sent:]
+			return sent, err
+		}
+		sent++
+	}
+	r.queued = r.queued[sent:]
+	return sent, nil
+}
+
+type outboxRecorder struct {
+	failOn    int64
+	published []int64
+}
+
+func (p *outboxRecorder) PublishOutboxMessage(_ context.Context, message *models.OutboxMessage) error {
+	if message.ID == p.failOn {
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, message.ID)
+	return nil
+}
+
+func queuedMessages(n int) []*models.OutboxMessage {
+	messages := make([]*models.OutboxMessage, n)
+	for i := range messages {
+		messages[i] = &models.OutboxMessage{ID: int64(i + 1), Kind: models.OutboxKindInventoryEvent}
+	}
+	return messages
+}
+
+func TestOutboxRelayDrain(t *testing.T) {
+	repo := &outboxRepository{queued: queuedMessages(5)}
+	publisher := &outboxRecorder{}
+	relay := &outboxRelay{repository: repo, publisher: publisher, batchSize: 2}
+
+	relay.drain(context.Background())
+
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, publisher.published)
+	assert.Equal(t, 3, repo.calls)
+	assert.Empty(t, repo.queued)
+}
+
+func TestOutboxRelayDrain_StopsAtFailedMessage(t *testing.T) {
+	repo := &outboxRepository{queued: queuedMessages(5)}
+	publisher := &outboxRecorder{failOn: 3}
+	relay := &outboxRelay{repository: repo, publisher: publisher, batchSize: 2}
+
+	relay.drain(context.Background())
+
+	// Nothing overtakes the failed message; it is retried on the next poll
+	assert.Equal(t, []int64{1, 2}, publisher.published)
+	assert.Equal(t, int64(3), repo.queued[0].ID)
+
+	publisher.failOn = 0
+	relay.drain(context.Background())
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, publisher.published)
+}
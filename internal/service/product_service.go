@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidAdjustment is returned when a stock adjustment does not carry the
+// amount its reason needs
+var ErrInvalidAdjustment = errors.New("invalid stock adjustment")
+
+// ErrInvalidLocation is returned when a location's coordinates are incomplete
+var ErrInvalidLocation = errors.New("invalid location")
+
+// ProductService manages products and their stock on behalf of admins. Every
+// change is recorded in the event ledger and published through the outbox
+// with the stock it left, so the audit trail and the inventory-state topic
+// agree with the database.
+type ProductService interface {
+	ListProducts(ctx context.Context) ([]*models.Product, error)
+	GetProduct(ctx context.Context, productID string) (*models.Product, error)
+	CreateProduct(ctx context.Context, req *models.CreateProductRequest) (*models.Product, error)
+	UpdateProduct(ctx context.Context, productID string, req *models.UpdateProductRequest) (*models.Product, error)
+	DeleteProduct(ctx context.Context, productID string) error
+	RestockProduct(ctx context.Context, productID string, req *models.RestockRequest) (*models.StockChangeResponse, error)
+	AdjustStock(ctx context.Context, productID string, req *models.StockAdjustmentRequest) (*models.StockChangeResponse, error)
+	ListLocations(ctx context.Context) ([]*models.Location, error)
+	CreateLocation(ctx context.Context, req *models.CreateLocationRequest) (*models.Location, error)
+}
+
+type productService struct {
+	repository repository.InventoryRepository
+}
+
+// NewProductService creates a new product service
+func NewProductService(repository repository.InventoryRepository) ProductService {
+	return &productService{repository: repository}
+}
+
+// newProductEvent creates an event for an admin change. It is applied when
+// it is made, so it starts its own correlation.
+func newProductEvent(eventType models.InventoryEventType, productID string, quantity int, metadata map[string]interface{}) *models.InventoryEvent {
+	return &models.InventoryEvent{
+		EventID:       uuid.New(),
+		EventType:     eventType,
+		ProductID:     productID,
+		Quantity:      quantity,
+		Timestamp:     time.Now(),
+		CorrelationID: uuid.New(),
+		Metadata:      metadata,
+	}
+}
+
+// ListProducts returns every product that was not deleted, newest first
+func (s *productService) ListProducts(ctx context.Context) ([]*models.Product, error) {
+	products, err := s.repository.GetAllProducts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get products: %w", err)
+	}
+	return products, nil
+}
+
+// GetProduct returns a product with its stock per location
+func (s *productService) GetProduct(ctx context.Context, productID string) (*models.Product, error) {
+	product, err := s.repository.GetProduct(ctx, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+	product.Locations, err = s.repository.GetLocationStock(ctx, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+	return product, nil
+}
+
+// CreateProduct creates a product with its initial stock available at a
+// location
+func (s *productService) CreateProduct(ctx context.Context, req *models.CreateProductRequest) (*models.Product, error) {
+	if req.ID == "" {
+		req.ID = uuid.New().String()
+	}
+
+	product := &models.Product{
+		ID:             req.ID,
+		Name:           req.Name,
+		Description:    req.Description,
+		Price:          req.Price,
+		TotalStock:     req.Stock,
+		AvailableStock: req.Stock,
+		Version:        1,
+	}
+	locationID := locationOrDefault(req.LocationID)
+	event := newProductEvent(models.InventoryEventTypeProductCreated, product.ID, req.Stock, map[string]interface{}{
+		"name":       product.Name,
+		"price":      product.Price,
+		"locationId": locationID,
+	})
+
+	if err := s.repository.CreateProduct(ctx, product, event, locationID); err != nil {
+		return nil, fmt.Errorf("failed to create product: %w", err)
+	}
+	return product, nil
+}
+
+// UpdateProduct changes a product's name, description and price
+func (s *productService) UpdateProduct(ctx context.Context, productID string, req *models.UpdateProductRequest) (*models.Product, error) {
+	product := &models.Product{
+		ID:          productID,
+		Name:        req.Name,
+		Description: req.Description,
+		Price:       req.Price,
+	}
+	event := newProductEvent(models.InventoryEventTypeProductUpdated, productID, 0, map[string]interface{}{
+		"name":  product.Name,
+		"price": product.Price,
+	})
+
+	if err := s.repository.UpdateProduct(ctx, product, event); err != nil {
+		return nil, fmt.Errorf("failed to update product: %w", err)
+	}
+	return product, nil
+}
+
+// DeleteProduct deletes a product that no reservation holds stock of. Its
+// available stock is written off.
+func (s *productService) DeleteProduct(ctx context.Context, productID string) error {
+	event := newProductEvent(models.InventoryEventTypeProductDeleted, productID, 0, nil)
+	if err := s.repository.DeleteProduct(ctx, event); err != nil {
+		return fmt.Errorf("failed to delete product: %w", err)
+	}
+	return nil
+}
+
+// RestockProduct adds stock received at a location to a product
+func (s *productService) RestockProduct(ctx context.Context, productID string, req *models.RestockRequest) (*models.StockChangeResponse, error) {
+	locationID := locationOrDefault(req.LocationID)
+	metadata := noteMetadata(req.Note)
+	metadata["locationId"] = locationID
+	event := newProductEvent(models.InventoryEventTypeRestock, productID, req.Quantity, metadata)
+
+	product, err := s.repository.RestockProduct(ctx, event, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restock product: %w", err)
+	}
+
+	metrics.InventoryStockChanges.WithLabelValues("restock").Inc()
+	return &models.StockChangeResponse{EventID: event.EventID, Quantity: event.Quantity, Product: product}, nil
+}
+
+// AdjustStock corrects a product's stock at a location. Damage and shrinkage
+// remove units; a recount sets the location's total stock to what was
+// counted.
+func (s *productService) AdjustStock(ctx context.Context, productID string, req *models.StockAdjustmentRequest) (*models.StockChangeResponse, error) {
+	locationID := locationOrDefault(req.LocationID)
+	metadata := noteMetadata(req.Note)
+	metadata["reason"] = req.Reason
+	metadata["locationId"] = locationID
+
+	var quantity int
+	switch req.Reason {
+	case models.AdjustmentReasonRecount:
+		if req.Counted == nil || req.Quantity != 0 {
+			return nil, fmt.Errorf("%w: a recount takes the counted stock and no quantity", ErrInvalidAdjustment)
+		}
+		metadata["counted"] = *req.Counted
+	case models.AdjustmentReasonDamage, models.AdjustmentReasonShrinkage:
+		if req.Quantity <= 0 || req.Counted != nil {
+			return nil, fmt.Errorf("%w: %s takes the quantity removed", ErrInvalidAdjustment, strings.ToLower(req.Reason))
+		}
+		quantity = -req.Quantity
+	default:
+		return nil, fmt.Errorf("%w: unknown reason %q", ErrInvalidAdjustment, req.Reason)
+	}
+
+	event := newProductEvent(models.InventoryEventTypeAdjust, productID, quantity, metadata)
+	product, err := s.repository.AdjustStock(ctx, event, req.Counted, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to adjust stock: %w", err)
+	}
+
+	metrics.InventoryStockChanges.WithLabelValues(strings.ToLower(req.Reason)).Inc()
+	return &models.StockChangeResponse{EventID: event.EventID, Quantity: event.Quantity, Product: product}, nil
+}
+
+// ListLocations returns every location stock can be held at
+func (s *productService) ListLocations(ctx context.Context) ([]*models.Location, error) {
+	locations, err := s.repository.GetLocations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get locations: %w", err)
+	}
+	return locations, nil
+}
+
+// CreateLocation adds a location stock can be held at
+func (s *productService) CreateLocation(ctx context.Context, req *models.CreateLocationRequest) (*models.Location, error) {
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		return nil, fmt.Errorf("%w: latitude and longitude go together", ErrInvalidLocation)
+	}
+
+	location := &models.Location{
+		ID:        req.ID,
+		Name:      req.Name,
+		Region:    req.Region,
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+	}
+	if err := s.repository.CreateLocation(ctx, location); err != nil {
+		return nil, fmt.Errorf("failed to create location: %w", err)
+	}
+	return location, nil
+}
+
+// locationOrDefault returns the location a stock change applies to
+func locationOrDefault(locationID string) string {
+	if locationID == "" {
+		return models.DefaultLocationID
+	}
+	return locationID
+}
+
+func noteMetadata(note string) map[string]interface{} {
+	metadata := make(map[string]interface{})
+	if note != "" {
+		metadata["note"] = note
+	}
+	return metadata
+}
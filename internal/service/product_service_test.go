@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// adjustmentRepository records the adjustments it is asked to make
+type adjustmentRepository struct {
+	repository.InventoryRepository
+	events    []*models.InventoryEvent
+	counted   []*int
+	locations []string
+}
+
+func (r *adjustmentRepository) AdjustStock(_ context.Context, event *models.InventoryEvent, counted *int, locationID string) (*models.Product, error) {
+	r.events = append(r.events, event)
+	r.counted = append(r.counted, counted)
+	r.locations = append(r.locations, locationID)
+	return &models.Product{ID: event.ProductID}, nil
+}
+
+func TestProductService_AdjustStock(t *testing.T) {
+	counted := 7
+	tests := []struct {
+		name     string
+		req      models.StockAdjustmentRequest
+		quantity int
+		counted  *int
+		location string
+		invalid  bool
+	}{
+		{name: "damage", req: models.StockAdjustmentRequest{Reason: models.AdjustmentReasonDamage, Quantity: 3}, quantity: -3},
+		{name: "shrinkage", req: models.StockAdjustmentRequest{Reason: models.AdjustmentReasonShrinkage, Quantity: 1, Note: "missing"}, quantity: -1},
+		{name: "recount", req: models.StockAdjustmentRequest{Reason: models.AdjustmentReasonRecount, Counted: &counted}, counted: &counted},
+		{name: "recount at location", req: models.StockAdjustmentRequest{Reason: models.AdjustmentReasonRecount, Counted: &counted, LocationID: "hcm-1"}, counted: &counted, location: "hcm-1"},
+		{name: "damage without quantity", req: models.StockAdjustmentRequest{Reason: models.AdjustmentReasonDamage}, invalid: true},
+		{name: "damage with count", req: models.StockAdjustmentRequest{Reason: models.AdjustmentReasonDamage, Quantity: 1, Counted: &counted}, invalid: true},
+		{name: "recount without count", req: models.StockAdjustmentRequest{Reason: models.AdjustmentReasonRecount}, invalid: true},
+		{name: "recount with quantity", req: models.StockAdjustmentRequest{Reason: models.AdjustmentReasonRecount, Quantity: 2, Counted: &counted}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &adjustmentRepository{}
+			s := NewProductService(repo)
+
+			response, err := s.AdjustStock(context.Background(), "product", &tt.req)
+			if tt.invalid {
+				assert.ErrorIs(t, err, ErrInvalidAdjustment)
+				assert.Empty(t, repo.events)
+				return
+			}
+			require.NoError(t, err)
+
+			require.Len(t, repo.events, 1)
+			event := repo.events[0]
+			assert.Equal(t, models.InventoryEventTypeAdjust, event.EventType)
+			assert.Equal(t, "product", event.ProductID)
+			assert.Equal(t, tt.quantity, event.Quantity)
+			assert.Equal(t, tt.req.Reason, event.Metadata["reason"])
+			assert.Equal(t, tt.counted, repo.counted[0])
+			location := tt.location
+			if location == "" {
+				location = models.DefaultLocationID
+			}
+			assert.Equal(t, location, repo.locations[0])
+			assert.Equal(t, location, event.Metadata["locationId"])
+
+			assert.Equal(t, event.EventID, response.EventID)
+			assert.Equal(t, "product", response.Product.ID)
+		})
+	}
+}
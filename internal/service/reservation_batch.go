@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"url-shortener/internal/kafka"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ReserveBatch reserves every item of a cart or none of them. Each item gets
+// a pending reservation under its own order ID, so it is confirmed and
+// released like any other, and a single event asks the processor to reserve
+// them together. Like ReserveInventory it waits up to the reply timeout and
+// reports the batch as pending when no outcome arrives in time.
+func (s *inventoryService) ReserveBatch(ctx context.Context, req *models.BatchPurchaseRequest) (*models.BatchPurchaseResponse, error) {
+	if err := validateAllocationPolicy(req.AllocationPolicy); err != nil {
+		return nil, err
+	}
+
+	// Sorted items let the processor lock the products in a fixed order
+	items := make([]models.InventoryEventItem, len(req.Items))
+	for i, item := range req.Items {
+		items[i] = models.InventoryEventItem{
+			OrderID:   uuid.New(),
+			ProductID: strings.ToLower(item.ProductID),
+			Quantity:  item.Quantity,
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ProductID < items[j].ProductID })
+	for i := 1; i < len(items); i++ {
+		if items[i].ProductID == items[i-1].ProductID {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateBatchItem, items[i].ProductID)
+		}
+	}
+
+	batchID := uuid.New()
+	now := time.Now()
+	reservedUntil := now.Add(s.reservationTTL())
+	event := s.producer.CreateInventoryReserveBatchEvent(req.UserID, batchID, items, map[string]interface{}{
+		"reservedUntil": reservedUntil.Format(time.RFC3339),
+	})
+	event.Allocation = eventAllocation(req.AllocationPolicy)
+
+	reservations := make([]*models.UserReservation, len(items))
+	for i, item := range items {
+		reservations[i] = &models.UserReservation{
+			ID:            uuid.New().String(),
+			OrderID:       item.OrderID,
+			UserID:        req.UserID,
+			ProductID:     item.ProductID,
+			Quantity:      item.Quantity,
+			ReservedAt:    now,
+			ExpiresAt:     reservedUntil,
+			Status:        models.ReservationStatusPending,
+			CorrelationID: uuid.New(),
+			BatchID:       &batchID,
+		}
+	}
+	response := newBatchResponse(batchID, reservations)
+
+	// Register for the reply before queueing the event so it cannot be missed
+	var replies <-chan models.ReservationReply
+	if s.replies != nil {
+		var cancel func()
+		replies, cancel = s.replies.Await(batchID)
+		defer cancel()
+	}
+
+	if err := s.repository.CreateReservationBatch(ctx, reservations, event); err != nil {
+		var shortfall *repository.ShortfallError
+		if errors.As(err, &shortfall) {
+			applyBatchReply(response, models.ReservationReply{Shortfalls: shortfall.Shortfalls})
+			metrics.InventoryBatchReservations.WithLabelValues(strings.ToLower(response.Status)).Inc()
+			return response, nil
+		}
+		return nil, fmt.Errorf("failed to record batch reservations: %w", err)
+	}
+	s.outbox.notify()
+
+	if replies != nil {
+		timer := time.NewTimer(s.replyTimeout)
+		defer timer.Stop()
+
+		select {
+		case reply := <-replies:
+			applyBatchReply(response, reply)
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+
+	metrics.InventoryBatchReservations.WithLabelValues(strings.ToLower(response.Status)).Inc()
+	return response, nil
+}
+
+// GetReservationBatch returns the outcome of the user's batch reservation.
+// It returns ErrReservationNotFound when there is no such batch.
+func (s *inventoryService) GetReservationBatch(ctx context.Context, batchID uuid.UUID, userID string) (*models.BatchPurchaseResponse, error) {
+	reservations, err := s.repository.GetReservationsByBatchID(ctx, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch reservations: %w", err)
+	}
+	if len(reservations) == 0 {
+		return nil, repository.ErrReservationNotFound
+	}
+	if reservations[0].UserID != userID {
+		return nil, ErrReservationNotOwned
+	}
+
+	// The items of a batch are resolved together
+	response := newBatchResponse(batchID, reservations)
+	switch reservations[0].Status {
+	case models.ReservationStatusPending:
+	case models.ReservationStatusRejected:
+		var shortfalls []models.ItemShortfall
+		for _, reservation := range reservations {
+			if reservation.Reason != models.ReservationRejectedBatch {
+				shortfalls = append(shortfalls, models.ItemShortfall{
+					ProductID: reservation.ProductID,
+					Requested: reservation.Quantity,
+					Reason:    reservation.Reason,
+				})
+			}
+		}
+		applyBatchReply(response, models.ReservationReply{Shortfalls: shortfalls})
+	case models.ReservationStatusExpired:
+		if reservations[0].Reason == models.ReservationExpiredUnprocessed {
+			// The holds ran out before any stock was reserved
+			shortfalls := make([]models.ItemShortfall, len(reservations))
+			for i, reservation := range reservations {
+				shortfalls[i] = models.ItemShortfall{
+					ProductID: reservation.ProductID,
+					Requested: reservation.Quantity,
+					Reason:    reservation.Reason,
+				}
+			}
+			applyBatchReply(response, models.ReservationReply{Shortfalls: shortfalls})
+			response.Error = "Reservation expired before it was processed"
+			break
+		}
+		applyBatchReply(response, models.ReservationReply{Reserved: true, ReservedUntil: &reservations[0].ExpiresAt})
+	default:
+		// The stock was reserved, even if the holds have ended since
+		applyBatchReply(response, models.ReservationReply{Reserved: true, ReservedUntil: &reservations[0].ExpiresAt})
+	}
+	return response, nil
+}
+
+// newBatchResponse reports a batch as pending with its reservations
+func newBatchResponse(batchID uuid.UUID, reservations []*models.UserReservation) *models.BatchPurchaseResponse {
+	items := make([]models.BatchReservationItem, len(reservations))
+	for i, reservation := range reservations {
+		items[i] = models.BatchReservationItem{
+			OrderID:   reservation.OrderID,
+			ProductID: reservation.ProductID,
+			Quantity:  reservation.Quantity,
+			Status:    reservation.Status,
+			Reason:    reservation.Reason,
+		}
+	}
+	return &models.BatchPurchaseResponse{
+		Status:  models.PurchaseStatusPending,
+		BatchID: batchID,
+		Items:   items,
+		Message: "Reservation is being processed",
+	}
+}
+
+// applyBatchReply fills response with the processor's outcome. Items still
+// shown as pending take the status the outcome gave them.
+func applyBatchReply(response *models.BatchPurchaseResponse, reply models.ReservationReply) {
+	if reply.Reserved {
+		response.Success = true
+		response.Status = models.PurchaseStatusReserved
+		response.ReservedUntil = reply.ReservedUntil
+		response.Message = "Inventory reserved successfully"
+		for i := range response.Items {
+			if response.Items[i].Status == models.ReservationStatusPending {
+				response.Items[i].Status = models.ReservationStatusActive
+			}
+		}
+		return
+	}
+
+	reasons := make(map[string]string, len(reply.Shortfalls))
+	for _, shortfall := range reply.Shortfalls {
+		reasons[shortfall.ProductID] = shortfall.Reason
+	}
+	response.Status = models.PurchaseStatusRejected
+	response.Shortfalls = reply.Shortfalls
+	response.Message = ""
+	response.Error = "Not every item could be reserved"
+	for i := range response.Items {
+		item := &response.Items[i]
+		if item.Status != models.ReservationStatusPending {
+			continue
+		}
+		item.Status = models.ReservationStatusRejected
+		item.Reason = models.ReservationRejectedBatch
+		if reason, ok := reasons[item.ProductID]; ok {
+			item.Reason = reason
+		}
+	}
+}
+
+// handleReserveBatchEvent handles batch reserve events. The pending
+// reservations of the batch all become active or all become rejected, and
+// the outcome is replied to the requester with every item that fell short.
+func (s *inventoryService) handleReserveBatchEvent(ctx context.Context, event *models.InventoryEvent) error {
+	reply := &models.ReservationReply{
+		CorrelationID: event.CorrelationID,
+		ProductID:     event.ProductID,
+		Quantity:      event.Quantity,
+	}
+
+	reservations, err := s.repository.GetReservationsByBatchID(ctx, event.CorrelationID)
+	if err != nil {
+		return fmt.Errorf("failed to get batch reservations: %w", err)
+	}
+	if len(reservations) == 0 {
+		return kafka.Permanent(fmt.Errorf("no reservations recorded for batch %s", event.CorrelationID))
+	}
+	for _, reservation := range reservations {
+		if reservation.Status != models.ReservationStatusPending {
+			s.skipDuplicateEvent(ctx, event, "status")
+			return nil
+		}
+	}
+
+	// The holds start once the stock is reserved
+	pendingExpiry := reservations[0].ExpiresAt
+	expiresAt := time.Now().Add(s.reservationTTL())
+	for _, reservation := range reservations {
+		reservation.ExpiresAt = expiresAt
+	}
+
+	products, err := s.repository.ReserveBatchStock(ctx, event, reservations, newAllocator(event.Allocation))
+	var shortfall *repository.ShortfallError
+	switch {
+	case errors.Is(err, repository.ErrDuplicateEvent):
+		s.skipDuplicateEvent(ctx, event, "ledger")
+		return nil
+	case errors.Is(err, repository.ErrReservationChanged):
+		s.skipDuplicateEvent(ctx, event, "status")
+		return nil
+	case errors.As(err, &shortfall):
+		slog.WarnContext(ctx, "Rejected batch reservation",
+			"batch_id", event.CorrelationID, "items", len(reservations), "shortfalls", len(shortfall.Shortfalls))
+		return s.rejectBatch(ctx, event.CorrelationID, pendingExpiry, reply, shortfall.Shortfalls)
+	case err != nil:
+		return fmt.Errorf("failed to reserve batch stock: %w", err)
+	}
+
+	for _, product := range products {
+		s.applyProductState(product)
+	}
+
+	reply.Reserved = true
+	reply.ReservedUntil = &expiresAt
+	s.publishReservationReply(ctx, reply)
+
+	slog.InfoContext(ctx, "Successfully reserved batch",
+		"batch_id", event.CorrelationID, "items", len(reservations), "user_id", event.UserID)
+	return nil
+}
+
+// rejectBatch rejects every reservation of a batch and tells the requester
+// which items fell short. Rejections are final, so the event is not retried.
+func (s *inventoryService) rejectBatch(ctx context.Context, batchID uuid.UUID, expiresAt time.Time, reply *models.ReservationReply, shortfalls []models.ItemShortfall) error {
+	if err := s.repository.RejectReservationBatch(ctx, batchID, shortfalls, expiresAt); err != nil {
+		return fmt.Errorf("failed to reject batch: %w", err)
+	}
+
+	reply.Reason = shortfalls[0].Reason
+	reply.Shortfalls = shortfalls
+	s.publishReservationReply(ctx, reply)
+	return nil
+}
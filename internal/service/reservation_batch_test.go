@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchRepository records the batches it is asked to create and fails them
+// with its shortfalls, if any
+type batchRepository struct {
+	repository.InventoryRepository
+	shortfalls   []models.ItemShortfall
+	reservations []*models.UserReservation
+	event        *models.InventoryEvent
+}
+
+func (r *batchRepository) CreateReservationBatch(_ context.Context, reservations []*models.UserReservation, event *models.InventoryEvent) error {
+	if len(r.shortfalls) > 0 {
+		return &repository.ShortfallError{Shortfalls: r.shortfalls}
+	}
+	r.reservations = reservations
+	r.event = event
+	return nil
+}
+
+func (r *batchRepository) GetReservationsByBatchID(_ context.Context, _ uuid.UUID) ([]*models.UserReservation, error) {
+	return r.reservations, nil
+}
+
+func newBatchTestService(repo repository.InventoryRepository) *inventoryService {
+	return &inventoryService{
+		repository: repo,
+		outbox:     &outboxRelay{wake: make(chan struct{}, 1)},
+	}
+}
+
+const (
+	productA = "0b3c1f2e-5d41-4c1a-9e7f-1a2b3c4d5e6f"
+	productB = "7f6e5d4c-3b2a-4190-8f7e-6d5c4b3a2910"
+)
+
+func TestInventoryService_ReserveBatch(t *testing.T) {
+	repo := &batchRepository{}
+	s := newBatchTestService(repo)
+
+	response, err := s.ReserveBatch(context.Background(), &models.BatchPurchaseRequest{
+		UserID: "user",
+		Items: []models.BatchPurchaseItem{
+			{ProductID: productB, Quantity: 1},
+			{ProductID: productA, Quantity: 2},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.PurchaseStatusPending, response.Status)
+
+	// One event reserves the items in product order under the batch ID
+	event := repo.event
+	require.NotNil(t, event)
+	assert.Equal(t, models.InventoryEventTypeReserveBatch, event.EventType)
+	assert.Equal(t, response.BatchID, event.CorrelationID)
+	assert.Equal(t, productA, event.ProductID)
+	assert.Equal(t, 3, event.Quantity)
+	require.Len(t, event.Items, 2)
+	assert.Equal(t, productA, event.Items[0].ProductID)
+	assert.Equal(t, productB, event.Items[1].ProductID)
+
+	// Each item is its own pending reservation of the batch
+	require.Len(t, repo.reservations, 2)
+	for i, reservation := range repo.reservations {
+		assert.Equal(t, event.Items[i].OrderID, reservation.OrderID)
+		assert.Equal(t, event.Items[i].ProductID, reservation.ProductID)
+		assert.Equal(t, models.ReservationStatusPending, reservation.Status)
+		assert.Equal(t, &response.BatchID, reservation.BatchID)
+		assert.Equal(t, reservation.OrderID, response.Items[i].OrderID)
+	}
+	assert.NotEqual(t, repo.reservations[0].CorrelationID, repo.reservations[1].CorrelationID)
+}
+
+func TestInventoryService_ReserveBatch_DuplicateProduct(t *testing.T) {
+	repo := &batchRepository{}
+	s := newBatchTestService(repo)
+
+	_, err := s.ReserveBatch(context.Background(), &models.BatchPurchaseRequest{
+		UserID: "user",
+		Items: []models.BatchPurchaseItem{
+			{ProductID: productA, Quantity: 1},
+			{ProductID: productB, Quantity: 1},
+			{ProductID: productA, Quantity: 2},
+		},
+	})
+	assert.ErrorIs(t, err, ErrDuplicateBatchItem)
+	assert.Nil(t, repo.event)
+}
+
+func TestInventoryService_ReserveBatch_UnknownProduct(t *testing.T) {
+	repo := &batchRepository{shortfalls: []models.ItemShortfall{
+		{ProductID: productB, Requested: 1, Reason: models.ReservationRejectedProductNotFound},
+	}}
+	s := newBatchTestService(repo)
+
+	response, err := s.ReserveBatch(context.Background(), &models.BatchPurchaseRequest{
+		UserID: "user",
+		Items: []models.BatchPurchaseItem{
+			{ProductID: productA, Quantity: 2},
+			{ProductID: productB, Quantity: 1},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.False(t, response.Success)
+	assert.Equal(t, models.PurchaseStatusRejected, response.Status)
+	assert.Equal(t, repo.shortfalls, response.Shortfalls)
+	require.Len(t, response.Items, 2)
+	assert.Equal(t, models.ReservationRejectedBatch, response.Items[0].Reason)
+	assert.Equal(t, models.ReservationRejectedProductNotFound, response.Items[1].Reason)
+	for _, item := range response.Items {
+		assert.Equal(t, models.ReservationStatusRejected, item.Status)
+	}
+}
+
+func TestInventoryService_GetReservationBatch(t *testing.T) {
+	batch := func(status, reasonA, reasonB string) []*models.UserReservation {
+		reasons := []string{reasonA, reasonB}
+		reservations := make([]*models.UserReservation, 2)
+		for i, productID := range []string{productA, productB} {
+			reservations[i] = &models.UserReservation{
+				OrderID:   uuid.New(),
+				UserID:    "user",
+				ProductID: productID,
+				Quantity:  i + 1,
+				Status:    status,
+				Reason:    reasons[i],
+				ExpiresAt: time.Now().Add(10 * time.Minute),
+			}
+		}
+		return reservations
+	}
+
+	tests := []struct {
+		name         string
+		reservations []*models.UserReservation
+		status       string
+		success      bool
+		shortfalls   []string // reason of each shortfall
+	}{
+		{"pending", batch(models.ReservationStatusPending, "", ""), models.PurchaseStatusPending, false, nil},
+		{"active", batch(models.ReservationStatusActive, "", ""), models.PurchaseStatusReserved, true, nil},
+		{"expired after reserving", batch(models.ReservationStatusExpired, "", ""), models.PurchaseStatusReserved, true, nil},
+		{
+			"rejected",
+			batch(models.ReservationStatusRejected, models.ReservationRejectedBatch, models.ReservationRejectedInsufficientStock),
+			models.PurchaseStatusRejected, false,
+			[]string{models.ReservationRejectedInsufficientStock},
+		},
+		{
+			"expired before processing",
+			batch(models.ReservationStatusExpired, models.ReservationExpiredUnprocessed, models.ReservationExpiredUnprocessed),
+			models.PurchaseStatusRejected, false,
+			[]string{models.ReservationExpiredUnprocessed, models.ReservationExpiredUnprocessed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newBatchTestService(&batchRepository{reservations: tt.reservations})
+
+			response, err := s.GetReservationBatch(context.Background(), uuid.New(), "user")
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.status, response.Status)
+			assert.Equal(t, tt.success, response.Success)
+			var reasons []string
+			for _, shortfall := range response.Shortfalls {
+				reasons = append(reasons, shortfall.Reason)
+			}
+			assert.Equal(t, tt.shortfalls, reasons)
+			require.Len(t, response.Items, 2)
+		})
+	}
+}
+
+func TestInventoryService_GetReservationBatch_NotOwned(t *testing.T) {
+	s := newBatchTestService(&batchRepository{reservations: []*models.UserReservation{
+		{OrderID: uuid.New(), UserID: "user", ProductID: productA, Quantity: 1, Status: models.ReservationStatusActive},
+	}})
+
+	response, err := s.GetReservationBatch(context.Background(), uuid.New(), "someone else")
+	assert.ErrorIs(t, err, ErrReservationNotOwned)
+	assert.Nil(t, response)
+}
@@ -5,11 +5,15 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"log/slog"
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"url-shortener/internal/config"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/models"
 	"url-shortener/internal/repository"
 
@@ -17,56 +21,70 @@ import (
 )
 
 type URLService interface {
-	ShortenURL(originalURL string, expiresAt *time.Time) (*models.ShortenResponse, error)
-	RedirectURL(shortCode string, ipAddress, userAgent, referer string) (string, error)
-	GetAnalytics(shortCode string) (*models.AnalyticsResponse, error)
+	ShortenURL(ctx context.Context, originalURL string, expiresAt *time.Time) (*models.ShortenResponse, error)
+	RedirectURL(ctx context.Context, shortCode string, ipAddress, userAgent, referer string) (string, error)
+	GetAnalytics(ctx context.Context, shortCode string) (*models.AnalyticsResponse, error)
 	StartPreGeneration() error
 	StopPreGeneration()
+	UpdatePreGen(cfg config.PreGenConfig)
+	RunCacheInvalidation(ctx context.Context)
+	WarmCache(ctx context.Context) error
+	Flush(ctx context.Context) error
 }
 
 type urlService struct {
 	urlRepo       repository.URLRepository
 	analyticsRepo repository.AnalyticsRepository
-	redisClient   *redis.Client
+	redisClient   redis.UniversalClient
 	baseURL       string
 
+	// Link cache tiers in front of Postgres
+	links *linkCache
+
 	// Pre-generation management
 	preGenMutex     sync.RWMutex
 	stopPreGen      chan bool
 	isPreGenRunning bool
 
-	// Configuration
-	minPoolSize     int
-	maxPoolSize     int
-	preGenBatchSize int
+	// Tracks background analytics writes and pool refills so they can be
+	// flushed on shutdown
+	background sync.WaitGroup
+
+	// Configuration, replaced as a whole by UpdatePreGen
+	preGen        atomic.Pointer[config.PreGenConfig]
+	preGenUpdated chan struct{}
 }
 
 func NewURLService(
 	urlRepo repository.URLRepository,
 	analyticsRepo repository.AnalyticsRepository,
-	redisClient *redis.Client,
+	redisClient redis.UniversalClient,
 	baseURL string,
+	preGen config.PreGenConfig,
+	cacheConfig config.CacheConfig,
 ) URLService {
-	return &urlService{
-		urlRepo:         urlRepo,
-		analyticsRepo:   analyticsRepo,
-		redisClient:     redisClient,
-		baseURL:         baseURL,
-		stopPreGen:      make(chan bool),
-		minPoolSize:     100,  // Minimum pool size
-		maxPoolSize:     1000, // Maximum pool size
-		preGenBatchSize: 50,   // Batch size for pre-generation
-	}
+	links := newLinkCache(urlRepo, redisClient, cacheConfig)
+	s := &urlService{
+		urlRepo:       &invalidatingURLRepository{URLRepository: urlRepo, links: links},
+		analyticsRepo: analyticsRepo,
+		redisClient:   redisClient,
+		baseURL:       baseURL,
+		links:         links,
+		stopPreGen:    make(chan bool),
+		preGenUpdated: make(chan struct{}, 1),
+	}
+	s.preGen.Store(&preGen)
+	return s
 }
 
-func (s *urlService) ShortenURL(originalURL string, expiresAt *time.Time) (*models.ShortenResponse, error) {
+func (s *urlService) ShortenURL(ctx context.Context, originalURL string, expiresAt *time.Time) (*models.ShortenResponse, error) {
 	// Validate URL
 	if !isValidURL(originalURL) {
 		return nil, fmt.Errorf("invalid URL format")
 	}
 
 	// Check if URL already exists using Redis cache for fast lookup
-	existingShortCode, err := s.getExistingShortCode(originalURL)
+	existingShortCode, err := s.getExistingShortCode(ctx, originalURL)
 	if err == nil && existingShortCode != "" {
 		// URL already exists, return existing short code
 		response := &models.ShortenResponse{
@@ -80,10 +98,10 @@ func (s *urlService) ShortenURL(originalURL string, expiresAt *time.Time) (*mode
 	}
 
 	// Get pre-generated short code
-	preGenURL, err := s.urlRepo.GetUnusedPreGeneratedURL()
+	preGenURL, err := s.urlRepo.GetUnusedPreGeneratedURL(ctx)
 	if err != nil {
 		// Fallback to generating new short code if no pre-generated ones available
-		shortCode, genErr := s.generateShortCode()
+		shortCode, genErr := s.generateShortCode(ctx)
 		if genErr != nil {
 			return nil, fmt.Errorf("failed to generate short code: %w", genErr)
 		}
@@ -91,7 +109,7 @@ func (s *urlService) ShortenURL(originalURL string, expiresAt *time.Time) (*mode
 	}
 
 	// Mark pre-generated URL as used
-	err = s.urlRepo.MarkPreGeneratedURLAsUsed(preGenURL.ShortCode)
+	err = s.urlRepo.MarkPreGeneratedURLAsUsed(ctx, preGenURL.ShortCode)
 	if err != nil {
 		return nil, fmt.Errorf("failed to mark pre-generated URL as used: %w", err)
 	}
@@ -105,34 +123,26 @@ func (s *urlService) ShortenURL(originalURL string, expiresAt *time.Time) (*mode
 		IsUsed:      true,
 	}
 
-	err = s.urlRepo.Create(urlModel)
+	err = s.urlRepo.Create(ctx, urlModel)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create URL: %w", err)
 	}
 
-	// Cache the URL in Redis with both directions
-	cacheKey := fmt.Sprintf("url:%s", preGenURL.ShortCode)
-	cacheValue := originalURL
-	cacheExpiration := 24 * time.Hour
-
-	if expiresAt != nil && expiresAt.Before(time.Now().Add(cacheExpiration)) {
-		cacheExpiration = time.Until(*expiresAt)
-	}
-
-	err = s.redisClient.Set(context.Background(), cacheKey, cacheValue, cacheExpiration).Err()
-	if err != nil {
-		fmt.Printf("Failed to cache URL: %v\n", err)
-	}
+	// Cache the URL with both directions
+	s.links.store(ctx, urlModel)
 
 	// Also cache reverse mapping for duplicate detection
-	reverseCacheKey := fmt.Sprintf("reverse:%s", originalURL)
-	err = s.redisClient.Set(context.Background(), reverseCacheKey, preGenURL.ShortCode, cacheExpiration).Err()
+	cacheExpiration, _ := s.links.ttls(urlModel)
+	err = s.redisClient.Set(ctx, reverseKey(originalURL), preGenURL.ShortCode, cacheExpiration).Err()
 	if err != nil {
-		fmt.Printf("Failed to cache reverse URL mapping: %v\n", err)
+		slog.WarnContext(ctx, "Failed to cache reverse URL mapping", "short_code", preGenURL.ShortCode, "error", err)
 	}
 
 	// Trigger pre-generation if pool is low
-	go s.checkAndRefillPool()
+	refillCtx := context.WithoutCancel(ctx)
+	s.goBackground(func() {
+		s.checkAndRefillPool(refillCtx)
+	})
 
 	// Build response
 	response := &models.ShortenResponse{
@@ -146,60 +156,42 @@ func (s *urlService) ShortenURL(originalURL string, expiresAt *time.Time) (*mode
 	return response, nil
 }
 
-func (s *urlService) RedirectURL(shortCode string, ipAddress, userAgent, referer string) (string, error) {
-	// Try to get from cache first
-	cacheKey := fmt.Sprintf("url:%s", shortCode)
-	cachedURL, err := s.redisClient.Get(context.Background(), cacheKey).Result()
-	if err == nil {
-		// URL found in cache, record analytics
-		go s.recordAnalytics(shortCode, ipAddress, userAgent, referer)
-		return cachedURL, nil
-	}
-
-	// Get from database
-	urlModel, err := s.urlRepo.GetByShortCode(shortCode)
+func (s *urlService) RedirectURL(ctx context.Context, shortCode string, ipAddress, userAgent, referer string) (string, error) {
+	link, err := s.links.resolve(ctx, shortCode)
 	if err != nil {
 		return "", fmt.Errorf("URL not found: %w", err)
 	}
 
-	// Cache the URL for future requests
-	cacheExpiration := 24 * time.Hour
-	if urlModel.ExpiresAt != nil && urlModel.ExpiresAt.Before(time.Now().Add(cacheExpiration)) {
-		cacheExpiration = time.Until(*urlModel.ExpiresAt)
-	}
-
-	s.redisClient.Set(context.Background(), cacheKey, urlModel.OriginalURL, cacheExpiration)
+	// Record analytics against the cached link ID, without another lookup
+	s.recordAnalyticsAsync(ctx, link.ID, shortCode, ipAddress, userAgent, referer)
 
-	// Record analytics
-	go s.recordAnalytics(shortCode, ipAddress, userAgent, referer)
-
-	return urlModel.OriginalURL, nil
+	return link.OriginalURL, nil
 }
 
-func (s *urlService) GetAnalytics(shortCode string) (*models.AnalyticsResponse, error) {
+func (s *urlService) GetAnalytics(ctx context.Context, shortCode string) (*models.AnalyticsResponse, error) {
 	// Get URL by short code
-	urlModel, err := s.urlRepo.GetByShortCode(shortCode)
+	urlModel, err := s.urlRepo.GetByShortCode(ctx, shortCode)
 	if err != nil {
 		return nil, fmt.Errorf("URL not found: %w", err)
 	}
 
 	// Get analytics data
-	totalClicks, err := s.analyticsRepo.GetTotalClicks(urlModel.ID)
+	totalClicks, err := s.analyticsRepo.GetTotalClicks(ctx, urlModel.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total clicks: %w", err)
 	}
 
-	uniqueIPs, err := s.analyticsRepo.GetUniqueIPs(urlModel.ID)
+	uniqueIPs, err := s.analyticsRepo.GetUniqueIPs(ctx, urlModel.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get unique IPs: %w", err)
 	}
 
-	topReferers, err := s.analyticsRepo.GetTopReferers(urlModel.ID, 10)
+	topReferers, err := s.analyticsRepo.GetTopReferers(ctx, urlModel.ID, 10)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get top referers: %w", err)
 	}
 
-	recentClicks, err := s.analyticsRepo.GetByURLID(urlModel.ID, 20)
+	recentClicks, err := s.analyticsRepo.GetByURLID(ctx, urlModel.ID, 20)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get recent clicks: %w", err)
 	}
@@ -227,7 +219,7 @@ func (s *urlService) GetAnalytics(shortCode string) (*models.AnalyticsResponse,
 	return response, nil
 }
 
-func (s *urlService) generateShortCode() (string, error) {
+func (s *urlService) generateShortCode(ctx context.Context) (string, error) {
 	const maxAttempts = 10
 
 	for i := 0; i < maxAttempts; i++ {
@@ -242,7 +234,7 @@ func (s *urlService) generateShortCode() (string, error) {
 		shortCode := hex.EncodeToString(bytes)[:8]
 
 		// Check if short code already exists
-		exists, err := s.urlRepo.IsShortCodeExists(shortCode)
+		exists, err := s.urlRepo.IsShortCodeExists(ctx, shortCode)
 		if err != nil {
 			return "", err
 		}
@@ -255,26 +247,29 @@ func (s *urlService) generateShortCode() (string, error) {
 	return "", fmt.Errorf("failed to generate unique short code after %d attempts", maxAttempts)
 }
 
-func (s *urlService) recordAnalytics(shortCode, ipAddress, userAgent, referer string) {
-	// Get URL by short code
-	urlModel, err := s.urlRepo.GetByShortCode(shortCode)
-	if err != nil {
-		return // Silently fail for analytics
-	}
+// recordAnalyticsAsync records a click in the background, detached from the
+// request's cancellation
+func (s *urlService) recordAnalyticsAsync(ctx context.Context, urlID int, shortCode, ipAddress, userAgent, referer string) {
+	ctx = context.WithoutCancel(ctx)
+	s.goBackground(func() {
+		s.recordAnalytics(ctx, urlID, shortCode, ipAddress, userAgent, referer)
+	})
+}
 
+func (s *urlService) recordAnalytics(ctx context.Context, urlID int, shortCode, ipAddress, userAgent, referer string) {
 	// Create analytics record
 	analytics := &models.Analytics{
-		URLID:     urlModel.ID,
+		URLID:     urlID,
 		IPAddress: ipAddress,
 		UserAgent: userAgent,
 		Referer:   referer,
 	}
 
 	// Save analytics
-	err = s.analyticsRepo.Create(analytics)
+	err := s.analyticsRepo.Create(ctx, analytics)
 	if err != nil {
 		// Log error but don't fail the request
-		fmt.Printf("Failed to record analytics: %v\n", err)
+		slog.WarnContext(ctx, "Failed to record analytics", "short_code", shortCode, "error", err)
 	}
 }
 
@@ -293,38 +288,40 @@ func isValidURL(rawURL string) bool {
 }
 
 // Helper methods for pre-generation and optimization
-func (s *urlService) getExistingShortCode(originalURL string) (string, error) {
-	reverseCacheKey := fmt.Sprintf("reverse:%s", originalURL)
-	shortCode, err := s.redisClient.Get(context.Background(), reverseCacheKey).Result()
+func (s *urlService) getExistingShortCode(ctx context.Context, originalURL string) (string, error) {
+	shortCode, err := s.redisClient.Get(ctx, reverseKey(originalURL)).Result()
 	if err != nil {
 		return "", err
 	}
 	return shortCode, nil
 }
 
-func (s *urlService) checkAndRefillPool() {
-	count, err := s.urlRepo.GetPreGeneratedURLCount()
+func (s *urlService) checkAndRefillPool(ctx context.Context) {
+	count, err := s.urlRepo.GetPreGeneratedURLCount(ctx)
 	if err != nil {
-		fmt.Printf("Failed to get pre-generated URL count: %v\n", err)
+		slog.Error("Failed to get pre-generated URL count", "error", err)
 		return
 	}
 
-	if count < s.minPoolSize {
-		go s.preGenerateURLs(s.preGenBatchSize)
+	metrics.PreGeneratedPoolSize.Set(float64(count))
+
+	preGen := s.preGen.Load()
+	if count < preGen.MinPoolSize {
+		s.preGenerateURLs(ctx, preGen.BatchSize)
 	}
 }
 
-func (s *urlService) preGenerateURLs(count int) {
-	for i := 0; i < count; i++ {
-		shortCode, err := s.generateShortCode()
+func (s *urlService) preGenerateURLs(ctx context.Context, count int) {
+	for i := 0; i < count && ctx.Err() == nil; i++ {
+		shortCode, err := s.generateShortCode(ctx)
 		if err != nil {
-			fmt.Printf("Failed to generate short code for pre-generation: %v\n", err)
+			slog.Error("Failed to generate short code for pre-generation", "error", err)
 			continue
 		}
 
-		err = s.urlRepo.CreatePreGeneratedURL(shortCode)
+		err = s.urlRepo.CreatePreGeneratedURL(ctx, shortCode)
 		if err != nil {
-			fmt.Printf("Failed to create pre-generated URL: %v\n", err)
+			slog.Error("Failed to create pre-generated URL", "short_code", shortCode, "error", err)
 		}
 	}
 }
@@ -339,18 +336,26 @@ func (s *urlService) StartPreGeneration() error {
 
 	s.isPreGenRunning = true
 
+	// Pre-generation outlives requests and stops with StopPreGeneration
+	ctx, cancel := context.WithCancel(context.Background())
+
 	// Initial pre-generation
-	go s.preGenerateURLs(s.maxPoolSize)
+	go s.preGenerateURLs(ctx, s.preGen.Load().MaxPoolSize)
 
 	// Start background pre-generation routine
 	go func() {
-		ticker := time.NewTicker(5 * time.Minute) // Check every 5 minutes
+		defer cancel()
+		ticker := time.NewTicker(s.preGen.Load().CheckInterval)
 		defer ticker.Stop()
 
 		for {
 			select {
 			case <-ticker.C:
-				s.checkAndRefillPool()
+				s.checkAndRefillPool(ctx)
+			case <-s.preGenUpdated:
+				// New watermarks apply immediately rather than on the next tick
+				ticker.Reset(s.preGen.Load().CheckInterval)
+				s.checkAndRefillPool(ctx)
 			case <-s.stopPreGen:
 				return
 			}
@@ -371,3 +376,36 @@ func (s *urlService) StopPreGeneration() {
 	s.isPreGenRunning = false
 	s.stopPreGen <- true
 }
+
+// UpdatePreGen replaces the pool watermarks and check interval
+func (s *urlService) UpdatePreGen(cfg config.PreGenConfig) {
+	s.preGen.Store(&cfg)
+	select {
+	case s.preGenUpdated <- struct{}{}:
+	default:
+	}
+}
+
+// Flush waits for background analytics writes and pool refills to finish
+func (s *urlService) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush background work: %w", ctx.Err())
+	}
+}
+
+func (s *urlService) goBackground(fn func()) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		fn()
+	}()
+}
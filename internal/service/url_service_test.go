@@ -2,10 +2,14 @@ package service
 
 import (
 	"context"
+	"errors"
+	"net"
 	"testing"
 	"time"
 
+	"url-shortener/internal/config"
 	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
@@ -17,65 +21,81 @@ type MockURLRepository struct {
 	mock.Mock
 }
 
-func (m *MockURLRepository) Create(url *models.URL) error {
-	args := m.Called(url)
+func (m *MockURLRepository) Create(ctx context.Context, url *models.URL) error {
+	args := m.Called(ctx, url)
 	url.ID = 1
 	url.CreatedAt = time.Now()
 	return args.Error(0)
 }
 
-func (m *MockURLRepository) GetByShortCode(shortCode string) (*models.URL, error) {
-	args := m.Called(shortCode)
+func (m *MockURLRepository) GetByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	args := m.Called(ctx, shortCode)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.URL), args.Error(1)
 }
 
-func (m *MockURLRepository) GetByID(id int) (*models.URL, error) {
-	args := m.Called(id)
+func (m *MockURLRepository) GetByID(ctx context.Context, id int) (*models.URL, error) {
+	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.URL), args.Error(1)
 }
 
-func (m *MockURLRepository) Update(url *models.URL) error {
-	args := m.Called(url)
+func (m *MockURLRepository) Update(ctx context.Context, url *models.URL) error {
+	args := m.Called(ctx, url)
 	return args.Error(0)
 }
 
-func (m *MockURLRepository) Delete(id int) error {
-	args := m.Called(id)
+func (m *MockURLRepository) Delete(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
-func (m *MockURLRepository) IsShortCodeExists(shortCode string) (bool, error) {
-	args := m.Called(shortCode)
+func (m *MockURLRepository) IsShortCodeExists(ctx context.Context, shortCode string) (bool, error) {
+	args := m.Called(ctx, shortCode)
 	return args.Bool(0), args.Error(1)
 }
 
+func (m *MockURLRepository) ExpireByShortCodes(ctx context.Context, shortCodes []string) ([]models.URL, error) {
+	args := m.Called(ctx, shortCodes)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.URL), args.Error(1)
+}
+
+func (m *MockURLRepository) GetMostClicked(ctx context.Context, limit int) ([]models.URL, error) {
+	args := m.Called(ctx, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.URL), args.Error(1)
+}
+
 // Pre-generated URL methods
-func (m *MockURLRepository) CreatePreGeneratedURL(shortCode string) error {
-	args := m.Called(shortCode)
+func (m *MockURLRepository) CreatePreGeneratedURL(ctx context.Context, shortCode string) error {
+	args := m.Called(ctx, shortCode)
 	return args.Error(0)
 }
 
-func (m *MockURLRepository) GetUnusedPreGeneratedURL() (*models.PreGeneratedURL, error) {
-	args := m.Called()
+func (m *MockURLRepository) GetUnusedPreGeneratedURL(ctx context.Context) (*models.PreGeneratedURL, error) {
+	args := m.Called(ctx)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.PreGeneratedURL), args.Error(1)
 }
 
-func (m *MockURLRepository) MarkPreGeneratedURLAsUsed(shortCode string) error {
-	args := m.Called(shortCode)
+func (m *MockURLRepository) MarkPreGeneratedURLAsUsed(ctx context.Context, shortCode string) error {
+	args := m.Called(ctx, shortCode)
 	return args.Error(0)
 }
 
-func (m *MockURLRepository) GetPreGeneratedURLCount() (int, error) {
-	args := m.Called()
+func (m *MockURLRepository) GetPreGeneratedURLCount(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
 	return args.Int(0), args.Error(1)
 }
 
@@ -83,33 +103,33 @@ type MockAnalyticsRepository struct {
 	mock.Mock
 }
 
-func (m *MockAnalyticsRepository) Create(analytics *models.Analytics) error {
-	args := m.Called(analytics)
+func (m *MockAnalyticsRepository) Create(ctx context.Context, analytics *models.Analytics) error {
+	args := m.Called(ctx, analytics)
 	analytics.ID = 1
 	analytics.ClickedAt = time.Now()
 	return args.Error(0)
 }
 
-func (m *MockAnalyticsRepository) GetByURLID(urlID int, limit int) ([]models.Analytics, error) {
-	args := m.Called(urlID, limit)
+func (m *MockAnalyticsRepository) GetByURLID(ctx context.Context, urlID int, limit int) ([]models.Analytics, error) {
+	args := m.Called(ctx, urlID, limit)
 	return args.Get(0).([]models.Analytics), args.Error(1)
 }
 
-func (m *MockAnalyticsRepository) GetTotalClicks(urlID int) (int, error) {
-	args := m.Called(urlID)
+func (m *MockAnalyticsRepository) GetTotalClicks(ctx context.Context, urlID int) (int, error) {
+	args := m.Called(ctx, urlID)
 	return args.Int(0), args.Error(1)
 }
 
-func (m *MockAnalyticsRepository) GetUniqueIPs(urlID int) (int, error) {
-	args := m.Called(urlID)
+func (m *MockAnalyticsRepository) GetUniqueIPs(ctx context.Context, urlID int) (int, error) {
+	args := m.Called(ctx, urlID)
 	return args.Int(0), args.Error(1)
 }
 
-func (m *MockAnalyticsRepository) GetTopReferers(urlID int, limit int) ([]struct {
+func (m *MockAnalyticsRepository) GetTopReferers(ctx context.Context, urlID int, limit int) ([]struct {
 	Referer string
 	Count   int
 }, error) {
-	args := m.Called(urlID, limit)
+	args := m.Called(ctx, urlID, limit)
 	return args.Get(0).([]struct {
 		Referer string
 		Count   int
@@ -121,7 +141,7 @@ func TestURLService_ShortenURL(t *testing.T) {
 	mockAnalyticsRepo := new(MockAnalyticsRepository)
 	mockRedis := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
 
-	service := NewURLService(mockURLRepo, mockAnalyticsRepo, mockRedis, "http://localhost:8080")
+	service := NewURLService(mockURLRepo, mockAnalyticsRepo, mockRedis, "http://localhost:8080", config.Defaults().PreGen, config.Defaults().Cache)
 
 	tests := []struct {
 		name        string
@@ -139,9 +159,11 @@ func TestURLService_ShortenURL(t *testing.T) {
 					CreatedAt: time.Now(),
 					IsUsed:    false,
 				}
-				mockURLRepo.On("GetUnusedPreGeneratedURL").Return(preGenURL, nil)
-				mockURLRepo.On("MarkPreGeneratedURLAsUsed", "abc12345").Return(nil)
-				mockURLRepo.On("Create", mock.AnythingOfType("*models.URL")).Return(nil)
+				mockURLRepo.On("GetUnusedPreGeneratedURL", mock.Anything).Return(preGenURL, nil)
+				mockURLRepo.On("MarkPreGeneratedURLAsUsed", mock.Anything, "abc12345").Return(nil)
+				mockURLRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.URL")).Return(nil)
+				// Pool refill runs in the background after shortening
+				mockURLRepo.On("GetPreGeneratedURLCount", mock.Anything).Return(1000, nil).Maybe()
 			},
 			expectError: false,
 		},
@@ -159,7 +181,7 @@ func TestURLService_ShortenURL(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.setupMocks()
 
-			response, err := service.ShortenURL(tt.url, tt.expiresAt)
+			response, err := service.ShortenURL(context.Background(), tt.url, tt.expiresAt)
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -182,7 +204,7 @@ func TestURLService_RedirectURL(t *testing.T) {
 	mockAnalyticsRepo := new(MockAnalyticsRepository)
 	mockRedis := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
 
-	service := NewURLService(mockURLRepo, mockAnalyticsRepo, mockRedis, "http://localhost:8080")
+	service := NewURLService(mockURLRepo, mockAnalyticsRepo, mockRedis, "http://localhost:8080", config.Defaults().PreGen, config.Defaults().Cache)
 
 	// Clear cache before each test
 	mockRedis.FlushDB(context.Background())
@@ -204,8 +226,8 @@ func TestURLService_RedirectURL(t *testing.T) {
 					OriginalURL: "https://example.com",
 					IsActive:    true,
 				}
-				mockURLRepo.On("GetByShortCode", "abc123").Return(url, nil)
-				mockAnalyticsRepo.On("Create", mock.AnythingOfType("*models.Analytics")).Return(nil)
+				mockURLRepo.On("GetByShortCode", mock.Anything, "abc123").Return(url, nil)
+				mockAnalyticsRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Analytics")).Return(nil)
 			},
 			expectError: false,
 			expectedURL: "https://example.com",
@@ -214,8 +236,8 @@ func TestURLService_RedirectURL(t *testing.T) {
 			name:      "Invalid short code",
 			shortCode: "invalid",
 			setupMocks: func() {
-				mockURLRepo.On("GetByShortCode", "invalid").Return(nil, assert.AnError)
-				mockAnalyticsRepo.On("Create", mock.AnythingOfType("*models.Analytics")).Return(assert.AnError)
+				mockURLRepo.On("GetByShortCode", mock.Anything, "invalid").Return(nil, assert.AnError)
+				mockAnalyticsRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Analytics")).Return(assert.AnError)
 			},
 			expectError: true,
 		},
@@ -225,7 +247,9 @@ func TestURLService_RedirectURL(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.setupMocks()
 
-			originalURL, err := service.RedirectURL(tt.shortCode, "127.0.0.1", "test-agent", "test-referer")
+			originalURL, err := service.RedirectURL(context.Background(), tt.shortCode, "127.0.0.1", "test-agent", "test-referer")
+			// Wait for the background analytics write
+			assert.NoError(t, service.Flush(context.Background()))
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -240,3 +264,112 @@ func TestURLService_RedirectURL(t *testing.T) {
 		})
 	}
 }
+
+func TestURLService_RedirectURL_CachesUnknownCodes(t *testing.T) {
+	mockURLRepo := new(MockURLRepository)
+	mockAnalyticsRepo := new(MockAnalyticsRepository)
+	mockRedis := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+
+	service := NewURLService(mockURLRepo, mockAnalyticsRepo, mockRedis, "http://localhost:8080", config.Defaults().PreGen, config.Defaults().Cache)
+
+	mockURLRepo.On("GetByShortCode", mock.Anything, "unknown1").Return(nil, repository.ErrURLNotFound).Once()
+
+	for i := 0; i < 3; i++ {
+		originalURL, err := service.RedirectURL(context.Background(), "unknown1", "127.0.0.1", "test-agent", "")
+		assert.ErrorIs(t, err, repository.ErrURLNotFound)
+		assert.Empty(t, originalURL)
+	}
+
+	mockURLRepo.AssertExpectations(t)
+	mockAnalyticsRepo.AssertExpectations(t)
+}
+
+func TestURLService_RedirectURL_RecordsCachedLinkID(t *testing.T) {
+	mockURLRepo := new(MockURLRepository)
+	mockAnalyticsRepo := new(MockAnalyticsRepository)
+	mockRedis := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	mockRedis.Del(context.Background(), "url:cached1")
+
+	service := NewURLService(mockURLRepo, mockAnalyticsRepo, mockRedis, "http://localhost:8080", config.Defaults().PreGen, config.Defaults().Cache)
+
+	link := &models.URL{ID: 5, ShortCode: "cached1", OriginalURL: "https://example.com", IsActive: true}
+	mockURLRepo.On("GetByShortCode", mock.Anything, "cached1").Return(link, nil).Once()
+	mockAnalyticsRepo.On("Create", mock.Anything, mock.MatchedBy(func(analytics *models.Analytics) bool {
+		return analytics.URLID == 5
+	})).Return(nil).Twice()
+
+	for i := 0; i < 2; i++ {
+		originalURL, err := service.RedirectURL(context.Background(), "cached1", "127.0.0.1", "test-agent", "")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com", originalURL)
+	}
+	assert.NoError(t, service.Flush(context.Background()))
+
+	mockURLRepo.AssertExpectations(t)
+	mockAnalyticsRepo.AssertExpectations(t)
+}
+
+func TestURLService_DeleteInvalidatesCachedLink(t *testing.T) {
+	mockURLRepo := new(MockURLRepository)
+	mockAnalyticsRepo := new(MockAnalyticsRepository)
+	mockRedis := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	mockRedis.Del(context.Background(), "url:deleted1")
+
+	svc := NewURLService(mockURLRepo, mockAnalyticsRepo, mockRedis, "http://localhost:8080", config.Defaults().PreGen, config.Defaults().Cache).(*urlService)
+
+	link := &models.URL{ID: 6, ShortCode: "deleted1", OriginalURL: "https://example.com", IsActive: true}
+	mockURLRepo.On("GetByShortCode", mock.Anything, "deleted1").Return(link, nil).Once()
+	mockURLRepo.On("GetByID", mock.Anything, 6).Return(link, nil).Once()
+	mockURLRepo.On("Delete", mock.Anything, 6).Return(nil).Once()
+	mockAnalyticsRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Analytics")).Return(nil).Once()
+
+	originalURL, err := svc.RedirectURL(context.Background(), "deleted1", "127.0.0.1", "test-agent", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", originalURL)
+
+	assert.NoError(t, svc.urlRepo.Delete(context.Background(), 6))
+
+	mockURLRepo.On("GetByShortCode", mock.Anything, "deleted1").Return(nil, repository.ErrURLNotFound).Once()
+	originalURL, err = svc.RedirectURL(context.Background(), "deleted1", "127.0.0.1", "test-agent", "")
+	assert.ErrorIs(t, err, repository.ErrURLNotFound)
+	assert.Empty(t, originalURL)
+	assert.NoError(t, svc.Flush(context.Background()))
+
+	mockURLRepo.AssertExpectations(t)
+	mockAnalyticsRepo.AssertExpectations(t)
+}
+
+func TestURLService_RedirectURL_HonorsDeadline(t *testing.T) {
+	mockURLRepo := new(MockURLRepository)
+	mockAnalyticsRepo := new(MockAnalyticsRepository)
+
+	service := NewURLService(mockURLRepo, mockAnalyticsRepo, unavailableRedis(), "http://localhost:8080", config.Defaults().PreGen, config.Defaults().Cache)
+
+	// The shared lookup may reach the repository after the request gave up
+	called := make(chan struct{})
+	mockURLRepo.On("GetByShortCode", mock.Anything, "slow1").Run(func(args mock.Arguments) {
+		close(called)
+		<-args.Get(0).(context.Context).Done()
+	}).Return(nil, context.DeadlineExceeded).Once()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	originalURL, err := service.RedirectURL(ctx, "slow1", "127.0.0.1", "test-agent", "")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, originalURL)
+
+	<-called
+	mockURLRepo.AssertExpectations(t)
+}
+
+// unavailableRedis returns a client whose every command fails at once, as
+// when Redis is down
+func unavailableRedis() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Dialer: func(context.Context, string, string) (net.Conn, error) {
+			return nil, errors.New("redis unavailable")
+		},
+		MaxRetries: -1,
+	})
+}
@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+	"go.opentelemetry.io/otel"
+)
+
+// HeaderCarrier adapts Kafka record headers to a propagation.TextMapCarrier
+type HeaderCarrier struct {
+	headers *[]sarama.RecordHeader
+}
+
+// NewHeaderCarrier creates a carrier reading and writing the given headers
+func NewHeaderCarrier(headers *[]sarama.RecordHeader) HeaderCarrier {
+	return HeaderCarrier{headers: headers}
+}
+
+// Get implements propagation.TextMapCarrier
+func (c HeaderCarrier) Get(key string) string {
+	for _, header := range *c.headers {
+		if string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// Set implements propagation.TextMapCarrier
+func (c HeaderCarrier) Set(key, value string) {
+	for i, header := range *c.headers {
+		if string(header.Key) == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// Keys implements propagation.TextMapCarrier
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, len(*c.headers))
+	for i, header := range *c.headers {
+		keys[i] = string(header.Key)
+	}
+	return keys
+}
+
+// InjectKafkaHeaders writes the trace context of ctx into the message headers
+func InjectKafkaHeaders(ctx context.Context, message *sarama.ProducerMessage) {
+	otel.GetTextMapPropagator().Inject(ctx, NewHeaderCarrier(&message.Headers))
+}
+
+// ExtractKafkaHeaders returns a context carrying the trace context found in the message headers
+func ExtractKafkaHeaders(ctx context.Context, message *sarama.ConsumerMessage) context.Context {
+	headers := make([]sarama.RecordHeader, len(message.Headers))
+	for i, header := range message.Headers {
+		headers[i] = *header
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, NewHeaderCarrier(&headers))
+}
@@ -0,0 +1,12 @@
+package version
+
+// Build information, overridden at link time:
+//
+//	go build -ldflags "-X url-shortener/internal/version.Version=v1.2.3 \
+//		-X url-shortener/internal/version.Commit=$(git rev-parse --short HEAD) \
+//		-X url-shortener/internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS pre_generated_urls;
+DROP TABLE IF EXISTS analytics;
+DROP TABLE IF EXISTS urls;
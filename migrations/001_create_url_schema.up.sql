@@ -0,0 +1,37 @@
+-- URL shortener schema: short links, click analytics and the pool of
+-- pre-generated short codes used for faster URL shortening
+
+CREATE TABLE IF NOT EXISTS urls (
+    id SERIAL PRIMARY KEY,
+    short_code VARCHAR(10) UNIQUE NOT NULL,
+    original_url TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+    is_active BOOLEAN DEFAULT TRUE,
+    is_used BOOLEAN DEFAULT TRUE
+);
+
+-- Databases created before is_used was introduced
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS is_used BOOLEAN DEFAULT TRUE;
+
+CREATE TABLE IF NOT EXISTS analytics (
+    id SERIAL PRIMARY KEY,
+    url_id INTEGER REFERENCES urls(id) ON DELETE CASCADE,
+    ip_address INET,
+    user_agent TEXT,
+    referer TEXT,
+    clicked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS pre_generated_urls (
+    id SERIAL PRIMARY KEY,
+    short_code VARCHAR(8) UNIQUE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    is_used BOOLEAN DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS idx_urls_short_code ON urls(short_code);
+CREATE INDEX IF NOT EXISTS idx_analytics_url_id ON analytics(url_id);
+CREATE INDEX IF NOT EXISTS idx_analytics_clicked_at ON analytics(clicked_at);
+CREATE INDEX IF NOT EXISTS idx_pre_generated_urls_unused ON pre_generated_urls(is_used) WHERE is_used = FALSE;
+CREATE INDEX IF NOT EXISTS idx_pre_generated_urls_short_code ON pre_generated_urls(short_code);
@@ -0,0 +1,14 @@
+DROP VIEW IF EXISTS inventory_metrics;
+DROP VIEW IF EXISTS user_reservation_summary;
+DROP VIEW IF EXISTS product_availability;
+
+DROP FUNCTION IF EXISTS cleanup_expired_reservations();
+DROP FUNCTION IF EXISTS create_inventory_snapshot(UUID);
+
+DROP TABLE IF EXISTS inventory_snapshots;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS inventory_events;
+DROP TABLE IF EXISTS user_reservations;
+DROP TABLE IF EXISTS products;
+
+DROP FUNCTION IF EXISTS update_updated_at_column();
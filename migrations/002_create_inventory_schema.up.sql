@@ -1,6 +1,9 @@
 -- Inventory Management Database Schema
 -- This schema supports Kafka-based inventory management system
 
+-- gen_random_uuid() is built in from Postgres 13, pgcrypto provides it on older versions
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
 -- Products table
 CREATE TABLE IF NOT EXISTS products (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -27,14 +30,7 @@ CREATE TABLE IF NOT EXISTS user_reservations (
     reserved_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     expires_at TIMESTAMP NOT NULL,
     status VARCHAR(20) DEFAULT 'ACTIVE' CHECK (status IN ('ACTIVE', 'CONFIRMED', 'RELEASED', 'EXPIRED')),
-    correlation_id UUID NOT NULL,
-    
-    -- Indexes
-    INDEX idx_user_reservations_user_id (user_id),
-    INDEX idx_user_reservations_product_id (product_id),
-    INDEX idx_user_reservations_expires_at (expires_at),
-    INDEX idx_user_reservations_correlation_id (correlation_id),
-    INDEX idx_user_reservations_status (status)
+    correlation_id UUID NOT NULL
 );
 
 -- Inventory events table (for audit trail and debugging)
@@ -47,13 +43,7 @@ CREATE TABLE IF NOT EXISTS inventory_events (
     quantity INTEGER NOT NULL CHECK (quantity > 0),
     correlation_id UUID,
     processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    metadata JSONB,
-    
-    -- Indexes
-    INDEX idx_inventory_events_product_id (product_id),
-    INDEX idx_inventory_events_event_type (event_type),
-    INDEX idx_inventory_events_processed_at (processed_at),
-    INDEX idx_inventory_events_correlation_id (correlation_id)
+    metadata JSONB
 );
 
 -- Orders table (for completed purchases)
@@ -67,14 +57,7 @@ CREATE TABLE IF NOT EXISTS orders (
     status VARCHAR(20) DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'CONFIRMED', 'CANCELLED', 'COMPLETED')),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    correlation_id UUID NOT NULL,
-    
-    -- Indexes
-    INDEX idx_orders_user_id (user_id),
-    INDEX idx_orders_product_id (product_id),
-    INDEX idx_orders_status (status),
-    INDEX idx_orders_created_at (created_at),
-    INDEX idx_orders_correlation_id (correlation_id)
+    correlation_id UUID NOT NULL
 );
 
 -- Inventory snapshots table (for historical tracking)
@@ -85,13 +68,28 @@ CREATE TABLE IF NOT EXISTS inventory_snapshots (
     reserved_stock INTEGER NOT NULL,
     total_stock INTEGER NOT NULL,
     version INTEGER NOT NULL,
-    snapshot_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    
-    -- Indexes
-    INDEX idx_inventory_snapshots_product_id (product_id),
-    INDEX idx_inventory_snapshots_snapshot_at (snapshot_at)
+    snapshot_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Indexes
+CREATE INDEX IF NOT EXISTS idx_products_available_stock ON products(available_stock);
+CREATE INDEX IF NOT EXISTS idx_user_reservations_user_id ON user_reservations(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_reservations_product_id ON user_reservations(product_id);
+CREATE INDEX IF NOT EXISTS idx_user_reservations_expires_at ON user_reservations(expires_at);
+CREATE INDEX IF NOT EXISTS idx_user_reservations_correlation_id ON user_reservations(correlation_id);
+CREATE INDEX IF NOT EXISTS idx_user_reservations_status ON user_reservations(status);
+CREATE INDEX IF NOT EXISTS idx_inventory_events_product_id ON inventory_events(product_id);
+CREATE INDEX IF NOT EXISTS idx_inventory_events_event_type ON inventory_events(event_type);
+CREATE INDEX IF NOT EXISTS idx_inventory_events_processed_at ON inventory_events(processed_at);
+CREATE INDEX IF NOT EXISTS idx_inventory_events_correlation_id ON inventory_events(correlation_id);
+CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders(user_id);
+CREATE INDEX IF NOT EXISTS idx_orders_product_id ON orders(product_id);
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
+CREATE INDEX IF NOT EXISTS idx_orders_created_at ON orders(created_at);
+CREATE INDEX IF NOT EXISTS idx_orders_correlation_id ON orders(correlation_id);
+CREATE INDEX IF NOT EXISTS idx_inventory_snapshots_product_id ON inventory_snapshots(product_id);
+CREATE INDEX IF NOT EXISTS idx_inventory_snapshots_snapshot_at ON inventory_snapshots(snapshot_at);
+
 -- Triggers for automatic timestamp updates
 CREATE OR REPLACE FUNCTION update_updated_at_column()
 RETURNS TRIGGER AS $$
@@ -101,9 +99,11 @@ BEGIN
 END;
 $$ language 'plpgsql';
 
+DROP TRIGGER IF EXISTS update_products_updated_at ON products;
 CREATE TRIGGER update_products_updated_at BEFORE UPDATE ON products
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
+DROP TRIGGER IF EXISTS update_orders_updated_at ON orders;
 CREATE TRIGGER update_orders_updated_at BEFORE UPDATE ON orders
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
@@ -175,12 +175,3 @@ SELECT
     COUNT(CASE WHEN available_stock < 10 THEN 1 END) as low_stock_products,
     AVG(available_stock) as avg_available_stock
 FROM products;
-
--- Sample data for testing
-INSERT INTO products (id, name, description, price, total_stock, available_stock, reserved_stock) VALUES
-('550e8400-e29b-41d4-a716-446655440001', 'iPhone 15 Pro', 'Latest iPhone with advanced features', 999.99, 100, 100, 0),
-('550e8400-e29b-41d4-a716-446655440002', 'Samsung Galaxy S24', 'Premium Android smartphone', 899.99, 50, 50, 0),
-('550e8400-e29b-41d4-a716-446655440003', 'MacBook Pro M3', 'High-performance laptop', 1999.99, 25, 25, 0),
-('550e8400-e29b-41d4-a716-446655440004', 'AirPods Pro', 'Wireless earbuds with noise cancellation', 249.99, 200, 200, 0),
-('550e8400-e29b-41d4-a716-446655440005', 'iPad Air', 'Tablet for productivity and entertainment', 599.99, 75, 75, 0)
-ON CONFLICT (id) DO NOTHING;
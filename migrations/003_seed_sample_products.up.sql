@@ -0,0 +1,8 @@
+-- Sample products used by the load tests
+INSERT INTO products (id, name, description, price, total_stock, available_stock, reserved_stock) VALUES
+('550e8400-e29b-41d4-a716-446655440001', 'iPhone 15 Pro', 'Latest iPhone with advanced features', 999.99, 100, 100, 0),
+('550e8400-e29b-41d4-a716-446655440002', 'Samsung Galaxy S24', 'Premium Android smartphone', 899.99, 50, 50, 0),
+('550e8400-e29b-41d4-a716-446655440003', 'MacBook Pro M3', 'High-performance laptop', 1999.99, 25, 25, 0),
+('550e8400-e29b-41d4-a716-446655440004', 'AirPods Pro', 'Wireless earbuds with noise cancellation', 249.99, 200, 200, 0),
+('550e8400-e29b-41d4-a716-446655440005', 'iPad Air', 'Tablet for productivity and entertainment', 599.99, 75, 75, 0)
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_user_reservations_user_id_reserved_at;
+
+ALTER TABLE user_reservations DROP COLUMN IF EXISTS extensions;
+ALTER TABLE user_reservations DROP COLUMN IF EXISTS reason;
+
+UPDATE user_reservations SET status = 'EXPIRED' WHERE status IN ('PENDING', 'REJECTED');
+ALTER TABLE user_reservations DROP CONSTRAINT IF EXISTS user_reservations_status_check;
+ALTER TABLE user_reservations ADD CONSTRAINT user_reservations_status_check
+    CHECK (status IN ('ACTIVE', 'CONFIRMED', 'RELEASED', 'EXPIRED'));
@@ -0,0 +1,13 @@
+-- Reservations are recorded as PENDING by the API server before the reserve
+-- event is published and resolved to ACTIVE or REJECTED by the processor
+ALTER TABLE user_reservations DROP CONSTRAINT IF EXISTS user_reservations_status_check;
+ALTER TABLE user_reservations ADD CONSTRAINT user_reservations_status_check
+    CHECK (status IN ('PENDING', 'ACTIVE', 'CONFIRMED', 'RELEASED', 'EXPIRED', 'REJECTED'));
+
+-- Why a reservation was rejected
+ALTER TABLE user_reservations ADD COLUMN IF NOT EXISTS reason VARCHAR(50);
+
+-- How many times the hold was extended
+ALTER TABLE user_reservations ADD COLUMN IF NOT EXISTS extensions INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_user_reservations_user_id_reserved_at ON user_reservations(user_id, reserved_at DESC);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_user_reservations_order_id;
+ALTER TABLE user_reservations DROP COLUMN IF EXISTS order_id;
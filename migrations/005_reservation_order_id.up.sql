@@ -0,0 +1,8 @@
+-- Reservations are looked up by the order they were made for
+ALTER TABLE user_reservations ADD COLUMN IF NOT EXISTS order_id UUID;
+
+-- Until now reservations made through the API used the order ID as their ID
+UPDATE user_reservations SET order_id = id WHERE order_id IS NULL;
+
+ALTER TABLE user_reservations ALTER COLUMN order_id SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_reservations_order_id ON user_reservations(order_id);
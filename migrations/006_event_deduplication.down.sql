@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_user_reservations_idempotency_key;
+ALTER TABLE user_reservations DROP COLUMN IF EXISTS idempotency_key;
+DROP INDEX IF EXISTS idx_inventory_events_event_id;
@@ -0,0 +1,13 @@
+-- Processed events are recorded once, by the transaction that applied them
+DELETE FROM inventory_events a
+USING inventory_events b
+WHERE a.event_id = b.event_id AND a.id > b.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_inventory_events_event_id ON inventory_events(event_id);
+
+-- Reserve requests retried by a client under the same key return the same order
+ALTER TABLE user_reservations ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_reservations_idempotency_key
+    ON user_reservations(user_id, idempotency_key)
+    WHERE idempotency_key IS NOT NULL;
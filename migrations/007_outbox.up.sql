@@ -0,0 +1,14 @@
+-- Kafka messages written in the transaction of the change they describe and
+-- published by the outbox relay in id order
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(50) NOT NULL CHECK (kind IN ('inventory-event', 'inventory-state')),
+    message_key VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    request_id VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_unsent ON outbox(id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_sent_at ON outbox(sent_at) WHERE sent_at IS NOT NULL;
@@ -0,0 +1,12 @@
+ALTER TABLE products DROP COLUMN IF EXISTS deleted_at;
+
+DELETE FROM inventory_events WHERE event_type IN (
+    'INVENTORY_ADJUST', 'INVENTORY_PRODUCT_CREATED', 'INVENTORY_PRODUCT_UPDATED', 'INVENTORY_PRODUCT_DELETED'
+);
+
+ALTER TABLE inventory_events DROP CONSTRAINT IF EXISTS inventory_events_quantity_check;
+ALTER TABLE inventory_events ADD CONSTRAINT inventory_events_quantity_check CHECK (quantity > 0);
+
+ALTER TABLE inventory_events DROP CONSTRAINT IF EXISTS inventory_events_event_type_check;
+ALTER TABLE inventory_events ADD CONSTRAINT inventory_events_event_type_check
+    CHECK (event_type IN ('INVENTORY_CHECK', 'INVENTORY_RESERVE', 'INVENTORY_CONFIRM', 'INVENTORY_RELEASE', 'INVENTORY_RESTOCK'));
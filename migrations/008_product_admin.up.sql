@@ -0,0 +1,20 @@
+-- Product changes, restocks and manual adjustments are recorded in the event
+-- ledger like every other stock change
+ALTER TABLE inventory_events DROP CONSTRAINT IF EXISTS inventory_events_event_type_check;
+ALTER TABLE inventory_events ADD CONSTRAINT inventory_events_event_type_check
+    CHECK (event_type IN (
+        'INVENTORY_CHECK', 'INVENTORY_RESERVE', 'INVENTORY_CONFIRM', 'INVENTORY_RELEASE',
+        'INVENTORY_RESTOCK', 'INVENTORY_ADJUST',
+        'INVENTORY_PRODUCT_CREATED', 'INVENTORY_PRODUCT_UPDATED', 'INVENTORY_PRODUCT_DELETED'
+    ));
+
+-- Adjustments may remove stock and product changes may move none
+ALTER TABLE inventory_events DROP CONSTRAINT IF EXISTS inventory_events_quantity_check;
+ALTER TABLE inventory_events ADD CONSTRAINT inventory_events_quantity_check
+    CHECK (quantity > 0 OR event_type IN (
+        'INVENTORY_ADJUST', 'INVENTORY_PRODUCT_CREATED', 'INVENTORY_PRODUCT_UPDATED', 'INVENTORY_PRODUCT_DELETED'
+    ));
+
+-- Deleted products are kept for the reservations, orders and events that
+-- refer to them
+ALTER TABLE products ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
@@ -0,0 +1,12 @@
+DELETE FROM inventory_events WHERE event_type = 'INVENTORY_RESERVE_BATCH';
+
+ALTER TABLE inventory_events DROP CONSTRAINT IF EXISTS inventory_events_event_type_check;
+ALTER TABLE inventory_events ADD CONSTRAINT inventory_events_event_type_check
+    CHECK (event_type IN (
+        'INVENTORY_CHECK', 'INVENTORY_RESERVE', 'INVENTORY_CONFIRM', 'INVENTORY_RELEASE',
+        'INVENTORY_RESTOCK', 'INVENTORY_ADJUST',
+        'INVENTORY_PRODUCT_CREATED', 'INVENTORY_PRODUCT_UPDATED', 'INVENTORY_PRODUCT_DELETED'
+    ));
+
+DROP INDEX IF EXISTS idx_user_reservations_batch_id;
+ALTER TABLE user_reservations DROP COLUMN IF EXISTS batch_id;
@@ -0,0 +1,13 @@
+-- Reservations made together by POST /api/v1/inventory/reserve-batch share a
+-- batch ID and are reserved or rejected as a whole
+ALTER TABLE user_reservations ADD COLUMN IF NOT EXISTS batch_id UUID;
+
+CREATE INDEX IF NOT EXISTS idx_user_reservations_batch_id ON user_reservations(batch_id) WHERE batch_id IS NOT NULL;
+
+ALTER TABLE inventory_events DROP CONSTRAINT IF EXISTS inventory_events_event_type_check;
+ALTER TABLE inventory_events ADD CONSTRAINT inventory_events_event_type_check
+    CHECK (event_type IN (
+        'INVENTORY_CHECK', 'INVENTORY_RESERVE', 'INVENTORY_RESERVE_BATCH', 'INVENTORY_CONFIRM', 'INVENTORY_RELEASE',
+        'INVENTORY_RESTOCK', 'INVENTORY_ADJUST',
+        'INVENTORY_PRODUCT_CREATED', 'INVENTORY_PRODUCT_UPDATED', 'INVENTORY_PRODUCT_DELETED'
+    ));
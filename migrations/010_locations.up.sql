@@ -0,0 +1,47 @@
+-- Warehouses stock is shipped from. A product's stock columns stay the sum of
+-- its stock over every location.
+CREATE TABLE IF NOT EXISTS locations (
+    id VARCHAR(50) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    region VARCHAR(50) NOT NULL,
+    latitude DOUBLE PRECISION,
+    longitude DOUBLE PRECISION,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT check_location_coordinates CHECK ((latitude IS NULL) = (longitude IS NULL))
+);
+
+-- Stock of a product at one location
+CREATE TABLE IF NOT EXISTS product_stock (
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    location_id VARCHAR(50) NOT NULL REFERENCES locations(id),
+    total_stock INTEGER NOT NULL DEFAULT 0 CHECK (total_stock >= 0),
+    available_stock INTEGER NOT NULL DEFAULT 0 CHECK (available_stock >= 0),
+    reserved_stock INTEGER NOT NULL DEFAULT 0 CHECK (reserved_stock >= 0),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (product_id, location_id),
+
+    CONSTRAINT check_location_stock_consistency CHECK (total_stock = available_stock + reserved_stock)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_stock_location_id ON product_stock(location_id);
+
+-- The part of a reservation held at each location
+CREATE TABLE IF NOT EXISTS reservation_allocations (
+    reservation_id UUID NOT NULL REFERENCES user_reservations(id) ON DELETE CASCADE,
+    location_id VARCHAR(50) NOT NULL REFERENCES locations(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    PRIMARY KEY (reservation_id, location_id)
+);
+
+-- Stock recorded before locations existed is held at the default location
+INSERT INTO locations (id, name, region) VALUES ('default', 'Default warehouse', 'default')
+ON CONFLICT (id) DO NOTHING;
+
+INSERT INTO product_stock (product_id, location_id, total_stock, available_stock, reserved_stock)
+SELECT id, 'default', total_stock, available_stock, reserved_stock FROM products
+ON CONFLICT DO NOTHING;
+
+INSERT INTO reservation_allocations (reservation_id, location_id, quantity)
+SELECT id, 'default', quantity FROM user_reservations WHERE status = 'ACTIVE'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+-- W3C trace context (traceparent, tracestate) of the request that queued an
+-- outbox message, restored by the relay so the publish joins its trace
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS trace_context JSONB;
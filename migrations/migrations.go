@@ -0,0 +1,10 @@
+// Package migrations embeds the versioned SQL migrations. Files are named
+// NNN_description.up.sql with a matching NNN_description.down.sql.
+package migrations
+
+import "embed"
+
+// FS holds every migration file
+//
+//go:embed *.sql
+var FS embed.FS
@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 type ProductAvailabilityRequest struct {
@@ -146,7 +148,7 @@ func testConcurrentPurchases(baseURL string, products []string, numRequests int)
 			req := PurchaseRequest{
 				ProductID: productID,
 				Quantity:  1,
-				UserID:    fmt.Sprintf("user-%d", i),
+				UserID:    uuid.NewString(),
 			}
 
 			jsonData, _ := json.Marshal(req)
@@ -212,7 +214,7 @@ func testMixedLoad(baseURL string, products []string, numRequests int) {
 				req := PurchaseRequest{
 					ProductID: productID,
 					Quantity:  1,
-					UserID:    fmt.Sprintf("user-%d", i),
+					UserID:    uuid.NewString(),
 				}
 				jsonData, _ := json.Marshal(req)
 				resp, err := http.Post(baseURL+"/api/v1/inventory/reserve",
@@ -6,7 +6,7 @@ echo "=============================="
 # Check if server is running
 if ! curl -s http://localhost:8080/api/v1/health > /dev/null; then
     echo "Error: Server is not running on localhost:8080"
-    echo "Please start the server first with: go run main.go"
+    echo "Please start the server first with: go run ./cmd/url-shortener serve"
     exit 1
 fi
 